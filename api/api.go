@@ -1,63 +1,140 @@
-package main
+package api
 
 import (
 	"ToDo/store"
 	"encoding/json"
 	"log"
+	"mime"
 	"net/http"
 	"regexp"
+	"strconv"
+	"strings"
 )
 
-func main() {
-	store, _ := store.NewJsonStore("../data/")
-	listHandler := NewListHandler(store)
-
-	mux := http.NewServeMux()
-
-	mux.Handle("/", &HomeHandler{})
-	mux.Handle("/lists/", listHandler)
-
-	log.Fatalln("ListenAndServe: ", http.ListenAndServe(":8080", mux))
-}
-
 type HomeHandler struct{}
 
 func (h *HomeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		NotFoundHandler(w, r)
+		return
+	}
 	w.Write([]byte("Hello World"))
 }
 
 type ListHandler struct {
-	store store.Store
+	store    store.Store
+	sessions *Sessions
 }
 
-func NewListHandler(s store.Store) *ListHandler {
+// NewListHandler serves the API over s, with logins kept in sessions. Wrap it
+// with RequireAuth to turn away requests that aren't logged in.
+func NewListHandler(s store.Store, sessions *Sessions) *ListHandler {
 	return &ListHandler{
-		store: s,
+		store:    s,
+		sessions: sessions,
 	}
 }
 
-func (h *ListHandler) UpdateList(w http.ResponseWriter, r *http.Request) {
+// CreateList adds a list with an ID picked by the store and responds with the
+// stored list.
+func (h *ListHandler) CreateList(w http.ResponseWriter, r *http.Request) {
+	matches := ListRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 2 {
+		log.Println("Create List - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	if !isJSON(r) {
+		log.Println("Create List - Unsupported content type ", r.Header.Get("Content-Type"))
+		UnsupportedMediaTypeHandler(w, r)
+		return
+	}
+
 	var list store.TodoList
 	if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
 		log.Println("Create List - Error Decoding ", err)
-		InternalServerErrorHandler(w, r)
+		BadRequestHandler(w, r, "malformed list: "+err.Error())
 		return
 	}
-	log.Println(list)
-
-	matches := ListRe.FindStringSubmatch(r.URL.Path)
 
-	if len(matches) < 2 {
-		log.Println("Create List - Not enough arguments")
-		InternalServerErrorHandler(w, r)
+	listID, err := h.store.CreateTodoList(list, matches[1])
+	if err != nil {
+		log.Println("Create List - ", err)
+		StoreErrorHandler(w, r, err)
 		return
 	}
 
-	if err := h.store.UpdateTodoList(list, matches[1]); err != nil {
+	created, err := h.store.GetTodoList(matches[1], listID)
+	if err != nil {
 		log.Println("Create List - ", err)
-		InternalServerErrorHandler(w, r)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Create List - Success")
+	w.Header().Set("Location", "/lists/"+matches[1]+"/"+listID)
+	w.Header().Set("ETag", etag(created.Version))
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (h *ListHandler) UpdateList(w http.ResponseWriter, r *http.Request) {
+	if !isJSON(r) {
+		log.Println("Update List - Unsupported content type ", r.Header.Get("Content-Type"))
+		UnsupportedMediaTypeHandler(w, r)
 		return
 	}
+
+	var list store.TodoList
+	if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+		log.Println("Update List - Error Decoding ", err)
+		BadRequestHandler(w, r, "malformed list: "+err.Error())
+		return
+	}
+
+	matches := ListReWithID.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 3 {
+		log.Println("Update List - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	if list.ID == "" {
+		list.ID = matches[2]
+	}
+	if list.ID != matches[2] {
+		log.Println("Update List - ID mismatch")
+		BadRequestHandler(w, r, "list ID "+list.ID+" does not match URL")
+		return
+	}
+	if list.Todos == nil {
+		list.Todos = make(map[string]*store.Todo)
+	}
+	for _, todo := range list.Todos {
+		todo.Tags = store.NormalizeTags(todo.Tags)
+	}
+
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		version, err := parseETag(ifMatch)
+		if err != nil {
+			log.Println("Update List - Bad If-Match ", ifMatch)
+			PreconditionFailedHandler(w, r, "If-Match "+ifMatch+" is not a list version")
+			return
+		}
+		list.Version = version
+	}
+
+	if err := h.store.UpdateTodoList(list, matches[1], actor(r, matches[1])); err != nil {
+		log.Println("Update List - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+	if updated, err := h.store.GetTodoList(matches[1], list.ID); err == nil {
+		w.Header().Set("ETag", etag(updated.Version))
+	}
+
 	log.Println("Update List - Success")
 	w.WriteHeader(http.StatusOK)
 }
@@ -67,14 +144,14 @@ func (h *ListHandler) GetLists(w http.ResponseWriter, r *http.Request) {
 
 	if len(matches) < 2 {
 		log.Println("Get Lists - Not enough arguments")
-		InternalServerErrorHandler(w, r)
+		NotFoundHandler(w, r)
 		return
 	}
 
 	lists, err := h.store.GetTodoLists(matches[1])
 	if err != nil {
 		log.Println("Get Lists - ", err)
-		InternalServerErrorHandler(w, r)
+		StoreErrorHandler(w, r, err)
 		return
 	}
 
@@ -87,6 +164,7 @@ func (h *ListHandler) GetLists(w http.ResponseWriter, r *http.Request) {
 
 	log.Println("Get Lists - Success")
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write(byteValue)
 }
@@ -96,14 +174,14 @@ func (h *ListHandler) GetList(w http.ResponseWriter, r *http.Request) {
 
 	if len(matches) < 3 {
 		log.Println("Get List - Not enough arguments")
-		InternalServerErrorHandler(w, r)
+		NotFoundHandler(w, r)
 		return
 	}
 
 	list, err := h.store.GetTodoList(matches[1], matches[2])
 	if err != nil {
 		log.Println("Get List - ", err)
-		InternalServerErrorHandler(w, r)
+		StoreErrorHandler(w, r, err)
 		return
 	}
 
@@ -116,6 +194,8 @@ func (h *ListHandler) GetList(w http.ResponseWriter, r *http.Request) {
 
 	log.Println("Get List - Success")
 
+	w.Header().Set("ETag", etag(list.Version))
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write(byteValue)
 }
@@ -125,14 +205,14 @@ func (h *ListHandler) DeleteList(w http.ResponseWriter, r *http.Request) {
 
 	if len(matches) < 3 {
 		log.Println("Delete List - Not enough arguments")
-		InternalServerErrorHandler(w, r)
+		NotFoundHandler(w, r)
 		return
 	}
 
 	err := h.store.DeleteTodoList(matches[1], matches[2])
 	if err != nil {
 		log.Println("Delete list - ", err)
-		InternalServerErrorHandler(w, r)
+		StoreErrorHandler(w, r, err)
 		return
 	}
 
@@ -140,15 +220,72 @@ func (h *ListHandler) DeleteList(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// MoveRequest is the body of a move, By places towards the end or towards
+// the start when negative.
+type MoveRequest struct {
+	By int
+}
+
+func decodeMove(w http.ResponseWriter, r *http.Request, op string) (MoveRequest, bool) {
+	var move MoveRequest
+
+	if !isJSON(r) {
+		log.Println(op+" - Unsupported content type ", r.Header.Get("Content-Type"))
+		UnsupportedMediaTypeHandler(w, r)
+		return move, false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&move); err != nil {
+		log.Println(op+" - Error Decoding ", err)
+		BadRequestHandler(w, r, "malformed move: "+err.Error())
+		return move, false
+	}
+
+	return move, true
+}
+
+func (h *ListHandler) MoveList(w http.ResponseWriter, r *http.Request) {
+	matches := ListMoveRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 3 {
+		log.Println("Move List - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	move, ok := decodeMove(w, r, "Move List")
+	if !ok {
+		return
+	}
+
+	if err := h.store.MoveTodoList(matches[1], matches[2], move.By); err != nil {
+		log.Println("Move List - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	list, err := h.store.GetTodoList(matches[1], matches[2])
+	if err != nil {
+		log.Println("Move List - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Move List - Success")
+	w.Header().Set("ETag", etag(list.Version))
+	writeJSON(w, http.StatusOK, list)
+}
+
 var (
 	ListRe       = regexp.MustCompile(`^/lists/([^/]+)$`)
-	ListReWithID = regexp.MustCompile(`^/lists/([^/]+)/([^/])$`)
+	ListReWithID = regexp.MustCompile(`^/lists/([^/]+)/([^/]+)$`)
+	ListMoveRe   = regexp.MustCompile(`^/lists/([^/]+)/([^/]+)/move$`)
 )
 
 func (h *ListHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch {
 	case r.Method == http.MethodPost && ListRe.MatchString(r.URL.Path):
-		h.UpdateList(w, r)
+		h.CreateList(w, r)
 		return
 	case r.Method == http.MethodGet && ListRe.MatchString(r.URL.Path):
 		h.GetLists(w, r)
@@ -162,17 +299,151 @@ func (h *ListHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case r.Method == http.MethodDelete && ListReWithID.MatchString(r.URL.Path):
 		h.DeleteList(w, r)
 		return
+	case r.Method == http.MethodPost && TodosRe.MatchString(r.URL.Path):
+		h.AddTodo(w, r)
+		return
+	case r.Method == http.MethodGet && TodoRe.MatchString(r.URL.Path):
+		h.GetTodo(w, r)
+		return
+	case r.Method == http.MethodPatch && TodoRe.MatchString(r.URL.Path):
+		h.UpdateTodo(w, r)
+		return
+	case r.Method == http.MethodDelete && TodoRe.MatchString(r.URL.Path):
+		h.DeleteTodo(w, r)
+		return
+	case r.Method == http.MethodPost && TodoToggleRe.MatchString(r.URL.Path):
+		h.ToggleTodo(w, r)
+		return
+	case r.Method == http.MethodPost && ListMoveRe.MatchString(r.URL.Path):
+		h.MoveList(w, r)
+		return
+	case r.Method == http.MethodPost && TodoMoveRe.MatchString(r.URL.Path):
+		h.MoveTodo(w, r)
+		return
+	case r.Method == http.MethodPost && LoginRe.MatchString(r.URL.Path):
+		h.Login(w, r)
+		return
+	case r.Method == http.MethodPost && LogoutRe.MatchString(r.URL.Path):
+		h.Logout(w, r)
+		return
+	case r.Method == http.MethodGet && CurrentKeyRe.MatchString(r.URL.Path):
+		h.GetCurrentKey(w, r)
+		return
+	case r.Method == http.MethodPost && UsersRe.MatchString(r.URL.Path):
+		h.CreateUser(w, r)
+		return
+	case r.Method == http.MethodGet && UsersRe.MatchString(r.URL.Path):
+		h.GetUsers(w, r)
+		return
+	case r.Method == http.MethodGet && UserRe.MatchString(r.URL.Path):
+		h.GetUser(w, r)
+		return
+	case r.Method == http.MethodPatch && UserRe.MatchString(r.URL.Path):
+		h.UpdateUser(w, r)
+		return
+	case r.Method == http.MethodDelete && UserRe.MatchString(r.URL.Path):
+		h.DeleteUser(w, r)
+		return
+	case r.Method == http.MethodGet && UserTodosRe.MatchString(r.URL.Path):
+		h.FindTodos(w, r)
+		return
+	case r.Method == http.MethodGet && TodoHistoryRe.MatchString(r.URL.Path):
+		h.TodoHistory(w, r)
+		return
+	case r.Method == http.MethodGet && UserTrashRe.MatchString(r.URL.Path):
+		h.GetTrash(w, r)
+		return
+	case r.Method == http.MethodDelete && UserTrashRe.MatchString(r.URL.Path):
+		h.PurgeTrash(w, r)
+		return
+	case r.Method == http.MethodGet && UserKeysRe.MatchString(r.URL.Path):
+		h.GetKeys(w, r)
+		return
+	case r.Method == http.MethodPost && UserKeysRe.MatchString(r.URL.Path):
+		h.CreateKey(w, r)
+		return
+	case r.Method == http.MethodDelete && UserKeyRe.MatchString(r.URL.Path):
+		h.RevokeKey(w, r)
+		return
+	case r.Method == http.MethodGet && ListMembersRe.MatchString(r.URL.Path):
+		h.GetMembers(w, r)
+		return
+	case r.Method == http.MethodPut && ListMemberRe.MatchString(r.URL.Path):
+		h.ShareList(w, r)
+		return
+	case r.Method == http.MethodDelete && ListMemberRe.MatchString(r.URL.Path):
+		h.UnshareList(w, r)
+		return
+	case r.Method == http.MethodGet && UserSharedRe.MatchString(r.URL.Path):
+		h.GetShared(w, r)
+		return
+	case r.Method == http.MethodPost && ListRestoreRe.MatchString(r.URL.Path):
+		h.RestoreList(w, r)
+		return
+	case r.Method == http.MethodPost && TodoRestoreRe.MatchString(r.URL.Path):
+		h.RestoreTodo(w, r)
+		return
+	case ListRe.MatchString(r.URL.Path):
+		w.Header().Set("Allow", "GET, POST")
+		MethodNotAllowedHandler(w, r)
+		return
+	case ListReWithID.MatchString(r.URL.Path):
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		MethodNotAllowedHandler(w, r)
+		return
+	case TodosRe.MatchString(r.URL.Path), TodoToggleRe.MatchString(r.URL.Path),
+		ListMoveRe.MatchString(r.URL.Path), TodoMoveRe.MatchString(r.URL.Path),
+		ListRestoreRe.MatchString(r.URL.Path), TodoRestoreRe.MatchString(r.URL.Path),
+		LoginRe.MatchString(r.URL.Path), LogoutRe.MatchString(r.URL.Path):
+		w.Header().Set("Allow", "POST")
+		MethodNotAllowedHandler(w, r)
+		return
+	case TodoRe.MatchString(r.URL.Path):
+		w.Header().Set("Allow", "GET, PATCH, DELETE")
+		MethodNotAllowedHandler(w, r)
+		return
+	case UserTodosRe.MatchString(r.URL.Path), TodoHistoryRe.MatchString(r.URL.Path),
+		CurrentKeyRe.MatchString(r.URL.Path), ListMembersRe.MatchString(r.URL.Path),
+		UserSharedRe.MatchString(r.URL.Path):
+		w.Header().Set("Allow", "GET")
+		MethodNotAllowedHandler(w, r)
+		return
+	case UsersRe.MatchString(r.URL.Path), UserKeysRe.MatchString(r.URL.Path):
+		w.Header().Set("Allow", "GET, POST")
+		MethodNotAllowedHandler(w, r)
+		return
+	case UserRe.MatchString(r.URL.Path):
+		w.Header().Set("Allow", "GET, PATCH, DELETE")
+		MethodNotAllowedHandler(w, r)
+		return
+	case UserTrashRe.MatchString(r.URL.Path):
+		w.Header().Set("Allow", "GET, DELETE")
+		MethodNotAllowedHandler(w, r)
+		return
+	case UserKeyRe.MatchString(r.URL.Path):
+		w.Header().Set("Allow", "DELETE")
+		MethodNotAllowedHandler(w, r)
+		return
+	case ListMemberRe.MatchString(r.URL.Path):
+		w.Header().Set("Allow", "PUT, DELETE")
+		MethodNotAllowedHandler(w, r)
+		return
 	default:
+		NotFoundHandler(w, r)
 		return
 	}
 }
 
-func InternalServerErrorHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusInternalServerError)
-	w.Write([]byte("500 Internal Server Error"))
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+func parseETag(tag string) (int, error) {
+	tag = strings.TrimPrefix(tag, "W/")
+	return strconv.Atoi(strings.Trim(tag, `"`))
 }
 
-func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNotFound)
-	w.Write([]byte("404 Not Found"))
+func isJSON(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
 }
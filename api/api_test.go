@@ -0,0 +1,869 @@
+package api
+
+import (
+	"ToDo/store"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestHandler(t *testing.T) (*ListHandler, string, string) {
+	t.Helper()
+
+	s := store.NewInMemoryStore()
+	userID, err := s.CreateUser("Steve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listID, err := s.CreateTodoList(store.NewTodoList("", "groceries"), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewListHandler(s, NewSessions(DefaultSessionTTL)), userID, listID
+}
+
+func TestListHandlerErrors(t *testing.T) {
+	handler, userID, listID := newTestHandler(t)
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		status      int
+		code        string
+	}{
+		{"missing list", http.MethodGet, "/lists/" + userID + "/9", "", "", http.StatusNotFound, "list_not_found"},
+		{"missing user", http.MethodGet, "/lists/9999", "", "", http.StatusNotFound, "user_not_found"},
+		{"delete missing list", http.MethodDelete, "/lists/" + userID + "/9", "", "", http.StatusNotFound, "list_not_found"},
+		{"malformed json", http.MethodPost, "/lists/" + userID, "application/json", "{", http.StatusBadRequest, "bad_request"},
+		{"put missing list", http.MethodPut, "/lists/" + userID + "/9", "application/json", `{"Name":"chores"}`, http.StatusNotFound, "list_not_found"},
+		{"mismatched list ID", http.MethodPut, "/lists/" + userID + "/" + listID, "application/json", `{"ID":"2"}`, http.StatusBadRequest, "bad_request"},
+		{"wrong content type", http.MethodPost, "/lists/" + userID, "text/plain", `{"ID":"2"}`, http.StatusUnsupportedMediaType, "unsupported_media_type"},
+		{"wrong method", http.MethodPatch, "/lists/" + userID, "", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"toggle missing todo", http.MethodPost, "/lists/" + userID + "/" + listID + "/todos/9/toggle", "", "", http.StatusNotFound, "todo_not_found"},
+		{"add todo to missing list", http.MethodPost, "/lists/" + userID + "/9/todos", "application/json", `{"Title":"milk"}`, http.StatusNotFound, "list_not_found"},
+		{"missing grandparent", http.MethodPost, "/lists/" + userID, "application/json", `{"Name":"trip","Todos":{"a":{"ID":"a","ParentID":"x"},"b":{"ID":"b","ParentID":"a"}}}`, http.StatusBadRequest, "invalid_todo"},
+		{"subtask of missing todo", http.MethodPost, "/lists/" + userID + "/" + listID + "/todos", "application/json", `{"Title":"socks","ParentID":"9"}`, http.StatusBadRequest, "invalid_todo"},
+		{"malformed due date", http.MethodPatch, "/lists/" + userID + "/" + listID + "/todos/9", "application/json", `{"Due":"tomorrow"}`, http.StatusBadRequest, "bad_request"},
+		{"wrong todo method", http.MethodPut, "/lists/" + userID + "/" + listID + "/todos/9", "", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"find todos of missing user", http.MethodGet, "/users/9999/todos?tag=work", "", "", http.StatusNotFound, "user_not_found"},
+		{"wrong find todos method", http.MethodPost, "/users/" + userID + "/todos", "", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"history of missing todo", http.MethodGet, "/lists/" + userID + "/" + listID + "/todos/9/history", "", "", http.StatusNotFound, "todo_not_found"},
+		{"wrong history method", http.MethodPost, "/lists/" + userID + "/" + listID + "/todos/9/history", "", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"trash of missing user", http.MethodGet, "/users/9999/trash", "", "", http.StatusNotFound, "user_not_found"},
+		{"malformed purge before", http.MethodDelete, "/users/" + userID + "/trash?before=yesterday", "", "", http.StatusBadRequest, "bad_request"},
+		{"restore list not in trash", http.MethodPost, "/lists/" + userID + "/" + listID + "/restore", "", "", http.StatusNotFound, "list_not_found"},
+		{"restore todo not in trash", http.MethodPost, "/lists/" + userID + "/" + listID + "/todos/9/restore", "", "", http.StatusNotFound, "todo_not_found"},
+		{"wrong trash method", http.MethodPost, "/users/" + userID + "/trash", "", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"user without a name", http.MethodPost, "/users", "application/json", `{}`, http.StatusBadRequest, "bad_request"},
+		{"rename user to nothing", http.MethodPatch, "/users/" + userID, "application/json", `{"Name":""}`, http.StatusBadRequest, "bad_request"},
+		{"rename missing user", http.MethodPatch, "/users/9999", "application/json", `{"Name":"Steve"}`, http.StatusNotFound, "user_not_found"},
+		{"delete missing user", http.MethodDelete, "/users/9999", "", "", http.StatusNotFound, "user_not_found"},
+		{"wrong user method", http.MethodPut, "/users/" + userID, "", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"name taken", http.MethodPost, "/users", "application/json", `{"Name":"steve","Password":"correct horse"}`, http.StatusConflict, "conflict"},
+		{"short password", http.MethodPatch, "/users/" + userID, "application/json", `{"Password":"short"}`, http.StatusBadRequest, "invalid_user"},
+		{"login unknown name", http.MethodPost, "/auth/login", "application/json", `{"Name":"Nobody","Password":"correct horse"}`, http.StatusUnauthorized, "unauthorized"},
+		{"login without a password set", http.MethodPost, "/auth/login", "application/json", `{"Name":"Steve","Password":""}`, http.StatusUnauthorized, "unauthorized"},
+		{"wrong login method", http.MethodGet, "/auth/login", "", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"key without a name", http.MethodPost, "/users/" + userID + "/keys", "application/json", `{}`, http.StatusBadRequest, "bad_request"},
+		{"key with unknown scope", http.MethodPost, "/users/" + userID + "/keys", "application/json", `{"Name":"ci","Scope":"admin"}`, http.StatusBadRequest, "invalid_key"},
+		{"revoke missing key", http.MethodDelete, "/users/" + userID + "/keys/9", "", "", http.StatusNotFound, "key_not_found"},
+		{"current key without one", http.MethodGet, "/auth/key", "", "", http.StatusUnauthorized, "unauthorized"},
+		{"wrong key method", http.MethodGet, "/users/" + userID + "/keys/9", "", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"members of missing list", http.MethodGet, "/lists/" + userID + "/9/members", "", "", http.StatusNotFound, "list_not_found"},
+		{"share as owner", http.MethodPut, "/lists/" + userID + "/" + listID + "/members/9", "application/json", `{"Role":"owner"}`, http.StatusBadRequest, "invalid_member"},
+		{"share with missing user", http.MethodPut, "/lists/" + userID + "/" + listID + "/members/9999", "application/json", `{"Role":"viewer"}`, http.StatusNotFound, "user_not_found"},
+		{"unshare non-member", http.MethodDelete, "/lists/" + userID + "/" + listID + "/members/9", "", "", http.StatusNotFound, "member_not_found"},
+		{"wrong member method", http.MethodGet, "/lists/" + userID + "/" + listID + "/members/9", "", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"shared with missing user", http.MethodGet, "/users/9999/shared", "", "", http.StatusNotFound, "user_not_found"},
+		{"assign to non-member", http.MethodPost, "/lists/" + userID + "/" + listID + "/todos", "application/json", `{"Title":"milk","AssigneeID":"9999"}`, http.StatusBadRequest, "invalid_todo"},
+		{"unknown route", http.MethodGet, "/lists/" + userID + "/" + listID + "/extra/bits", "", "", http.StatusNotFound, "not_found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("got status %d want %d", rec.Code, tt.status)
+			}
+
+			var body ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+			}
+
+			if body.Error.Code != tt.code {
+				t.Errorf("got code %q want %q", body.Error.Code, tt.code)
+			}
+			if body.Error.Message == "" {
+				t.Error("expected an error message")
+			}
+		})
+	}
+}
+
+func TestCreateList(t *testing.T) {
+	handler, userID, _ := newTestHandler(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/lists/"+userID, strings.NewReader(`{"ID":"mine","Name":"chores"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("got status %d want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+
+	var created store.TodoList
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == "" || created.ID == "mine" {
+		t.Errorf("got list ID %q want one picked by the store", created.ID)
+	}
+	if got, want := rec.Header().Get("Location"), "/lists/"+userID+"/"+created.ID; got != want {
+		t.Errorf("got Location %q want %q", got, want)
+	}
+	if got := rec.Header().Get("ETag"); got != `"1"` {
+		t.Errorf("got ETag %q want %q", got, `"1"`)
+	}
+
+	list, err := handler.store.GetTodoList(userID, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Name != "chores" {
+		t.Errorf("got name %q want %q", list.Name, "chores")
+	}
+}
+
+func TestPutListTakesIDFromURL(t *testing.T) {
+	handler, userID, listID := newTestHandler(t)
+
+	req := httptest.NewRequest(http.MethodPut, "/lists/"+userID+"/"+listID, strings.NewReader(`{"Name":"chores"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	list, err := handler.store.GetTodoList(userID, listID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Name != "chores" {
+		t.Errorf("got name %q want %q", list.Name, "chores")
+	}
+}
+
+func TestListETags(t *testing.T) {
+	handler, userID, listID := newTestHandler(t)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lists/"+userID+"/"+listID, nil))
+
+	tag := rec.Header().Get("ETag")
+	if tag != `"1"` {
+		t.Fatalf("got ETag %q want %q", tag, `"1"`)
+	}
+
+	put := func(ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/lists/"+userID+"/"+listID, strings.NewReader(`{"Name":"shopping"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", ifMatch)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec = put(tag)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if got := rec.Header().Get("ETag"); got != `"2"` {
+		t.Errorf("got ETag %q want %q", got, `"2"`)
+	}
+
+	for _, ifMatch := range []string{tag, "not-a-version"} {
+		rec = put(ifMatch)
+		if rec.Code != http.StatusPreconditionFailed {
+			t.Errorf("If-Match %s: got status %d want %d", ifMatch, rec.Code, http.StatusPreconditionFailed)
+		}
+	}
+}
+
+func TestFindTodosByTag(t *testing.T) {
+	handler, userID, listID := newTestHandler(t)
+
+	for _, body := range []string{`{"Title":"milk","Tags":["#Dairy"]}`, `{"Title":"bread"}`} {
+		req := httptest.NewRequest(http.MethodPost, "/lists/"+userID+"/"+listID+"/todos", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("got status %d want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/users/"+userID+"/todos?tag=dairy", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var found []store.FoundTodo
+	if err := json.Unmarshal(rec.Body.Bytes(), &found); err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Title != "milk" || found[0].ListName != "groceries" {
+		t.Errorf("got %+v want milk from groceries", found)
+	}
+}
+
+func TestFindTodosByAssignee(t *testing.T) {
+	handler, userID, listID := newTestHandler(t)
+
+	memberID, err := handler.store.CreateUser("Stephen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = handler.store.ShareTodoList(userID, listID, memberID, store.RoleEditor); err != nil {
+		t.Fatal(err)
+	}
+	for _, todo := range []store.Todo{{Title: "milk", AssigneeID: memberID}, {Title: "bread", AssigneeID: userID}} {
+		if _, err = handler.store.AddTodo(todo, listID, userID, userID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	token, _, err := handler.sessions.create(memberID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/users/me/todos?assignee=me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.RequireAuth().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var found []store.FoundTodo
+	if err = json.Unmarshal(rec.Body.Bytes(), &found); err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Title != "milk" || found[0].OwnerID != userID || found[0].ListID != listID {
+		t.Errorf("got %+v want milk from the shared groceries", found)
+	}
+}
+
+func TestAddNestedTodos(t *testing.T) {
+	handler, userID, listID := newTestHandler(t)
+
+	body := `{"Title":"pack","Subtasks":[{"Title":"clothes","Subtasks":[{"Title":"socks"}]},{"Title":"charger"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/lists/"+userID+"/"+listID+"/todos", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("got status %d want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+
+	var created NewTodo
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if len(created.Subtasks) != 2 || len(created.Subtasks[0].Subtasks) != 1 {
+		t.Fatalf("got %+v want the tree that was sent", created)
+	}
+
+	list, err := handler.store.GetTodoList(userID, listID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	socks := list.Todos[created.Subtasks[0].Subtasks[0].ID]
+	if socks == nil || socks.ParentID != created.Subtasks[0].ID {
+		t.Errorf("got socks %+v want it under clothes", socks)
+	}
+	if got := list.Todos[created.Subtasks[0].ID].ParentID; got != created.ID {
+		t.Errorf("got clothes under %q want %q", got, created.ID)
+	}
+}
+
+func TestPatchTodoNotes(t *testing.T) {
+	handler, userID, listID := newTestHandler(t)
+
+	todoID, err := handler.store.AddTodo(store.Todo{Title: "milk"}, listID, userID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := "/lists/" + userID + "/" + listID + "/todos/" + todoID
+
+	req := httptest.NewRequest(http.MethodPatch, path, strings.NewReader(`{"Notes":"# Brands\n\n- oat\n"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var todo store.Todo
+	if err = json.Unmarshal(rec.Body.Bytes(), &todo); err != nil {
+		t.Fatal(err)
+	}
+	if todo.Notes != "# Brands\n\n- oat\n" || todo.Title != "milk" {
+		t.Errorf("got %+v want the notes set and the title kept", todo)
+	}
+}
+
+func TestPatchRecurringTodoCompleted(t *testing.T) {
+	handler, userID, listID := newTestHandler(t)
+
+	due := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	todoID, err := handler.store.AddTodo(store.Todo{Title: "walk", Recurrence: "FREQ=DAILY", Due: &due}, listID, userID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := "/lists/" + userID + "/" + listID + "/todos/" + todoID
+
+	req := httptest.NewRequest(http.MethodPatch, path, strings.NewReader(`{"Title":"walk the dog","Completed":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var todo store.Todo
+	if err = json.Unmarshal(rec.Body.Bytes(), &todo); err != nil {
+		t.Fatal(err)
+	}
+	if next := due.AddDate(0, 0, 1); todo.Completed || todo.Due == nil || !todo.Due.Equal(next) || todo.Title != "walk the dog" {
+		t.Errorf("got %+v want the title changed and the todo open again, due %v", todo, next)
+	}
+
+	history, err := handler.store.TodoHistory(userID, listID, todoID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := history[len(history)-1]; last.Action != store.ActionCompleted {
+		t.Errorf("got last entry %+v want the todo completed", last)
+	}
+}
+
+func TestTodoHistory(t *testing.T) {
+	handler, userID, listID := newTestHandler(t)
+
+	todoID, err := handler.store.AddTodo(store.Todo{Title: "milk"}, listID, userID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = handler.store.ToggleTodo(userID, listID, todoID, userID); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lists/"+userID+"/"+listID+"/todos/"+todoID+"/history", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var history []store.HistoryEntry
+	if err = json.Unmarshal(rec.Body.Bytes(), &history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Action != store.ActionCreated || history[1].Action != store.ActionCompleted {
+		t.Errorf("got %+v want it created then completed", history)
+	}
+}
+
+func TestTrash(t *testing.T) {
+	handler, userID, listID := newTestHandler(t)
+
+	todoID, err := handler.store.AddTodo(store.Todo{Title: "milk"}, listID, userID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/lists/" + userID + "/" + listID + "/todos/" + todoID, "/lists/" + userID + "/" + listID} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("deleting %s: got status %d: %s", path, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/"+userID+"/trash", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var trash store.Trash
+	if err = json.Unmarshal(rec.Body.Bytes(), &trash); err != nil {
+		t.Fatal(err)
+	}
+	if len(trash.Lists) != 1 || len(trash.Todos) != 1 || trash.Todos[0].ID != todoID {
+		t.Fatalf("got %+v want the list and the todo", trash)
+	}
+
+	for _, path := range []string{"/lists/" + userID + "/" + listID + "/restore", "/lists/" + userID + "/" + listID + "/todos/" + todoID + "/restore"} {
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("restoring %s: got status %d: %s", path, rec.Code, rec.Body.String())
+		}
+	}
+
+	list, err := handler.store.GetTodoList(userID, listID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := list.Todos[todoID]; !exists {
+		t.Errorf("got %+v want the todo restored", list.Todos)
+	}
+
+	if err = handler.store.DeleteTodoList(userID, listID); err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/users/"+userID+"/trash", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if trash, err = handler.store.Trash(userID); err != nil || len(trash.Lists) != 0 {
+		t.Errorf("got %+v, %v want an empty trash", trash, err)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	handler, userID, listID := newTestHandler(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"Name":"Stephen"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("got status %d want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	var created store.User
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Name != "Stephen" || rec.Header().Get("Location") != "/users/"+created.ID {
+		t.Errorf("got %+v at %q want Stephen at /users/%s", created, rec.Header().Get("Location"), created.ID)
+	}
+
+	req = httptest.NewRequest(http.MethodPatch, "/users/"+created.ID, strings.NewReader(`{"Name":"Steph"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/users/"+userID, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if _, err := handler.store.GetTodoList(userID, listID); err == nil {
+		t.Error("the deleted user's list is still there")
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users", nil))
+	var users []store.User
+	if err := json.Unmarshal(rec.Body.Bytes(), &users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].ID != created.ID || users[0].Name != "Steph" {
+		t.Errorf("got %+v want only Steph", users)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	handler, userID, _ := newTestHandler(t)
+	auth := handler.RequireAuth()
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		auth.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/users", "", `{"Name":"Stephen","Password":"correct horse"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("signing up: got status %d want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "PasswordHash") {
+		t.Errorf("got %s want the password hash left out", rec.Body.String())
+	}
+
+	rec = do(http.MethodPost, "/auth/login", "", `{"Name":"stephen","Password":"battery staple"}`)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: got status %d want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	rec = do(http.MethodPost, "/auth/login", "", `{"Name":"stephen","Password":"correct horse"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("logging in: got status %d want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var login LoginResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &login); err != nil {
+		t.Fatal(err)
+	}
+
+	rec = do(http.MethodGet, "/lists/me", "", "")
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") != "Bearer" {
+		t.Errorf("no token: got status %d want %d asking for a bearer token", rec.Code, http.StatusUnauthorized)
+	}
+
+	rec = do(http.MethodGet, "/users/me", login.Token, "")
+	var me store.User
+	if err := json.Unmarshal(rec.Body.Bytes(), &me); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || me.ID != login.UserID || me.Name != "Stephen" {
+		t.Errorf("got status %d and %+v want Stephen", rec.Code, me)
+	}
+
+	rec = do(http.MethodPost, "/lists/me", login.Token, `{"Name":"garden"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("creating a list: got status %d want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	if lists, _ := handler.store.GetTodoLists(login.UserID); len(lists) != 1 {
+		t.Errorf("got %d lists want the new one", len(lists))
+	}
+
+	rec = do(http.MethodGet, "/lists/"+userID, login.Token, "")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("another user's lists: got status %d want %d", rec.Code, http.StatusForbidden)
+	}
+
+	now := time.Now()
+	handler.sessions.now = func() time.Time { return now.Add(DefaultSessionTTL) }
+	rec = do(http.MethodGet, "/lists/me", login.Token, "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expired token: got status %d want %d", rec.Code, http.StatusUnauthorized)
+	}
+	handler.sessions.now = time.Now
+
+	rec = do(http.MethodPost, "/auth/login", "", `{"UserID":"`+login.UserID+`","Password":"correct horse"}`)
+	if err := json.Unmarshal(rec.Body.Bytes(), &login); err != nil {
+		t.Fatal(err)
+	}
+	if rec = do(http.MethodPost, "/auth/logout", login.Token, ""); rec.Code != http.StatusOK {
+		t.Fatalf("logging out: got status %d want %d", rec.Code, http.StatusOK)
+	}
+	rec = do(http.MethodGet, "/lists/me", login.Token, "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("logged out: got status %d want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	handler, userID, _ := newTestHandler(t)
+	auth := handler.RequireAuth()
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		auth.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if err := handler.store.SetPassword(userID, "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	var tokens []string
+	for range 2 {
+		token, _, err := handler.sessions.create(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+	}
+	laptop, phone := tokens[0], tokens[1]
+
+	rec := do(http.MethodPatch, "/users/me", laptop, `{"Password":"battery staple"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("without the current password: got status %d want %d", rec.Code, http.StatusForbidden)
+	}
+	rec = do(http.MethodPatch, "/users/me", laptop, `{"Password":"battery staple","CurrentPassword":"wrong horse"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("with a wrong current password: got status %d want %d", rec.Code, http.StatusForbidden)
+	}
+	rec = do(http.MethodPatch, "/users/me", laptop, `{"Name":"Stephen","Password":"battery staple"}`)
+	if user, _ := handler.store.GetUser(userID); rec.Code != http.StatusForbidden || user.Name != "Steve" {
+		t.Errorf("got status %d and name %q want %d and the rename left undone", rec.Code, user.Name, http.StatusForbidden)
+	}
+
+	rec = do(http.MethodPatch, "/users/me", laptop, `{"Password":"battery staple","CurrentPassword":"correct horse"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("changing the password: got status %d want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if rec = do(http.MethodGet, "/lists/me", phone, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("other session after the change: got status %d want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec = do(http.MethodGet, "/lists/me", laptop, ""); rec.Code != http.StatusOK {
+		t.Errorf("session that made the change: got status %d want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	handler, userID, listID := newTestHandler(t)
+	auth := handler.RequireAuth()
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		auth.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if err := handler.store.SetPassword(userID, "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	var login LoginResponse
+	rec := do(http.MethodPost, "/auth/login", "", `{"Name":"Steve","Password":"correct horse"}`)
+	if err := json.Unmarshal(rec.Body.Bytes(), &login); err != nil {
+		t.Fatal(err)
+	}
+
+	createKey := func(body string) CreatedKey {
+		t.Helper()
+		rec := do(http.MethodPost, "/users/me/keys", login.Token, body)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("creating a key: got status %d want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+		}
+		var created CreatedKey
+		if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+			t.Fatal(err)
+		}
+		return created
+	}
+	ci := createKey(`{"Name":"ci"}`)
+	backup := createKey(`{"Name":"backup","Scope":"read"}`)
+
+	rec = do(http.MethodGet, "/lists/me/"+listID, ci.Secret, "")
+	if rec.Code != http.StatusOK {
+		t.Errorf("reading with a key: got status %d want %d", rec.Code, http.StatusOK)
+	}
+	rec = do(http.MethodPost, "/lists/me", ci.Secret, `{"Name":"chores"}`)
+	if rec.Code != http.StatusCreated {
+		t.Errorf("writing with a key: got status %d want %d", rec.Code, http.StatusCreated)
+	}
+
+	rec = do(http.MethodGet, "/lists/me/"+listID, backup.Secret, "")
+	if rec.Code != http.StatusOK {
+		t.Errorf("reading with a read-only key: got status %d want %d", rec.Code, http.StatusOK)
+	}
+	rec = do(http.MethodDelete, "/lists/me/"+listID, backup.Secret, "")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("deleting with a read-only key: got status %d want %d", rec.Code, http.StatusForbidden)
+	}
+
+	rec = do(http.MethodPost, "/users/me/keys", ci.Secret, `{"Name":"more"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("creating a key with a key: got status %d want %d", rec.Code, http.StatusForbidden)
+	}
+	rec = do(http.MethodPatch, "/users/me", ci.Secret, `{"Password":"stolen horse"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("changing the password with a key: got status %d want %d", rec.Code, http.StatusForbidden)
+	}
+	if err := handler.store.CheckPassword(userID, "correct horse"); err != nil {
+		t.Errorf("the password changed after a key was refused: %v", err)
+	}
+	rec = do(http.MethodPatch, "/users/me", ci.Secret, `{"Name":"Mallory"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("renaming with a key: got status %d want %d", rec.Code, http.StatusForbidden)
+	}
+	rec = do(http.MethodDelete, "/users/me", ci.Secret, "")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("deleting the user with a key: got status %d want %d", rec.Code, http.StatusForbidden)
+	}
+	rec = do(http.MethodGet, "/users/me", ci.Secret, "")
+	if rec.Code != http.StatusOK {
+		t.Errorf("reading the user with a key: got status %d want %d", rec.Code, http.StatusOK)
+	}
+
+	rec = do(http.MethodGet, "/auth/key", backup.Secret, "")
+	var current store.APIKey
+	if err := json.Unmarshal(rec.Body.Bytes(), &current); err != nil {
+		t.Fatal(err)
+	}
+	if current.ID != backup.Key.ID || current.Scope != store.ScopeRead || len(current.Hash) != 0 {
+		t.Errorf("got %+v want the backup key without its hash", current)
+	}
+
+	rec = do(http.MethodGet, "/users/me/keys", login.Token, "")
+	if strings.Contains(rec.Body.String(), ci.Secret) || strings.Contains(rec.Body.String(), "Hash") {
+		t.Errorf("got %s want neither secrets nor hashes", rec.Body.String())
+	}
+
+	if rec = do(http.MethodDelete, "/users/me/keys/"+ci.Key.ID, login.Token, ""); rec.Code != http.StatusOK {
+		t.Fatalf("revoking: got status %d want %d", rec.Code, http.StatusOK)
+	}
+	rec = do(http.MethodGet, "/lists/me", ci.Secret, "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("revoked key: got status %d want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestSharing(t *testing.T) {
+	handler, userID, listID := newTestHandler(t)
+	auth := handler.RequireAuth()
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		auth.ServeHTTP(rec, req)
+		return rec
+	}
+	logIn := func(name string) (string, string) {
+		t.Helper()
+		id, err := handler.store.CreateUser(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, _, err := handler.sessions.create(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id, token
+	}
+
+	owner, _, err := handler.sessions.create(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	editorID, editor := logIn("Stephen")
+	viewerID, viewer := logIn("Stella")
+	_, stranger := logIn("Stan")
+
+	list := "/lists/" + userID + "/" + listID
+	for memberID, role := range map[string]string{editorID: "editor", viewerID: "viewer"} {
+		if rec := do(http.MethodPut, list+"/members/"+memberID, owner, `{"Role":"`+role+`"}`); rec.Code != http.StatusOK {
+			t.Fatalf("sharing as %s: got status %d want %d: %s", role, rec.Code, http.StatusOK, rec.Body.String())
+		}
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		status int
+	}{
+		{"viewer reads the list", http.MethodGet, list, viewer, "", http.StatusOK},
+		{"viewer reads the members", http.MethodGet, list + "/members", viewer, "", http.StatusOK},
+		{"viewer adds a todo", http.MethodPost, list + "/todos", viewer, `{"Title":"milk"}`, http.StatusForbidden},
+		{"editor adds a todo", http.MethodPost, list + "/todos", editor, `{"Title":"milk"}`, http.StatusCreated},
+		{"editor renames the list", http.MethodPut, list, editor, `{"Name":"shopping"}`, http.StatusOK},
+		{"editor deletes the list", http.MethodDelete, list, editor, "", http.StatusForbidden},
+		{"editor shares the list", http.MethodPut, list + "/members/" + viewerID, editor, `{"Role":"editor"}`, http.StatusForbidden},
+		{"editor lists the owner's lists", http.MethodGet, "/lists/" + userID, editor, "", http.StatusForbidden},
+		{"editor reads the owner's account", http.MethodGet, "/users/" + userID, editor, "", http.StatusForbidden},
+		{"stranger reads the list", http.MethodGet, list, stranger, "", http.StatusForbidden},
+		{"stranger reads a missing list", http.MethodGet, "/lists/" + userID + "/9", stranger, "", http.StatusForbidden},
+		{"viewer leaves", http.MethodDelete, list + "/members/" + viewerID, viewer, "", http.StatusOK},
+		{"former viewer reads the list", http.MethodGet, list, viewer, "", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		if rec := do(tt.method, tt.path, tt.token, tt.body); rec.Code != tt.status {
+			t.Errorf("%s: got status %d want %d: %s", tt.name, rec.Code, tt.status, rec.Body.String())
+		}
+	}
+
+	var members []Member
+	rec := do(http.MethodGet, list+"/members", owner, "")
+	if err = json.Unmarshal(rec.Body.Bytes(), &members); err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 || members[0].UserID != userID || members[0].Role != store.RoleOwner ||
+		members[1].Name != "Stephen" || members[1].Role != store.RoleEditor {
+		t.Errorf("got %+v want the owner then Stephen as editor", members)
+	}
+
+	var shared []store.SharedList
+	rec = do(http.MethodGet, "/users/me/shared", editor, "")
+	if err = json.Unmarshal(rec.Body.Bytes(), &shared); err != nil {
+		t.Fatal(err)
+	}
+	if len(shared) != 1 || shared[0].ID != listID || shared[0].OwnerID != userID || shared[0].Name != "shopping" {
+		t.Errorf("got %+v want the renamed list shared by %s", shared, userID)
+	}
+
+	todoID, err := handler.store.AddTodo(store.Todo{Title: "bread"}, listID, userID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec = do(http.MethodPost, list+"/todos/"+todoID+"/toggle", editor, ""); rec.Code != http.StatusOK {
+		t.Fatalf("editor toggles a todo: got status %d want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var history []store.HistoryEntry
+	rec = do(http.MethodGet, list+"/todos/"+todoID+"/history", owner, "")
+	if err = json.Unmarshal(rec.Body.Bytes(), &history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].UserID != userID || history[1].UserID != editorID {
+		t.Errorf("got history %+v want the owner adding the todo and the editor completing it", history)
+	}
+}
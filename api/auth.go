@@ -0,0 +1,289 @@
+package api
+
+import (
+	"ToDo/store"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSessionTTL is how long a token from Login lasts.
+const DefaultSessionTTL = 24 * time.Hour
+
+var (
+	LoginRe  = regexp.MustCompile(`^/auth/login$`)
+	LogoutRe = regexp.MustCompile(`^/auth/logout$`)
+	// pathUserRe finds the user a request is about in its URL.
+	pathUserRe = regexp.MustCompile(`^/(lists|users)/([^/]+)`)
+)
+
+// Sessions holds the bearer tokens handed out by Login. They are only kept in
+// memory, restarting the server logs everyone out.
+type Sessions struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	now    func() time.Time
+	tokens map[string]session
+}
+
+type session struct {
+	userID  string
+	expires time.Time
+}
+
+func NewSessions(ttl time.Duration) *Sessions {
+	return &Sessions{
+		ttl:    ttl,
+		now:    time.Now,
+		tokens: make(map[string]session),
+	}
+}
+
+func (s *Sessions) create(userID string) (string, time.Time, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expires := s.now().Add(s.ttl)
+	s.tokens[token] = session{userID: userID, expires: expires}
+	return token, expires, nil
+}
+
+// user returns the user token was handed out to, dropping it once expired.
+func (s *Sessions) user(token string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.tokens[token]
+	if !exists {
+		return "", false
+	}
+	if !s.now().Before(session.expires) {
+		delete(s.tokens, token)
+		return "", false
+	}
+	return session.userID, true
+}
+
+func (s *Sessions) revoke(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.tokens, token)
+}
+
+// revokeUser drops every token of the user but keep, as when they are
+// deleted or change their password.
+func (s *Sessions) revokeUser(userID string, keep string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for token, session := range s.tokens {
+		if session.userID == userID && token != keep {
+			delete(s.tokens, token)
+		}
+	}
+}
+
+// checkKey returns the user an API key acts for when it may make the
+// request. Keys can't manage keys or the account, so a leaked one can't be
+// used to mint more, change the password or delete the user, and read-only
+// keys can only look.
+func (h *ListHandler) checkKey(w http.ResponseWriter, r *http.Request, secret string) (string, bool) {
+	key, err := h.store.CheckAPIKey(secret)
+	if err != nil {
+		log.Println("Auth - ", err)
+		if errors.Is(err, store.ErrUnauthorized) {
+			UnauthorizedHandler(w, r, "the API key is unknown, revoked or expired")
+			return "", false
+		}
+		StoreErrorHandler(w, r, err)
+		return "", false
+	}
+
+	switch {
+	case UserKeysRe.MatchString(r.URL.Path) || UserKeyRe.MatchString(r.URL.Path):
+		ForbiddenHandler(w, r, "API keys can only be managed when logged in")
+		return "", false
+	case UserRe.MatchString(r.URL.Path) && !isRead(r):
+		ForbiddenHandler(w, r, "the account can only be changed when logged in")
+		return "", false
+	case key.Scope == store.ScopeRead && !isRead(r):
+		ForbiddenHandler(w, r, "the API key is read-only")
+		return "", false
+	}
+	return key.UserID, true
+}
+
+type authUserKey struct{}
+
+// authUser returns the user RequireAuth let the request through for, false
+// when it didn't go through RequireAuth.
+func authUser(r *http.Request) (string, bool) {
+	userID, ok := r.Context().Value(authUserKey{}).(string)
+	return userID, ok
+}
+
+// actor returns who is making a change to the list of ownerID, the user
+// RequireAuth let the request through for or the owner when it didn't go
+// through RequireAuth.
+func actor(r *http.Request, ownerID string) string {
+	if userID, ok := authUser(r); ok {
+		return userID
+	}
+	return ownerID
+}
+
+// isRead reports whether the request only looks.
+func isRead(r *http.Request) bool {
+	return r.Method == http.MethodGet || r.Method == http.MethodHead
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token, found && token != ""
+}
+
+// LoginRequest is the body of a login. The user is picked by UserID when it
+// is set and by Name otherwise.
+type LoginRequest struct {
+	UserID   string `json:",omitempty"`
+	Name     string `json:",omitempty"`
+	Password string
+}
+
+// LoginResponse carries the token to send as "Authorization: Bearer <token>"
+// until ExpiresAt.
+type LoginResponse struct {
+	Token     string
+	UserID    string
+	ExpiresAt time.Time
+}
+
+func (h *ListHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if !isJSON(r) {
+		log.Println("Login - Unsupported content type ", r.Header.Get("Content-Type"))
+		UnsupportedMediaTypeHandler(w, r)
+		return
+	}
+
+	var login LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&login); err != nil {
+		log.Println("Login - Error Decoding ", err)
+		BadRequestHandler(w, r, "malformed login: "+err.Error())
+		return
+	}
+
+	userID, err := h.authenticate(login)
+	if err != nil {
+		log.Println("Login - ", err)
+		if errors.Is(err, store.ErrUserNotFound) || errors.Is(err, store.ErrUnauthorized) {
+			UnauthorizedHandler(w, r, "wrong name or password")
+			return
+		}
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	token, expires, err := h.sessions.create(userID)
+	if err != nil {
+		log.Println("Login - ", err)
+		InternalServerErrorHandler(w, r)
+		return
+	}
+
+	log.Println("Login - Success")
+	writeJSON(w, http.StatusOK, LoginResponse{Token: token, UserID: userID, ExpiresAt: expires})
+}
+
+// authenticate returns the ID of the user login is for when the password is
+// right. Names aren't unique for users created before they had to be, so
+// every user with the name is tried.
+func (h *ListHandler) authenticate(login LoginRequest) (string, error) {
+	if login.UserID != "" {
+		return login.UserID, h.store.CheckPassword(login.UserID, login.Password)
+	}
+
+	users, err := h.store.GetUsers()
+	if err != nil {
+		return "", err
+	}
+
+	err = store.ErrUnauthorized
+	for _, user := range users {
+		if !strings.EqualFold(user.Name, login.Name) {
+			continue
+		}
+		if err = h.store.CheckPassword(user.ID, login.Password); err == nil {
+			return user.ID, nil
+		}
+	}
+	return "", err
+}
+
+func (h *ListHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if token, ok := bearerToken(r); ok {
+		h.sessions.revoke(token)
+	}
+
+	log.Println("Logout - Success")
+	w.WriteHeader(http.StatusOK)
+}
+
+// RequireAuth serves h to requests carrying a token from Login or an API
+// key, anything else but logging in and signing up is refused. The user in
+// the URL comes from the token: "me" stands for the token's user, and the
+// lists of other users are only reachable as far as the token's user's role
+// on them goes.
+func (h *ListHandler) RequireAuth() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if LoginRe.MatchString(r.URL.Path) || (r.Method == http.MethodPost && UsersRe.MatchString(r.URL.Path)) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := bearerToken(r)
+		if !ok {
+			UnauthorizedHandler(w, r, "log in at /auth/login and send the token, or an API key, as a bearer token")
+			return
+		}
+
+		var userID string
+		if strings.HasPrefix(token, store.APIKeyPrefix) {
+			if userID, ok = h.checkKey(w, r, token); !ok {
+				return
+			}
+		} else if userID, ok = h.sessions.user(token); !ok {
+			UnauthorizedHandler(w, r, "the token is unknown or has expired, log in again")
+			return
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), authUserKey{}, userID))
+		if matches := pathUserRe.FindStringSubmatch(r.URL.Path); matches != nil {
+			switch matches[2] {
+			case "me":
+				r.URL.Path = "/" + matches[1] + "/" + userID + strings.TrimPrefix(r.URL.Path, matches[0])
+			case userID:
+			default:
+				if !h.allowMember(w, r, matches[2], userID) {
+					return
+				}
+			}
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"ToDo/store"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func WriteError(w http.ResponseWriter, status int, code string, message string) {
+	byteValue, err := json.Marshal(ErrorResponse{
+		Error: ErrorDetail{Code: code, Message: message},
+	})
+	if err != nil {
+		http.Error(w, message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(byteValue)
+}
+
+func BadRequestHandler(w http.ResponseWriter, r *http.Request, message string) {
+	WriteError(w, http.StatusBadRequest, "bad_request", message)
+}
+
+// UnauthorizedHandler asks for a bearer token from /auth/login.
+func UnauthorizedHandler(w http.ResponseWriter, r *http.Request, message string) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	WriteError(w, http.StatusUnauthorized, "unauthorized", message)
+}
+
+func ForbiddenHandler(w http.ResponseWriter, r *http.Request, message string) {
+	WriteError(w, http.StatusForbidden, "forbidden", message)
+}
+
+func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, http.StatusNotFound, "not_found", "no route for "+r.URL.Path)
+}
+
+func MethodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, http.StatusMethodNotAllowed, "method_not_allowed", r.Method+" is not allowed on "+r.URL.Path)
+}
+
+func UnsupportedMediaTypeHandler(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", "request body must be application/json")
+}
+
+func PreconditionFailedHandler(w http.ResponseWriter, r *http.Request, message string) {
+	WriteError(w, http.StatusPreconditionFailed, "precondition_failed", message)
+}
+
+func InternalServerErrorHandler(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, http.StatusInternalServerError, "internal", "500 Internal Server Error")
+}
+
+func StoreErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	code := store.ErrorCode(err)
+
+	switch {
+	case errors.Is(err, store.ErrUserNotFound),
+		errors.Is(err, store.ErrListNotFound),
+		errors.Is(err, store.ErrTodoNotFound),
+		errors.Is(err, store.ErrKeyNotFound),
+		errors.Is(err, store.ErrMemberNotFound):
+		WriteError(w, http.StatusNotFound, code, err.Error())
+	case errors.Is(err, store.ErrInvalidTodo), errors.Is(err, store.ErrInvalidUser),
+		errors.Is(err, store.ErrInvalidKey), errors.Is(err, store.ErrInvalidMember):
+		WriteError(w, http.StatusBadRequest, code, err.Error())
+	case errors.Is(err, store.ErrUnauthorized):
+		UnauthorizedHandler(w, r, err.Error())
+	case errors.Is(err, store.ErrConflict) && r.Header.Get("If-Match") != "":
+		PreconditionFailedHandler(w, r, err.Error())
+	case errors.Is(err, store.ErrConflict):
+		WriteError(w, http.StatusConflict, code, err.Error())
+	default:
+		InternalServerErrorHandler(w, r)
+	}
+}
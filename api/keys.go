@@ -0,0 +1,130 @@
+package api
+
+import (
+	"ToDo/store"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+var (
+	UserKeysRe   = regexp.MustCompile(`^/users/([^/]+)/keys$`)
+	UserKeyRe    = regexp.MustCompile(`^/users/([^/]+)/keys/([^/]+)$`)
+	CurrentKeyRe = regexp.MustCompile(`^/auth/key$`)
+)
+
+// KeyRequest is the body of a request creating an API key. Scope defaults
+// to store.ScopeWrite and a nil ExpiresAt makes a key that never expires.
+type KeyRequest struct {
+	Name      string
+	Scope     store.Scope `json:",omitempty"`
+	ExpiresAt *time.Time  `json:",omitempty"`
+}
+
+// CreatedKey is the response to creating an API key, the only one carrying
+// its secret.
+type CreatedKey struct {
+	Key    store.APIKey
+	Secret string
+}
+
+func (h *ListHandler) CreateKey(w http.ResponseWriter, r *http.Request) {
+	matches := UserKeysRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 2 {
+		log.Println("Create Key - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	if !isJSON(r) {
+		log.Println("Create Key - Unsupported content type ", r.Header.Get("Content-Type"))
+		UnsupportedMediaTypeHandler(w, r)
+		return
+	}
+
+	var request KeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Println("Create Key - Error Decoding ", err)
+		BadRequestHandler(w, r, "malformed API key: "+err.Error())
+		return
+	}
+	if request.Name == "" {
+		log.Println("Create Key - Missing name")
+		BadRequestHandler(w, r, "an API key needs a name")
+		return
+	}
+
+	key, secret, err := h.store.CreateAPIKey(matches[1], store.APIKey{Name: request.Name, Scope: request.Scope, ExpiresAt: request.ExpiresAt})
+	if err != nil {
+		log.Println("Create Key - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Create Key - Success")
+	w.Header().Set("Location", "/users/"+matches[1]+"/keys/"+key.ID)
+	writeJSON(w, http.StatusCreated, CreatedKey{Key: key, Secret: secret})
+}
+
+func (h *ListHandler) GetKeys(w http.ResponseWriter, r *http.Request) {
+	matches := UserKeysRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 2 {
+		log.Println("Get Keys - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	keys, err := h.store.GetAPIKeys(matches[1])
+	if err != nil {
+		log.Println("Get Keys - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Get Keys - Success")
+	writeJSON(w, http.StatusOK, keys)
+}
+
+func (h *ListHandler) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	matches := UserKeyRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 3 {
+		log.Println("Revoke Key - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	if err := h.store.RevokeAPIKey(matches[1], matches[2]); err != nil {
+		log.Println("Revoke Key - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Revoke Key - Success")
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetCurrentKey responds with the API key the request is made with, so a
+// script can tell whose key it holds and when it expires.
+func (h *ListHandler) GetCurrentKey(w http.ResponseWriter, r *http.Request) {
+	token, ok := bearerToken(r)
+	if !ok {
+		log.Println("Get Current Key - No key")
+		UnauthorizedHandler(w, r, "send an API key as a bearer token")
+		return
+	}
+
+	key, err := h.store.CheckAPIKey(token)
+	if err != nil {
+		log.Println("Get Current Key - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Get Current Key - Success")
+	writeJSON(w, http.StatusOK, key)
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"ToDo/store"
+	"cmp"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+)
+
+var (
+	ListMembersRe = regexp.MustCompile(`^/lists/([^/]+)/([^/]+)/members$`)
+	ListMemberRe  = regexp.MustCompile(`^/lists/([^/]+)/([^/]+)/members/([^/]+)$`)
+	UserSharedRe  = regexp.MustCompile(`^/users/([^/]+)/shared$`)
+	// listPathRe finds the list a request is about in its URL.
+	listPathRe = regexp.MustCompile(`^/lists/([^/]+)/([^/]+)`)
+)
+
+// Member is someone with access to a list, its owner included.
+type Member struct {
+	UserID string
+	Name   string
+	Role   store.Role
+}
+
+// MemberRequest is the body of a request sharing a list.
+type MemberRequest struct {
+	Role store.Role
+}
+
+// requiredRole is the least role on a list the request needs. Managing the
+// members is left to the owner, though any member may leave.
+func requiredRole(r *http.Request, userID string) store.Role {
+	path := r.URL.Path
+	read := r.Method == http.MethodGet || r.Method == http.MethodHead
+
+	switch {
+	case ListMemberRe.MatchString(path):
+		if r.Method == http.MethodDelete && ListMemberRe.FindStringSubmatch(path)[3] == userID {
+			return store.RoleViewer
+		}
+		return store.RoleOwner
+	case ListMembersRe.MatchString(path), TodoHistoryRe.MatchString(path):
+		return store.RoleViewer
+	case ListReWithID.MatchString(path):
+		switch {
+		case read:
+			return store.RoleViewer
+		case r.Method == http.MethodPut:
+			return store.RoleEditor
+		}
+		return store.RoleOwner
+	case TodosRe.MatchString(path), TodoRe.MatchString(path), TodoToggleRe.MatchString(path),
+		TodoMoveRe.MatchString(path), TodoRestoreRe.MatchString(path):
+		if read {
+			return store.RoleViewer
+		}
+		return store.RoleEditor
+	}
+	return store.RoleOwner
+}
+
+// allowMember reports whether userID's role on the list of ownerID the
+// request is about lets them make it, writing a 403 when it doesn't. Lists
+// that don't exist are forbidden too rather than telling whether they do.
+func (h *ListHandler) allowMember(w http.ResponseWriter, r *http.Request, ownerID string, userID string) bool {
+	matches := listPathRe.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		log.Println("Auth - user ", userID, " asked for ", r.URL.Path)
+		ForbiddenHandler(w, r, "only your own account is reachable")
+		return false
+	}
+
+	list, err := h.store.GetTodoList(ownerID, matches[2])
+	if err == nil && list.RoleOf(ownerID, userID).Allows(requiredRole(r, userID)) {
+		return true
+	}
+
+	log.Println("Auth - user ", userID, " may not ", r.Method, " ", r.URL.Path)
+	ForbiddenHandler(w, r, "the list isn't shared with you, or not enough to do that")
+	return false
+}
+
+func (h *ListHandler) GetMembers(w http.ResponseWriter, r *http.Request) {
+	matches := ListMembersRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 3 {
+		log.Println("Get Members - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	members, err := h.members(matches[1], matches[2])
+	if err != nil {
+		log.Println("Get Members - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Get Members - Success")
+	writeJSON(w, http.StatusOK, members)
+}
+
+// members lists the owner of the list first, then its members by name.
+func (h *ListHandler) members(userID string, listID string) ([]Member, error) {
+	list, err := h.store.GetTodoList(userID, listID)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := h.store.GetUsers()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(users))
+	for _, user := range users {
+		names[user.ID] = user.Name
+	}
+
+	members := make([]Member, 0, len(list.Members))
+	for memberID, role := range list.Members {
+		members = append(members, Member{UserID: memberID, Name: names[memberID], Role: role})
+	}
+	slices.SortFunc(members, func(a, b Member) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.UserID, b.UserID))
+	})
+
+	return append([]Member{{UserID: userID, Name: names[userID], Role: store.RoleOwner}}, members...), nil
+}
+
+// ShareList adds the user in the URL to the list's members, or changes
+// their role when they already are one, and responds with the members.
+func (h *ListHandler) ShareList(w http.ResponseWriter, r *http.Request) {
+	matches := ListMemberRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 4 {
+		log.Println("Share List - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	if !isJSON(r) {
+		log.Println("Share List - Unsupported content type ", r.Header.Get("Content-Type"))
+		UnsupportedMediaTypeHandler(w, r)
+		return
+	}
+
+	var request MemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Println("Share List - Error Decoding ", err)
+		BadRequestHandler(w, r, "malformed member: "+err.Error())
+		return
+	}
+
+	if err := h.store.ShareTodoList(matches[1], matches[2], matches[3], request.Role); err != nil {
+		log.Println("Share List - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	members, err := h.members(matches[1], matches[2])
+	if err != nil {
+		log.Println("Share List - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Share List - Success")
+	writeJSON(w, http.StatusOK, members)
+}
+
+func (h *ListHandler) UnshareList(w http.ResponseWriter, r *http.Request) {
+	matches := ListMemberRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 4 {
+		log.Println("Unshare List - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	if err := h.store.UnshareTodoList(matches[1], matches[2], matches[3]); err != nil {
+		log.Println("Unshare List - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Unshare List - Success")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *ListHandler) GetShared(w http.ResponseWriter, r *http.Request) {
+	matches := UserSharedRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 2 {
+		log.Println("Get Shared - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	shared, err := h.store.SharedTodoLists(matches[1])
+	if err != nil {
+		log.Println("Get Shared - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Get Shared - Success")
+	writeJSON(w, http.StatusOK, shared)
+}
@@ -0,0 +1,344 @@
+package api
+
+import (
+	"ToDo/store"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+var (
+	TodosRe       = regexp.MustCompile(`^/lists/([^/]+)/([^/]+)/todos$`)
+	TodoRe        = regexp.MustCompile(`^/lists/([^/]+)/([^/]+)/todos/([^/]+)$`)
+	TodoToggleRe  = regexp.MustCompile(`^/lists/([^/]+)/([^/]+)/todos/([^/]+)/toggle$`)
+	TodoMoveRe    = regexp.MustCompile(`^/lists/([^/]+)/([^/]+)/todos/([^/]+)/move$`)
+	TodoHistoryRe = regexp.MustCompile(`^/lists/([^/]+)/([^/]+)/todos/([^/]+)/history$`)
+)
+
+// TodoPatch holds the fields a PATCH may change, unset fields are left alone.
+type TodoPatch struct {
+	Title      *string
+	Notes      *string
+	Completed  *bool
+	Priority   *store.Priority
+	Tags       Optional[[]string]
+	Recurrence *string
+	TimeZone   *string
+	AssigneeID *string
+	Start      Optional[*time.Time]
+	Due        Optional[*time.Time]
+}
+
+func (p TodoPatch) apply(todo *store.Todo) {
+	if p.Title != nil {
+		todo.Title = *p.Title
+	}
+	if p.Notes != nil {
+		todo.Notes = *p.Notes
+	}
+	if p.Completed != nil {
+		todo.Completed = *p.Completed
+	}
+	if p.Priority != nil {
+		todo.Priority = *p.Priority
+	}
+	if p.Recurrence != nil {
+		todo.Recurrence = *p.Recurrence
+	}
+	if p.TimeZone != nil {
+		todo.TimeZone = *p.TimeZone
+	}
+	if p.AssigneeID != nil {
+		todo.AssigneeID = *p.AssigneeID
+	}
+	if p.Tags.Set {
+		todo.Tags = store.NormalizeTags(p.Tags.Value)
+	}
+	if p.Start.Set {
+		todo.Start = p.Start.Value
+	}
+	if p.Due.Set {
+		todo.Due = p.Due.Value
+	}
+}
+
+// Optional tells a missing field apart from an explicit null, which clears
+// the field.
+type Optional[T any] struct {
+	Set   bool
+	Value T
+}
+
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	return json.Unmarshal(data, &o.Value)
+}
+
+func (h *ListHandler) getTodo(userID string, listID string, todoID string) (store.Todo, error) {
+	list, err := h.store.GetTodoList(userID, listID)
+	if err != nil {
+		return store.Todo{}, err
+	}
+
+	todo, exists := list.Todos[todoID]
+	if !exists {
+		return store.Todo{}, store.TodoNotFound(userID, listID, todoID)
+	}
+
+	return *todo, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	byteValue, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.Println("Marshal Error ", err)
+		WriteError(w, http.StatusInternalServerError, "internal", "500 Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(byteValue)
+}
+
+func (h *ListHandler) AddTodo(w http.ResponseWriter, r *http.Request) {
+	matches := TodosRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 3 {
+		log.Println("Add Todo - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	if !isJSON(r) {
+		log.Println("Add Todo - Unsupported content type ", r.Header.Get("Content-Type"))
+		UnsupportedMediaTypeHandler(w, r)
+		return
+	}
+
+	var todo NewTodo
+	if err := json.NewDecoder(r.Body).Decode(&todo); err != nil {
+		log.Println("Add Todo - Error Decoding ", err)
+		BadRequestHandler(w, r, "malformed todo: "+err.Error())
+		return
+	}
+
+	if err := h.addTodo(&todo, matches[2], matches[1], actor(r, matches[1])); err != nil {
+		log.Println("Add Todo - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Add Todo - Success")
+	writeJSON(w, http.StatusCreated, todo)
+}
+
+// NewTodo is the body of a request adding a todo, any subtasks nested in it
+// are added beneath it.
+type NewTodo struct {
+	store.Todo
+	Subtasks []NewTodo `json:",omitempty"`
+}
+
+// addTodo adds todo and then its subtasks for actorID, filling them in as the
+// store keeps them. Subtasks added before an error are kept.
+func (h *ListHandler) addTodo(todo *NewTodo, listID string, userID string, actorID string) error {
+	todo.Tags = store.NormalizeTags(todo.Tags)
+
+	todoID, err := h.store.AddTodo(todo.Todo, listID, userID, actorID)
+	if err != nil {
+		return err
+	}
+	if todo.Todo, err = h.getTodo(userID, listID, todoID); err != nil {
+		return err
+	}
+
+	for i := range todo.Subtasks {
+		todo.Subtasks[i].ParentID = todoID
+		if err = h.addTodo(&todo.Subtasks[i], listID, userID, actorID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *ListHandler) GetTodo(w http.ResponseWriter, r *http.Request) {
+	matches := TodoRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 4 {
+		log.Println("Get Todo - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	todo, err := h.getTodo(matches[1], matches[2], matches[3])
+	if err != nil {
+		log.Println("Get Todo - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Get Todo - Success")
+	writeJSON(w, http.StatusOK, todo)
+}
+
+func (h *ListHandler) UpdateTodo(w http.ResponseWriter, r *http.Request) {
+	matches := TodoRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 4 {
+		log.Println("Update Todo - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	if !isJSON(r) {
+		log.Println("Update Todo - Unsupported content type ", r.Header.Get("Content-Type"))
+		UnsupportedMediaTypeHandler(w, r)
+		return
+	}
+
+	var patch TodoPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		log.Println("Update Todo - Error Decoding ", err)
+		BadRequestHandler(w, r, "malformed todo: "+err.Error())
+		return
+	}
+
+	todo, err := h.getTodo(matches[1], matches[2], matches[3])
+	if err != nil {
+		log.Println("Update Todo - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	completed := todo.Completed
+	patch.apply(&todo)
+
+	// Completing a recurring todo moves it on to its next occurrence, which
+	// is up to ToggleTodo once the rest of the patch is stored.
+	toggle := todo.Recurrence != "" && todo.Completed != completed
+	if toggle {
+		todo.Completed = completed
+	}
+
+	if err = h.store.UpdateTodo(todo, matches[2], matches[1], actor(r, matches[1])); err != nil {
+		log.Println("Update Todo - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+	if toggle {
+		if err = h.store.ToggleTodo(matches[1], matches[2], matches[3], actor(r, matches[1])); err != nil {
+			log.Println("Update Todo - ", err)
+			StoreErrorHandler(w, r, err)
+			return
+		}
+	}
+
+	// Read it back for the timestamps the store keeps.
+	if todo, err = h.getTodo(matches[1], matches[2], matches[3]); err != nil {
+		log.Println("Update Todo - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Update Todo - Success")
+	writeJSON(w, http.StatusOK, todo)
+}
+
+func (h *ListHandler) DeleteTodo(w http.ResponseWriter, r *http.Request) {
+	matches := TodoRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 4 {
+		log.Println("Delete Todo - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	if err := h.store.DeleteTodo(matches[1], matches[2], matches[3], actor(r, matches[1])); err != nil {
+		log.Println("Delete Todo - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Delete Todo - Success")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *ListHandler) ToggleTodo(w http.ResponseWriter, r *http.Request) {
+	matches := TodoToggleRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 4 {
+		log.Println("Toggle Todo - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	if err := h.store.ToggleTodo(matches[1], matches[2], matches[3], actor(r, matches[1])); err != nil {
+		log.Println("Toggle Todo - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	todo, err := h.getTodo(matches[1], matches[2], matches[3])
+	if err != nil {
+		log.Println("Toggle Todo - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Toggle Todo - Success")
+	writeJSON(w, http.StatusOK, todo)
+}
+
+func (h *ListHandler) MoveTodo(w http.ResponseWriter, r *http.Request) {
+	matches := TodoMoveRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 4 {
+		log.Println("Move Todo - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	move, ok := decodeMove(w, r, "Move Todo")
+	if !ok {
+		return
+	}
+
+	if err := h.store.MoveTodo(matches[1], matches[2], matches[3], move.By, actor(r, matches[1])); err != nil {
+		log.Println("Move Todo - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	todo, err := h.getTodo(matches[1], matches[2], matches[3])
+	if err != nil {
+		log.Println("Move Todo - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Move Todo - Success")
+	writeJSON(w, http.StatusOK, todo)
+}
+
+func (h *ListHandler) TodoHistory(w http.ResponseWriter, r *http.Request) {
+	matches := TodoHistoryRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 4 {
+		log.Println("Todo History - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	entries, err := h.store.TodoHistory(matches[1], matches[2], matches[3])
+	if err != nil {
+		log.Println("Todo History - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Todo History - Success")
+	writeJSON(w, http.StatusOK, entries)
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+var (
+	UserTrashRe   = regexp.MustCompile(`^/users/([^/]+)/trash$`)
+	ListRestoreRe = regexp.MustCompile(`^/lists/([^/]+)/([^/]+)/restore$`)
+	TodoRestoreRe = regexp.MustCompile(`^/lists/([^/]+)/([^/]+)/todos/([^/]+)/restore$`)
+)
+
+func (h *ListHandler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	matches := UserTrashRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 2 {
+		log.Println("Get Trash - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	trash, err := h.store.Trash(matches[1])
+	if err != nil {
+		log.Println("Get Trash - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Get Trash - Success")
+	writeJSON(w, http.StatusOK, trash)
+}
+
+// PurgeTrash empties the trash for good, or only of what was deleted at or
+// before the before query parameter when it is given.
+func (h *ListHandler) PurgeTrash(w http.ResponseWriter, r *http.Request) {
+	matches := UserTrashRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 2 {
+		log.Println("Purge Trash - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	before := time.Now()
+	if value := r.URL.Query().Get("before"); value != "" {
+		var err error
+		if before, err = time.Parse(time.RFC3339Nano, value); err != nil {
+			log.Println("Purge Trash - Bad before ", value)
+			BadRequestHandler(w, r, "before "+value+" is not an RFC 3339 time")
+			return
+		}
+	}
+
+	if err := h.store.PurgeTrash(matches[1], before); err != nil {
+		log.Println("Purge Trash - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Purge Trash - Success")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *ListHandler) RestoreList(w http.ResponseWriter, r *http.Request) {
+	matches := ListRestoreRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 3 {
+		log.Println("Restore List - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	if err := h.store.RestoreTodoList(matches[1], matches[2]); err != nil {
+		log.Println("Restore List - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	list, err := h.store.GetTodoList(matches[1], matches[2])
+	if err != nil {
+		log.Println("Restore List - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Restore List - Success")
+	w.Header().Set("ETag", etag(list.Version))
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (h *ListHandler) RestoreTodo(w http.ResponseWriter, r *http.Request) {
+	matches := TodoRestoreRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 4 {
+		log.Println("Restore Todo - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	if err := h.store.RestoreTodo(matches[1], matches[2], matches[3], actor(r, matches[1])); err != nil {
+		log.Println("Restore Todo - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	todo, err := h.getTodo(matches[1], matches[2], matches[3])
+	if err != nil {
+		log.Println("Restore Todo - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Restore Todo - Success")
+	writeJSON(w, http.StatusOK, todo)
+}
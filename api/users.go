@@ -0,0 +1,259 @@
+package api
+
+import (
+	"ToDo/store"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+)
+
+var (
+	UsersRe     = regexp.MustCompile(`^/users$`)
+	UserRe      = regexp.MustCompile(`^/users/([^/]+)$`)
+	UserTodosRe = regexp.MustCompile(`^/users/([^/]+)/todos$`)
+)
+
+// UserPatch is the body of a request creating or changing a user. The
+// password is only ever sent, users come back without it. Changing a
+// password that is set takes the current one as well when the request is
+// made logged in.
+type UserPatch struct {
+	Name            *string
+	Password        *string `json:",omitempty"`
+	CurrentPassword *string `json:",omitempty"`
+}
+
+// publicUser strips the user's password hash and API keys before it is sent
+// out, the keys are listed on their own.
+func publicUser(user store.User) store.User {
+	user.PasswordHash = nil
+	user.APIKeys = nil
+	return user
+}
+
+// decodeUser reads a UserPatch, requiring a name when create is set. A name
+// that is given must not be empty.
+func decodeUser(w http.ResponseWriter, r *http.Request, op string, create bool) (UserPatch, bool) {
+	var patch UserPatch
+
+	if !isJSON(r) {
+		log.Println(op+" - Unsupported content type ", r.Header.Get("Content-Type"))
+		UnsupportedMediaTypeHandler(w, r)
+		return patch, false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		log.Println(op+" - Error Decoding ", err)
+		BadRequestHandler(w, r, "malformed user: "+err.Error())
+		return patch, false
+	}
+
+	if (create && patch.Name == nil) || (patch.Name != nil && *patch.Name == "") {
+		log.Println(op + " - Missing name")
+		BadRequestHandler(w, r, "a user needs a name")
+		return patch, false
+	}
+
+	return patch, true
+}
+
+// CreateUser adds a user with an ID picked by the store and responds with
+// the stored user. This is how accounts sign up, a user created without a
+// password can't log in until one is set.
+func (h *ListHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	patch, ok := decodeUser(w, r, "Create User", true)
+	if !ok {
+		return
+	}
+
+	userID, err := h.store.CreateUser(*patch.Name)
+	if err != nil {
+		log.Println("Create User - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	if patch.Password != nil {
+		if err = h.store.SetPassword(userID, *patch.Password); err != nil {
+			log.Println("Create User - ", err)
+			// Keeping the user would leave the name taken by an account
+			// nobody can log into.
+			h.store.DeleteUser(userID)
+			StoreErrorHandler(w, r, err)
+			return
+		}
+	}
+
+	user, err := h.store.GetUser(userID)
+	if err != nil {
+		log.Println("Create User - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Create User - Success")
+	w.Header().Set("Location", "/users/"+userID)
+	writeJSON(w, http.StatusCreated, publicUser(user))
+}
+
+func (h *ListHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.store.GetUsers()
+	if err != nil {
+		log.Println("Get Users - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	for i := range users {
+		users[i] = publicUser(users[i])
+	}
+
+	log.Println("Get Users - Success")
+	writeJSON(w, http.StatusOK, users)
+}
+
+func (h *ListHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	matches := UserRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 2 {
+		log.Println("Get User - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	user, err := h.store.GetUser(matches[1])
+	if err != nil {
+		log.Println("Get User - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Get User - Success")
+	writeJSON(w, http.StatusOK, publicUser(user))
+}
+
+func (h *ListHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	matches := UserRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 2 {
+		log.Println("Update User - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	patch, ok := decodeUser(w, r, "Update User", false)
+	if !ok {
+		return
+	}
+
+	stored, err := h.store.GetUser(matches[1])
+	if err != nil {
+		log.Println("Update User - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	// Someone holding a stolen token mustn't be able to lock the user out.
+	_, loggedIn := authUser(r)
+	if patch.Password != nil && loggedIn && stored.PasswordHash != nil {
+		current := ""
+		if patch.CurrentPassword != nil {
+			current = *patch.CurrentPassword
+		}
+		if err = h.store.CheckPassword(matches[1], current); err != nil {
+			log.Println("Update User - ", err)
+			if errors.Is(err, store.ErrUnauthorized) {
+				ForbiddenHandler(w, r, "changing the password takes the current one as CurrentPassword")
+				return
+			}
+			StoreErrorHandler(w, r, err)
+			return
+		}
+	}
+
+	if patch.Name != nil {
+		if err := h.store.RenameUser(matches[1], *patch.Name); err != nil {
+			log.Println("Update User - ", err)
+			StoreErrorHandler(w, r, err)
+			return
+		}
+	}
+
+	if patch.Password != nil {
+		if err := h.store.SetPassword(matches[1], *patch.Password); err != nil {
+			log.Println("Update User - ", err)
+			StoreErrorHandler(w, r, err)
+			return
+		}
+
+		// Everyone logged in as the user is logged out, but for whoever
+		// changed the password.
+		keep := ""
+		if userID, _ := authUser(r); userID == matches[1] {
+			keep, _ = bearerToken(r)
+		}
+		h.sessions.revokeUser(matches[1], keep)
+	}
+
+	user, err := h.store.GetUser(matches[1])
+	if err != nil {
+		log.Println("Update User - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Update User - Success")
+	writeJSON(w, http.StatusOK, publicUser(user))
+}
+
+// DeleteUser deletes the user for good along with everything they own, none
+// of it goes to the trash.
+func (h *ListHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	matches := UserRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 2 {
+		log.Println("Delete User - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	if err := h.store.DeleteUser(matches[1]); err != nil {
+		log.Println("Delete User - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+	h.sessions.revokeUser(matches[1], "")
+
+	log.Println("Delete User - Success")
+	w.WriteHeader(http.StatusOK)
+}
+
+// FindTodos searches all of a user's lists, narrowed by the tag and assignee
+// query parameters when they are given. An assignee of "me" stands for the
+// user in the URL.
+func (h *ListHandler) FindTodos(w http.ResponseWriter, r *http.Request) {
+	matches := UserTodosRe.FindStringSubmatch(r.URL.Path)
+
+	if len(matches) < 2 {
+		log.Println("Find Todos - Not enough arguments")
+		NotFoundHandler(w, r)
+		return
+	}
+
+	query := store.TodoQuery{Tag: r.URL.Query().Get("tag"), AssigneeID: r.URL.Query().Get("assignee")}
+	if query.AssigneeID == "me" {
+		query.AssigneeID = matches[1]
+	}
+
+	found, err := h.store.FindTodos(matches[1], query)
+	if err != nil {
+		log.Println("Find Todos - ", err)
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	log.Println("Find Todos - Success")
+	writeJSON(w, http.StatusOK, found)
+}
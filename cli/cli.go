@@ -2,59 +2,257 @@ package main
 
 import (
 	"ToDo/store"
+	"errors"
 	"fmt"
-	"maps"
 	"os"
-	"regexp"
+	"os/exec"
 	"slices"
-	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 )
 
 type model struct {
 	state      string
 	page       string
 	store      store.Store
+	accounts   store.ApiStore
 	user       *store.User
+	name       string
 	toDoLists  []*store.TodoList
+	shared     []store.SharedList
 	listID     string
+	ownerID    string
+	role       store.Role
 	list       *store.TodoList
-	toDoList   []*store.Todo
+	toDoList   []todoRow
+	collapsed  map[string]bool
+	parentID   string
+	todoID     string
 	input      string
 	cursor     int
 	loginError string
+	storeError string
+	sortOrder  store.SortOrder
+	tag        string
+	found      []store.FoundTodo
+	trash      store.Trash
 }
 
+// apiKeyEnv names the environment variable holding an API key to use
+// instead of logging in.
+const apiKeyEnv = "TODO_API_KEY"
+
 func InitialModel() model {
-	apiStore := store.NewApiStore("8080", "../data/")
-	return model{
+	apiStore := store.NewApiStore("8080")
+	m := model{
 		state:      "userInput",
 		page:       "login",
 		store:      apiStore,
+		accounts:   apiStore,
 		user:       &store.User{},
 		toDoLists:  []*store.TodoList{},
 		listID:     "",
 		list:       nil,
-		toDoList:   []*store.Todo{},
+		toDoList:   []todoRow{},
+		collapsed:  make(map[string]bool),
 		input:      "",
 		cursor:     0,
 		loginError: "",
+		storeError: "",
 	}
+
+	if secret := os.Getenv(apiKeyEnv); secret != "" {
+		key, err := apiStore.CheckAPIKey(secret)
+		if err != nil {
+			m.loginError = "The API key in $" + apiKeyEnv + " doesn't work: " + err.Error()
+			return m
+		}
+		apiStore.UseAPIKey(secret)
+		m.logIn(key.UserID)
+	}
+	return m
 }
 
 type Msg string
 
+// todoRow is a todo as shown in the tree of the open list.
+type todoRow struct {
+	*store.Todo
+	depth int
+}
+
+// flattenTodos lays the todos out as a tree in order, leaving out the
+// subtasks of collapsed todos.
+func flattenTodos(todos map[string]*store.Todo, order store.SortOrder, collapsed map[string]bool) []todoRow {
+	var rows []todoRow
+	var walk func(parentID string, depth int)
+	walk = func(parentID string, depth int) {
+		for _, todo := range store.Subtasks(todos, parentID, order) {
+			rows = append(rows, todoRow{Todo: todo, depth: depth})
+			if !collapsed[todo.ID] {
+				walk(todo.ID, depth+1)
+			}
+		}
+	}
+	walk("", 0)
+	return rows
+}
+
+// loadLists reloads the user's lists in order followed by the lists shared
+// with them, keeping the cursor on the list with selectID when there is one.
+func (m *model) loadLists(selectID string) {
+	lists, err := m.store.GetTodoLists(m.user.ID)
+	if err != nil {
+		m.storeError = errorMessage(err)
+		return
+	}
+	shared, err := m.store.SharedTodoLists(m.user.ID)
+	if err != nil {
+		m.storeError = errorMessage(err)
+		return
+	}
+
+	m.toDoLists = store.SortTodoLists(lists)
+	m.shared = shared
+	if i := slices.IndexFunc(m.toDoLists, func(list *store.TodoList) bool { return list.ID == selectID }); i >= 0 {
+		m.cursor = i
+	}
+	m.cursor = min(m.cursor, max(len(m.toDoLists)+len(m.shared)-1, 0))
+}
+
+// openList shows the todos of list, which ownerID shares with the user as
+// role unless it is their own.
+func (m *model) openList(list *store.TodoList, ownerID string, role store.Role) {
+	m.toDoList = flattenTodos(list.Todos, m.sortOrder, m.collapsed)
+	m.listID = list.ID
+	m.list = list
+	m.ownerID = ownerID
+	m.role = role
+	m.page = "todos"
+	m.cursor = 0
+}
+
+// readOnly reports whether key would change a list the user may only view,
+// the open one or, on the tagged and assigned pages, the one holding the
+// todo under the cursor.
+func (m model) readOnly(key string) bool {
+	switch m.page {
+	case "todos", "todo":
+		if m.role.Allows(store.RoleEditor) {
+			return false
+		}
+		switch key {
+		case "d", "K", "shift+up", "J", "shift+down", "p", "C", "A", "a", "@", "e", "enter", "l", "right":
+			return true
+		}
+	case "tagged", "assigned":
+		if key != "enter" || len(m.found) == 0 {
+			return false
+		}
+		todo := m.found[m.cursor]
+		return !m.roleOn(todo.OwnerID, todo.ListID).Allows(store.RoleEditor)
+	}
+	return false
+}
+
+// roleOn returns the user's role on the list of ownerID with listID, going
+// by the shared lists loadLists last loaded.
+func (m model) roleOn(ownerID string, listID string) store.Role {
+	if ownerID == m.user.ID {
+		return store.RoleOwner
+	}
+	for _, list := range m.shared {
+		if list.OwnerID == ownerID && list.ID == listID {
+			return list.Role
+		}
+	}
+	return ""
+}
+
+// loadTodos is loadLists for the todos of the open list, in m.sortOrder.
+func (m *model) loadTodos(selectID string) {
+	list, err := m.store.GetTodoList(m.ownerID, m.listID)
+	if err != nil {
+		m.storeError = errorMessage(err)
+		return
+	}
+
+	m.list = &list
+	m.toDoList = flattenTodos(list.Todos, m.sortOrder, m.collapsed)
+	if i := slices.IndexFunc(m.toDoList, func(row todoRow) bool { return row.ID == selectID }); i >= 0 {
+		m.cursor = i
+	}
+	m.cursor = min(m.cursor, max(len(m.toDoList)-1, 0))
+}
+
+// loadFound is loadLists for the todos found across lists, those carrying
+// m.tag on the tagged page and those assigned to the user on the assigned
+// one.
+func (m *model) loadFound(selectID string) {
+	query := store.TodoQuery{Tag: m.tag}
+	if m.page == "assigned" {
+		query = store.TodoQuery{AssigneeID: m.user.ID}
+	}
+	found, err := m.store.FindTodos(m.user.ID, query)
+	if err != nil {
+		m.storeError = errorMessage(err)
+		return
+	}
+
+	m.found = found
+	if i := slices.IndexFunc(m.found, func(todo store.FoundTodo) bool { return todo.ID == selectID }); i >= 0 {
+		m.cursor = i
+	}
+	m.cursor = min(m.cursor, max(len(m.found)-1, 0))
+}
+
+// loadTrash reloads the user's trash, its lists shown before its todos.
+func (m *model) loadTrash() {
+	trash, err := m.store.Trash(m.user.ID)
+	if err != nil {
+		m.storeError = errorMessage(err)
+		return
+	}
+
+	m.trash = trash
+	m.cursor = min(m.cursor, max(len(m.trash.Lists)+len(m.trash.Todos)-1, 0))
+}
+
 func (m model) Init() tea.Cmd {
 	return nil
 }
 
+// logIn opens the lists of the user the store is logged in as.
+func (m *model) logIn(userID string) {
+	user, err := m.store.GetUser(userID)
+	if err != nil {
+		m.loginError = errorMessage(err)
+		return
+	}
+	m.loginError = ""
+	m.user = &user
+	m.loadLists("")
+	m.state = "main"
+	m.page = "lists"
+	m.cursor = 0
+}
+
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	re := regexp.MustCompile(`[0-9]+$`)
 	switch msg := msg.(type) {
+	case notesEditedMsg:
+		m.saveNotes(msg)
 	case tea.KeyMsg:
+		m.storeError = ""
 		switch m.state {
 		case "main":
+			if m.readOnly(msg.String()) {
+				m.storeError = "This list is only shared with you to view"
+				break
+			}
 			switch msg.String() {
 			case "k", "up":
 				if m.cursor > 0 {
@@ -63,53 +261,241 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case "j", "down":
 				switch m.page {
 				case "lists":
-					if m.cursor < len(m.toDoLists)-1 {
+					if m.cursor < len(m.toDoLists)+len(m.shared)-1 {
 						m.cursor++
 					}
 				case "todos":
 					if m.cursor < len(m.toDoList)-1 {
 						m.cursor++
 					}
+				case "tagged", "assigned":
+					if m.cursor < len(m.found)-1 {
+						m.cursor++
+					}
+				case "trash":
+					if m.cursor < len(m.trash.Lists)+len(m.trash.Todos)-1 {
+						m.cursor++
+					}
 				}
 			case "d":
 				switch m.page {
 				case "lists":
-					m.store.DeleteTodoList(m.user.ID, m.toDoLists[m.cursor].ID)
-					todos, _ := m.store.GetTodoLists(m.user.ID)
-					m.toDoLists = slices.Collect(maps.Values(todos))
+					if m.cursor >= len(m.toDoLists) {
+						if len(m.shared) > 0 {
+							m.storeError = "Only its owner can move or delete a shared list"
+						}
+						break
+					}
+					if err := m.store.DeleteTodoList(m.user.ID, m.toDoLists[m.cursor].ID); err != nil {
+						m.storeError = errorMessage(err)
+					}
+					m.loadLists("")
 					m.cursor = 0
+				case "todos":
+					if len(m.toDoList) == 0 {
+						break
+					}
+					if err := m.store.DeleteTodo(m.ownerID, m.listID, m.toDoList[m.cursor].ID, m.user.ID); err != nil {
+						m.storeError = errorMessage(err)
+					}
+					m.loadTodos("")
+				}
+			case "T":
+				if m.page != "lists" {
+					break
+				}
+				m.page = "trash"
+				m.cursor = 0
+				m.loadTrash()
+			case "P":
+				if m.page != "trash" {
+					break
+				}
+				if err := m.store.PurgeTrash(m.user.ID, time.Now()); err != nil {
+					m.storeError = errorMessage(err)
+				}
+				m.loadTrash()
+			case "K", "shift+up", "J", "shift+down":
+				by := 1
+				if msg.String() == "K" || msg.String() == "shift+up" {
+					by = -1
+				}
+				switch m.page {
+				case "lists":
+					if m.cursor >= len(m.toDoLists) {
+						if len(m.shared) > 0 {
+							m.storeError = "Only its owner can move or delete a shared list"
+						}
+						break
+					}
+					listID := m.toDoLists[m.cursor].ID
+					if err := m.store.MoveTodoList(m.user.ID, listID, by); err != nil {
+						m.storeError = errorMessage(err)
+					}
+					m.loadLists(listID)
+				case "todos":
+					if len(m.toDoList) == 0 {
+						break
+					}
+					if m.sortOrder != store.ByPosition {
+						m.storeError = "Sort by position (s) to reorder todos"
+						break
+					}
+					todoID := m.toDoList[m.cursor].ID
+					if err := m.store.MoveTodo(m.ownerID, m.listID, todoID, by, m.user.ID); err != nil {
+						m.storeError = errorMessage(err)
+					}
+					m.loadTodos(todoID)
+				}
+			case "p":
+				if m.page != "todos" || len(m.toDoList) == 0 {
+					break
+				}
+				todo := *m.toDoList[m.cursor].Todo
+				todo.Priority = (todo.Priority + 1) % (store.PriorityHigh + 1)
+				if err := m.store.UpdateTodo(todo, m.listID, m.ownerID, m.user.ID); err != nil {
+					m.storeError = errorMessage(err)
+				}
+				m.loadTodos(todo.ID)
+			case "s":
+				if m.page != "todos" {
+					break
+				}
+				m.sortOrder = (m.sortOrder + 1) % (store.ByCreated + 1)
+				selected := ""
+				if len(m.toDoList) > 0 {
+					selected = m.toDoList[m.cursor].ID
+				}
+				m.loadTodos(selected)
+			case "c":
+				if m.page != "todos" || len(m.toDoList) == 0 {
+					break
+				}
+				todoID := m.toDoList[m.cursor].ID
+				m.collapsed[todoID] = !m.collapsed[todoID]
+				m.loadTodos(todoID)
+			case "C":
+				if m.page != "todos" {
+					break
+				}
+				list := *m.list
+				list.CompleteSubtasks = !list.CompleteSubtasks
+				if err := m.store.UpdateTodoList(list, m.ownerID, m.user.ID); err != nil {
+					m.storeError = errorMessage(err)
+				}
+				selected := ""
+				if len(m.toDoList) > 0 {
+					selected = m.toDoList[m.cursor].ID
+				}
+				m.loadTodos(selected)
+			case "A":
+				if m.page != "todos" || len(m.toDoList) == 0 {
+					break
+				}
+				m.parentID = m.toDoList[m.cursor].ID
+				m.state = "userInput"
+			case "t":
+				if m.page != "lists" && m.page != "tagged" {
+					break
+				}
+				m.state = "userInput"
+				m.page = "tagged"
+				m.input = ""
+			case "m":
+				if m.page != "lists" {
+					break
 				}
+				m.page = "assigned"
+				m.cursor = 0
+				m.loadFound("")
+			case "@":
+				if m.page != "todos" || len(m.toDoList) == 0 {
+					break
+				}
+				todo := *m.toDoList[m.cursor].Todo
+				todo.AssigneeID = m.user.ID
+				if m.toDoList[m.cursor].AssigneeID == m.user.ID {
+					todo.AssigneeID = ""
+				}
+				if err := m.store.UpdateTodo(todo, m.listID, m.ownerID, m.user.ID); err != nil {
+					m.storeError = errorMessage(err)
+				}
+				m.loadTodos(todo.ID)
 			case "h", "left":
-				lists, _ := m.store.GetTodoLists(m.user.ID)
-				m.toDoLists = slices.Collect(maps.Values(lists))
+				m.loadLists("")
 				switch m.page {
 				case "lists":
+					m.accounts.Logout()
 					m.state = "userInput"
 					m.page = "login"
 					m.cursor = 0
-				case "todos":
+				case "todos", "tagged", "assigned", "trash":
 					m.page = "lists"
 					m.cursor = 0
+				case "todo":
+					m.page = "todos"
+					m.loadTodos(m.todoID)
+				}
+			case "v":
+				if m.page != "todos" || len(m.toDoList) == 0 {
+					break
+				}
+				m.todoID = m.toDoList[m.cursor].ID
+				m.page = "todo"
+			case "e":
+				if m.page != "todo" {
+					break
+				}
+				if todo, exists := m.list.Todos[m.todoID]; exists {
+					return m, editNotes(*todo)
 				}
 			case "a":
+				if m.page == "tagged" || m.page == "assigned" || m.page == "todo" || m.page == "trash" {
+					break
+				}
+				m.parentID = ""
 				m.state = "userInput"
 			case "enter", "l", "right":
 				switch m.page {
 				case "lists":
-					m.toDoList = slices.Collect(maps.Values(m.toDoLists[m.cursor].Todos))
-					m.listID = m.toDoLists[m.cursor].ID
-					m.list = m.toDoLists[m.cursor]
-					m.page = "todos"
-					m.cursor = 0
+					switch {
+					case m.cursor < len(m.toDoLists):
+						m.openList(m.toDoLists[m.cursor], m.user.ID, store.RoleOwner)
+					case m.cursor < len(m.toDoLists)+len(m.shared):
+						shared := m.shared[m.cursor-len(m.toDoLists)]
+						m.openList(&shared.TodoList, shared.OwnerID, shared.Role)
+					}
 				case "todos":
-					m.store.ToggleTodo(m.user.ID, m.list.ID, m.toDoList[m.cursor].ID)
-					list, _ := m.store.GetTodoList(m.user.ID, m.listID)
-					m.toDoList = slices.Collect(maps.Values(list.Todos))
-				case "addUser":
-					m.state = "userInput"
-					m.page = "login"
-					m.cursor = 0
-					m.input = ""
+					if len(m.toDoList) == 0 {
+						break
+					}
+					todoID := m.toDoList[m.cursor].ID
+					if err := m.store.ToggleTodo(m.ownerID, m.list.ID, todoID, m.user.ID); err != nil {
+						m.storeError = errorMessage(err)
+					}
+					m.loadTodos(todoID)
+				case "tagged", "assigned":
+					if len(m.found) == 0 {
+						break
+					}
+					todo := m.found[m.cursor]
+					if err := m.store.ToggleTodo(todo.OwnerID, todo.ListID, todo.ID, m.user.ID); err != nil {
+						m.storeError = errorMessage(err)
+					}
+					m.loadFound(todo.ID)
+				case "trash":
+					var err error
+					switch {
+					case m.cursor < len(m.trash.Lists):
+						err = m.store.RestoreTodoList(m.user.ID, m.trash.Lists[m.cursor].ID)
+					case m.cursor < len(m.trash.Lists)+len(m.trash.Todos):
+						todo := m.trash.Todos[m.cursor-len(m.trash.Lists)]
+						err = m.store.RestoreTodo(m.user.ID, todo.ListID, todo.ID, m.user.ID)
+					}
+					if err != nil {
+						m.storeError = errorMessage(err)
+					}
+					m.loadTrash()
 				}
 			case "q", "ctrl+c":
 				return m, tea.Quit
@@ -118,55 +504,95 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			switch msg.String() {
 			case "enter":
 				switch m.page {
-				case "login":
-					user, err := m.store.GetUser(m.input)
+				case "login", "addUser":
+					if strings.TrimSpace(m.input) == "" {
+						break
+					}
+					m.name = strings.TrimSpace(m.input)
+					m.input = ""
+					m.loginError = ""
+					if m.page == "login" {
+						m.page = "password"
+					} else {
+						m.page = "newPassword"
+					}
+				case "password":
+					userID, err := m.accounts.Login(m.name, m.input)
+					m.input = ""
 					if err != nil {
-						m.loginError = "failed to get user with ID " + m.input
+						m.loginError = errorMessage(err)
+						m.page = "login"
 						break
 					}
-					m.user = &user
-					todos, _ := m.store.GetTodoLists(m.user.ID)
-					m.toDoLists = slices.Collect(maps.Values(todos))
-					m.state = "main"
-					m.page = "lists"
+					m.logIn(userID)
+				case "newPassword":
+					userID, err := m.accounts.Register(m.name, m.input)
 					m.input = ""
-					m.cursor = 0
+					if err != nil {
+						m.loginError = errorMessage(err)
+						if errors.Is(err, store.ErrConflict) {
+							m.loginError = "The name " + m.name + " is taken"
+						}
+						m.page = "addUser"
+						break
+					}
+					m.logIn(userID)
 				case "lists":
-					m.store.UpdateTodoList(store.NewTodoList(strconv.Itoa(len(m.toDoLists)), m.input), m.user.ID)
-					todos, _ := m.store.GetTodoLists(m.user.ID)
-					m.toDoLists = slices.Collect(maps.Values(todos))
+					listID, err := m.store.CreateTodoList(store.NewTodoList("", m.input), m.user.ID)
+					if err != nil {
+						m.storeError = errorMessage(err)
+					}
+					m.cursor = 0
+					m.loadLists(listID)
 					m.input = ""
 					m.state = "main"
-					m.cursor = 0
 				case "todos":
-					todo := store.Todo{ID: strconv.Itoa(len(m.toDoList)), Title: m.input, Completed: false}
-					m.store.AddTodo(todo, m.list.ID, m.user.ID)
-					todos, _ := m.store.GetTodoList(m.user.ID, m.listID)
-					m.toDoList = slices.Collect(maps.Values(todos.Todos))
+					todo, err := parseTodoInput(m.input, time.Now())
+					if err != nil {
+						m.storeError = err.Error()
+						break
+					}
+					todo.ParentID = m.parentID
+					todoID, err := m.store.AddTodo(todo, m.list.ID, m.ownerID, m.user.ID)
+					if err != nil {
+						m.storeError = errorMessage(err)
+					}
+					if m.parentID != "" {
+						m.collapsed[m.parentID] = false
+						m.parentID = ""
+					}
+					m.cursor = 0
+					m.loadTodos(todoID)
 					m.input = ""
 					m.state = "main"
+				case "tagged":
+					m.tag = store.NormalizeTag(m.input)
 					m.cursor = 0
-				case "addUser":
-					id, _ := m.store.CreateUser(m.input)
-					m.input = id
+					m.loadFound("")
+					m.input = ""
 					m.state = "main"
-					m.cursor = 0
 				}
 			case "backspace":
 				if len(m.input) > 0 {
 					m.input = m.input[:len(m.input)-1]
 				}
-			case "a":
+			case "ctrl+n":
 				if m.page == "login" {
 					m.input = ""
+					m.loginError = ""
 					m.page = "addUser"
-				} else {
-					m.input += msg.String()
+				}
+			case "esc":
+				if m.page != "login" && isAccountPage(m.page) {
+					m.input = ""
+					m.loginError = ""
+					m.page = "login"
 				}
 			case "ctrl+c":
 				return m, tea.Quit
 			default:
-				if m.page == "login" && !re.MatchString(msg.String()) {
+				// Names and passwords take any text but no keys like "up".
+				if isAccountPage(m.page) && msg.Type != tea.KeyRunes && msg.Type != tea.KeySpace {
 					return m, nil
 				}
 				m.input += msg.String()
@@ -193,52 +619,513 @@ func (m model) View() string {
 				}
 				s += fmt.Sprintf("%s %s\n", cursor, list.Name)
 			}
+			if len(m.shared) > 0 {
+				s += "\nShared with me:\n"
+			}
+			for i, list := range m.shared {
+				cursor := " "
+				if len(m.toDoLists)+i == m.cursor {
+					cursor = ">"
+				}
+				s += fmt.Sprintf("%s %s (%s)\n", cursor, list.Name, list.Role)
+			}
 			s += lineBreak
-			s += "Press Enter to select, q to quit, a to add list, d to delete list"
+			s += "Press Enter to select, q to quit, a to add list, d to move list to the trash, K/J to move list, t to filter by tag, m to see what is assigned to you, T to open the trash"
+			s += m.storeErrorView()
 			return s
 		case "todos":
+			now := time.Now()
 			s += "Todo list: " + m.list.Name
+			if m.ownerID != m.user.ID {
+				s += fmt.Sprintf(" (shared with you as %s)", m.role)
+			}
 			s += lineBreak
 			if len(m.toDoList) == 0 {
 				s += "--list is empty, press a to add a todo--"
 			}
-			for i, todo := range m.toDoList {
+			for i, row := range m.toDoList {
 				cursor := " "
 				if i == m.cursor {
 					cursor = ">"
 				}
 				check := " "
-				if todo.Completed {
+				if row.Completed {
 					check = "X"
 				}
-				s += fmt.Sprintf("%s [%s] %s\n", cursor, check, todo.Title)
+				s += fmt.Sprintf("%s %s%s[%s] %s%s%s%s%s%s%s\n", cursor, strings.Repeat("  ", row.depth), m.treeView(row.ID), check,
+					priorityView(row.Priority), row.Title, m.progressView(row.ID), tagsView(row.Tags), dueView(*row.Todo, now), recurrenceView(row.Recurrence), m.assigneeView(row.AssigneeID))
 			}
 			s += lineBreak
-			s += "Press Enter to complete task, q to quit, a to add todo"
+			s += "Sorted by " + m.sortOrder.String()
+			if m.list.CompleteSubtasks {
+				s += ", completing a todo completes its subtasks"
+			}
+			s += "\n"
+			s += "Press Enter to complete task, v to view, q to quit, a to add todo, A to add subtask, d to move todo to the trash, c to collapse, C to change how subtasks complete, p to change priority, @ to assign to me or unassign, s to change sort, K/J to move todo"
+			s += m.storeErrorView()
 			return s
-		case "addUser":
-			s += "User added! Your ID is: " + m.input + lineBreak + "\n (Press Enter to continue)"
+		case "todo":
+			s += m.todoView(time.Now(), lineBreak)
+			s += m.storeErrorView()
+			return s
+		case "tagged":
+			s += "Todos tagged #" + m.tag
+			s += lineBreak
+			if len(m.found) == 0 {
+				s += "--no todos have this tag--"
+			}
+			s += m.foundView(time.Now())
+			s += lineBreak
+			s += "Press Enter to complete task, q to quit, t to filter by another tag, h to go back"
+			s += m.storeErrorView()
+			return s
+		case "assigned":
+			s += "Assigned to me"
+			s += lineBreak
+			if len(m.found) == 0 {
+				s += "--nothing is assigned to you--"
+			}
+			s += m.foundView(time.Now())
+			s += lineBreak
+			s += "Press Enter to complete task, q to quit, h to go back"
+			s += m.storeErrorView()
+			return s
+		case "trash":
+			s += m.trashView(time.Now(), lineBreak)
+			s += m.storeErrorView()
 			return s
 		}
 	case "userInput":
 		switch m.page {
 		case "login":
-			s += "Enter your User ID to log in: " + m.input + lineBreak + m.loginError + "\n (Press Enter to continue, ctrl+c to quit, a to add a user)\n"
+			s += "Enter your name to log in: " + m.input + lineBreak + m.loginError + "\n (Press Enter to continue, ctrl+c to quit, ctrl+n to sign up)\n"
+			return s
+		case "password":
+			s += "Password for " + m.name + ": " + strings.Repeat("*", utf8.RuneCountInString(m.input)) + lineBreak + "\n (Press Enter to log in, esc to go back)\n"
+			return s
+		case "newPassword":
+			s += fmt.Sprintf("Pick a password for %s: %s", m.name, strings.Repeat("*", utf8.RuneCountInString(m.input))) + lineBreak +
+				fmt.Sprintf("\n (At least %d characters, press Enter to sign up, esc to go back)\n", store.MinPasswordLength)
 			return s
 		case "todos":
-			s += "What do you need to do? " + m.input + lineBreak + "\n (Press Enter to continue)"
+			prompt := "What do you need to do? "
+			if parent, exists := m.list.Todos[m.parentID]; exists {
+				prompt = "What do you need to do for " + parent.Title + "? "
+			}
+			s += prompt + m.input + lineBreak + m.storeError + "\n (Add #tags and every:day, every:mon or every:month to repeat anywhere, end with due:YYYY-MM-DD, due:today or due:tomorrow to set a due date, press Enter to continue)"
+			return s
+		case "tagged":
+			s += "Filter by tag: " + m.input + lineBreak + "\n (Press Enter to continue)"
 			return s
 		case "lists":
 			s += "Enter the name of your new list: " + m.input + lineBreak + "\n (Press Enter to continue)"
 			return s
 		case "addUser":
-			s += "Enter your name: " + m.input + lineBreak + "\n (Press Enter to continue)"
+			s += "Enter your name: " + m.input + lineBreak + m.loginError + "\n (Press Enter to continue, esc to go back)"
 			return s
 		}
 	}
 	return ""
 }
 
+func errorMessage(err error) string {
+	switch {
+	case errors.Is(err, store.ErrUserNotFound):
+		return "That user doesn't exist"
+	case errors.Is(err, store.ErrUnauthorized):
+		return "Wrong name or password"
+	case errors.Is(err, store.ErrInvalidUser):
+		return fmt.Sprintf("Passwords need at least %d characters and at most 72 bytes", store.MinPasswordLength)
+	case errors.Is(err, store.ErrListNotFound):
+		return "That list doesn't exist anymore"
+	case errors.Is(err, store.ErrTodoNotFound):
+		return "That todo doesn't exist anymore"
+	case errors.Is(err, store.ErrConflict):
+		return "That was changed somewhere else, it has been reloaded so try again"
+	default:
+		return "Something went wrong: " + err.Error()
+	}
+}
+
+const dueLayout = "2006-01-02"
+
+var overdueStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Bold(true)
+
+// parseTodoInput turns what was typed into a todo, #words become its tags,
+// every:<when> makes it repeat and a trailing due:<date> sets its due date to
+// the end of that day.
+func parseTodoInput(input string, now time.Time) (store.Todo, error) {
+	var todo store.Todo
+	var every string
+
+	var words []string
+	for _, word := range strings.Fields(input) {
+		switch {
+		case len(word) > 1 && word[0] == '#':
+			todo.Tags = append(todo.Tags, word)
+		case strings.HasPrefix(word, "every:"):
+			every = strings.TrimPrefix(word, "every:")
+		default:
+			words = append(words, word)
+		}
+	}
+	todo.Tags = store.NormalizeTags(todo.Tags)
+	todo.Title = strings.Join(words, " ")
+
+	if err := parseDue(&todo, now); err != nil {
+		return todo, err
+	}
+	if every != "" {
+		return todo, parseEvery(&todo, every, now)
+	}
+	return todo, nil
+}
+
+func parseDue(todo *store.Todo, now time.Time) error {
+	i := strings.LastIndex(todo.Title, "due:")
+	if i < 0 || (i > 0 && todo.Title[i-1] != ' ') {
+		return nil
+	}
+
+	var day time.Time
+	switch value := todo.Title[i+len("due:"):]; value {
+	case "today":
+		day = now
+	case "tomorrow":
+		day = now.AddDate(0, 0, 1)
+	default:
+		var err error
+		if day, err = time.ParseInLocation(dueLayout, value, now.Location()); err != nil {
+			return fmt.Errorf("%q isn't a date, use YYYY-MM-DD, today or tomorrow", value)
+		}
+	}
+
+	due := endOfDay(day, now.Location())
+	todo.Due = &due
+	todo.Title = strings.TrimSpace(todo.Title[:i])
+	return nil
+}
+
+func endOfDay(day time.Time, loc *time.Location) time.Time {
+	year, month, date := day.Date()
+	return time.Date(year, month, date, 23, 59, 0, 0, loc)
+}
+
+// everyRules are the shorthands every: takes, anything else is read as an
+// RRULE.
+var everyRules = map[string]string{
+	"day":     "FREQ=DAILY",
+	"weekday": "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR",
+	"week":    "FREQ=WEEKLY",
+	"month":   "FREQ=MONTHLY",
+	"year":    "FREQ=YEARLY",
+	"mon":     "FREQ=WEEKLY;BYDAY=MO",
+	"tue":     "FREQ=WEEKLY;BYDAY=TU",
+	"wed":     "FREQ=WEEKLY;BYDAY=WE",
+	"thu":     "FREQ=WEEKLY;BYDAY=TH",
+	"fri":     "FREQ=WEEKLY;BYDAY=FR",
+	"sat":     "FREQ=WEEKLY;BYDAY=SA",
+	"sun":     "FREQ=WEEKLY;BYDAY=SU",
+}
+
+// parseEvery makes the todo repeat. Without a due date it is first due on
+// the first matching day from today.
+func parseEvery(todo *store.Todo, every string, now time.Time) error {
+	rule, exists := everyRules[strings.ToLower(every)]
+	if !exists {
+		rule = strings.ToUpper(every)
+	}
+
+	r, err := store.ParseRecurrence(rule)
+	if err != nil {
+		return fmt.Errorf("every:%s isn't a way to repeat, use day, weekday, week, month, year, a day like mon or an RRULE", every)
+	}
+
+	if todo.Due == nil {
+		due := endOfDay(now, now.Location())
+		if !r.Matches(due) {
+			due, _ = r.Next(due)
+		}
+		todo.Due = &due
+	}
+	todo.Recurrence = r.String()
+	return nil
+}
+
+func priorityView(priority store.Priority) string {
+	switch priority {
+	case store.PriorityLow:
+		return "! "
+	case store.PriorityMedium:
+		return "!! "
+	case store.PriorityHigh:
+		return "!!! "
+	default:
+		return ""
+	}
+}
+
+// treeView marks the todos that have subtasks with whether they are shown.
+func (m model) treeView(todoID string) string {
+	if _, total := store.Progress(m.list.Todos, todoID); total == 0 {
+		return "  "
+	}
+	if m.collapsed[todoID] {
+		return "+ "
+	}
+	return "- "
+}
+
+func (m model) progressView(todoID string) string {
+	done, total := store.Progress(m.list.Todos, todoID)
+	if total == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d/%d done)", done, total)
+}
+
+func recurrenceView(rule string) string {
+	if rule == "" {
+		return ""
+	}
+
+	r, err := store.ParseRecurrence(rule)
+	if err != nil {
+		return " (repeats)"
+	}
+
+	units := map[store.Frequency]string{store.Daily: "day", store.Weekly: "week", store.Monthly: "month", store.Yearly: "year"}
+	view := " (every " + units[r.Freq]
+	if r.Interval > 1 {
+		view = fmt.Sprintf(" (every %d %ss", r.Interval, units[r.Freq])
+	}
+	for i, day := range r.ByDay {
+		if i == 0 {
+			view += " on "
+		} else {
+			view += ", "
+		}
+		view += day.String()[:3]
+	}
+	return view + ")"
+}
+
+// foundView lists the todos found across lists, each after its list.
+func (m model) foundView(now time.Time) string {
+	s := ""
+	for i, todo := range m.found {
+		cursor := " "
+		if i == m.cursor {
+			cursor = ">"
+		}
+		check := " "
+		if todo.Completed {
+			check = "X"
+		}
+		s += fmt.Sprintf("%s [%s] %s: %s%s%s%s\n", cursor, check, todo.ListName, priorityView(todo.Priority), todo.Title, tagsView(todo.Tags), dueView(todo.Todo, now))
+	}
+	return s
+}
+
+// assigneeView marks the todos someone is doing. Only the user's own
+// assignments are told apart, the names of other users aren't known here.
+func (m model) assigneeView(assigneeID string) string {
+	switch assigneeID {
+	case "":
+		return ""
+	case m.user.ID:
+		return " @me"
+	default:
+		return " @taken"
+	}
+}
+
+func tagsView(tags []string) string {
+	var view string
+	for _, tag := range tags {
+		view += " #" + tag
+	}
+	return view
+}
+
+func dueView(todo store.Todo, now time.Time) string {
+	if todo.Due == nil {
+		return ""
+	}
+
+	status := todo.DueStatus(now)
+	view := " (due " + todo.Due.In(now.Location()).Format(dueLayout)
+	if status != store.NotDue {
+		view += ", " + status.String()
+	}
+	view += ")"
+
+	if status == store.Overdue {
+		return overdueStyle.Render(view)
+	}
+	return view
+}
+
+// todoView is the detail page of the todo with m.todoID, its notes rendered
+// as Markdown.
+func (m model) todoView(now time.Time, lineBreak string) string {
+	todo, exists := m.list.Todos[m.todoID]
+	if !exists {
+		return "That todo doesn't exist anymore" + lineBreak + "Press h to go back"
+	}
+
+	s := "Todo: " + todo.Title + lineBreak
+
+	check := " "
+	if todo.Completed {
+		check = "X"
+	}
+	s += fmt.Sprintf("[%s] %s%s%s%s%s%s\n", check, priorityView(todo.Priority), m.list.Name,
+		m.progressView(todo.ID), tagsView(todo.Tags), dueView(*todo, now), recurrenceView(todo.Recurrence))
+	if todo.Start != nil {
+		s += "Starts " + todo.Start.In(now.Location()).Format(dueLayout) + "\n"
+	}
+	s += stampsView(*todo, now)
+	s += lineBreak
+
+	if strings.TrimSpace(todo.Notes) == "" {
+		s += "--no notes, press e to add some--"
+	} else {
+		s += renderMarkdown(todo.Notes)
+	}
+
+	s += lineBreak
+	s += "Press e to edit notes in $EDITOR, h to go back, q to quit"
+	return s
+}
+
+// stampsView says when the todo was created, last changed and completed.
+// Todos stored before the store kept timestamps show nothing.
+func stampsView(todo store.Todo, now time.Time) string {
+	if todo.CreatedAt.IsZero() {
+		return ""
+	}
+
+	s := "Created " + todo.CreatedAt.In(now.Location()).Format(dueLayout)
+	if !todo.UpdatedAt.Equal(todo.CreatedAt) {
+		s += ", updated " + todo.UpdatedAt.In(now.Location()).Format(dueLayout)
+	}
+	if todo.CompletedAt != nil {
+		s += ", completed " + todo.CompletedAt.In(now.Location()).Format(dueLayout)
+	}
+	return s + "\n"
+}
+
+// trashView lists what the user deleted, lists first, newest first.
+func (m model) trashView(now time.Time, lineBreak string) string {
+	s := "Trash" + lineBreak
+	if len(m.trash.Lists)+len(m.trash.Todos) == 0 {
+		s += "--the trash is empty--"
+	}
+
+	// Todos may come from lists that are in the trash themselves.
+	listNames := make(map[string]string)
+	for _, list := range m.toDoLists {
+		listNames[list.ID] = list.Name
+	}
+	for i, list := range m.trash.Lists {
+		listNames[list.ID] = list.Name
+		cursor := " "
+		if i == m.cursor {
+			cursor = ">"
+		}
+		s += fmt.Sprintf("%s List %s (%d todos, deleted %s)\n", cursor, list.Name, len(list.Todos), list.DeletedAt.In(now.Location()).Format(dueLayout))
+	}
+	for i, todo := range m.trash.Todos {
+		cursor := " "
+		if len(m.trash.Lists)+i == m.cursor {
+			cursor = ">"
+		}
+		s += fmt.Sprintf("%s %s: %s (deleted %s)\n", cursor, listNames[todo.ListID], todo.Title, todo.DeletedAt.In(now.Location()).Format(dueLayout))
+	}
+
+	s += lineBreak
+	s += "Deleted lists and todos are purged for good after a while\n"
+	s += "Press Enter to restore, P to purge everything now, h to go back, q to quit"
+	return s
+}
+
+// notesEditedMsg reports that the editor started by editNotes has exited.
+type notesEditedMsg struct {
+	todoID string
+	path   string
+	err    error
+}
+
+// editNotes opens the todo's notes in $EDITOR through a temporary file, which
+// saveNotes reads back once the editor exits.
+func editNotes(todo store.Todo) tea.Cmd {
+	f, err := os.CreateTemp("", "todo-*.md")
+	if err != nil {
+		return func() tea.Msg { return notesEditedMsg{todoID: todo.ID, err: err} }
+	}
+
+	_, err = f.WriteString(todo.Notes)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return func() tea.Msg { return notesEditedMsg{todoID: todo.ID, err: err} }
+	}
+
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+	cmd := exec.Command(editor[0], append(editor[1:], f.Name())...)
+
+	return tea.ExecProcess(cmd, func(err error) tea.Msg {
+		return notesEditedMsg{todoID: todo.ID, path: f.Name(), err: err}
+	})
+}
+
+func (m *model) saveNotes(msg notesEditedMsg) {
+	if msg.path != "" {
+		defer os.Remove(msg.path)
+	}
+	if msg.err != nil {
+		m.storeError = "Couldn't edit the notes: " + msg.err.Error()
+		return
+	}
+
+	notes, err := os.ReadFile(msg.path)
+	if err != nil {
+		m.storeError = "Couldn't read the notes back: " + err.Error()
+		return
+	}
+
+	stored, exists := m.list.Todos[msg.todoID]
+	if !exists || stored.Notes == string(notes) {
+		return
+	}
+
+	todo := *stored
+	todo.Notes = string(notes)
+	if err = m.store.UpdateTodo(todo, m.listID, m.ownerID, m.user.ID); err != nil {
+		m.storeError = errorMessage(err)
+	}
+	m.loadTodos(msg.todoID)
+}
+
+// isAccountPage reports whether page is one of the prompts for logging in or
+// signing up.
+func isAccountPage(page string) bool {
+	return page == "login" || page == "password" || page == "addUser" || page == "newPassword"
+}
+
+func (m model) storeErrorView() string {
+	if m.storeError == "" {
+		return ""
+	}
+	return "\n" + m.storeError
+}
+
 func main() {
 	p := tea.NewProgram(InitialModel())
 	if _, err := p.Run(); err != nil {
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	headingStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	boldStyle    = lipgloss.NewStyle().Bold(true)
+	italicStyle  = lipgloss.NewStyle().Italic(true)
+	codeStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("10"))
+	quoteStyle   = lipgloss.NewStyle().Faint(true).Italic(true)
+)
+
+var (
+	headingRe  = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	bulletRe   = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	numberedRe = regexp.MustCompile(`^(\s*)(\d+[.)])\s+(.*)$`)
+	ruleRe     = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+	codeRe     = regexp.MustCompile("`([^`]+)`")
+	boldRe     = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	italicRe   = regexp.MustCompile(`\*([^*\s][^*]*)\*|\b_([^_]+)_\b`)
+)
+
+// renderMarkdown styles the common parts of Markdown for the terminal:
+// headings, lists, quotes, rules, code and emphasis. Anything else is left
+// as written.
+func renderMarkdown(text string) string {
+	var lines []string
+	inCode := false
+
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			lines = append(lines, "  "+codeStyle.Render(line))
+			continue
+		}
+
+		switch {
+		case headingRe.MatchString(line):
+			heading := headingRe.FindStringSubmatch(line)[2]
+			lines = append(lines, headingStyle.Render(heading))
+		case ruleRe.MatchString(line):
+			lines = append(lines, strings.Repeat("─", 20))
+		case bulletRe.MatchString(line):
+			m := bulletRe.FindStringSubmatch(line)
+			lines = append(lines, m[1]+"• "+renderInline(m[2]))
+		case numberedRe.MatchString(line):
+			m := numberedRe.FindStringSubmatch(line)
+			lines = append(lines, m[1]+m[2]+" "+renderInline(m[3]))
+		case strings.HasPrefix(line, ">"):
+			quote := strings.TrimSpace(strings.TrimPrefix(line, ">"))
+			lines = append(lines, "│ "+quoteStyle.Render(quote))
+		default:
+			lines = append(lines, renderInline(line))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// renderInline styles code spans and emphasis, leaving the inside of code
+// spans alone.
+func renderInline(text string) string {
+	var b strings.Builder
+
+	last := 0
+	for _, span := range codeRe.FindAllStringSubmatchIndex(text, -1) {
+		b.WriteString(renderEmphasis(text[last:span[0]]))
+		b.WriteString(codeStyle.Render(text[span[2]:span[3]]))
+		last = span[1]
+	}
+	b.WriteString(renderEmphasis(text[last:]))
+
+	return b.String()
+}
+
+func renderEmphasis(text string) string {
+	text = boldRe.ReplaceAllStringFunc(text, func(s string) string {
+		return boldStyle.Render(s[2 : len(s)-2])
+	})
+	return italicRe.ReplaceAllStringFunc(text, func(s string) string {
+		return italicStyle.Render(s[1 : len(s)-1])
+	})
+}
@@ -1 +1,94 @@
 package main
+
+import (
+	"ToDo/api"
+	"ToDo/store"
+	"ToDo/store/migrate"
+	"bufio"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+func main() {
+	dataDir := flag.String("data", "data", "directory holding the JSON data")
+	backend := flag.String("store", "json", "storage backend, json, eventlog or sqlite")
+	retention := flag.Duration("trash-retention", store.DefaultRetention, "how long deleted lists and todos stay in the trash, 0 keeps them forever")
+	sessionTTL := flag.Duration("session-ttl", api.DefaultSessionTTL, "how long a login lasts")
+	setPassword := flag.String("set-password", "", "set the password of the user with this ID to a line read from stdin and exit")
+	dryRun := flag.Bool("migrate-dry-run", false, "report the data migrations that would run and exit")
+	flag.Parse()
+
+	if *dryRun {
+		result, err := store.MigrateJsonDir(*dataDir, migrate.Options{DryRun: true})
+		if err != nil {
+			log.Fatalln("Migration dry run: ", err)
+		}
+
+		fmt.Printf("%s is at version %d\n", *dataDir, result.From)
+		for _, m := range result.Applied {
+			fmt.Printf("would migrate to version %d: %s\n", m.Version, m.Description)
+		}
+		return
+	}
+
+	s, err := openStore(*backend, *dataDir, store.WithRetention(*retention))
+	if err != nil {
+		log.Fatalln("Opening store: ", err)
+	}
+
+	if *setPassword != "" {
+		// Users from before passwords can't log in until they are given one.
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && password == "" {
+			log.Fatalln("Reading password: ", err)
+		}
+		if err = s.SetPassword(*setPassword, strings.TrimRight(password, "\r\n")); err != nil {
+			log.Fatalln("Setting password: ", err)
+		}
+		fmt.Println("password set for user", *setPassword)
+		return
+	}
+
+	listHandler := api.NewListHandler(s, api.NewSessions(*sessionTTL))
+	authHandler := listHandler.RequireAuth()
+
+	mux := http.NewServeMux()
+
+	mux.Handle("/", &api.HomeHandler{})
+	mux.Handle("/lists/", authHandler)
+	mux.Handle("/users", authHandler)
+	mux.Handle("/users/", authHandler)
+	mux.Handle("/auth/", authHandler)
+
+	log.Fatalln("ListenAndServe: ", http.ListenAndServe(":8080", mux))
+}
+
+func openStore(backend string, dataDir string, opts ...store.Option) (store.Store, error) {
+	switch backend {
+	case "json":
+		return store.NewJsonStore(dataDir, opts...)
+	case "eventlog":
+		return store.NewEventLogStore(filepath.Join(dataDir, "eventlog"), store.DefaultSnapshotEvery, opts...)
+	case "sqlite":
+		if err := os.MkdirAll(dataDir, 0755); err != nil {
+			return nil, err
+		}
+
+		dsn := "file:" + filepath.Join(dataDir, "todo.db") + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate"
+		db, err := sql.Open("sqlite", dsn)
+		if err != nil {
+			return nil, err
+		}
+		return store.NewSQLStore(db, opts...)
+	default:
+		return nil, fmt.Errorf("unknown store %q", backend)
+	}
+}
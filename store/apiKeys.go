@@ -0,0 +1,167 @@
+package store
+
+import (
+	"cmp"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"slices"
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix starts every API key secret, telling them apart from the
+// tokens handed out by logging in.
+const APIKeyPrefix = "todo_"
+
+// Scope is what an API key may do.
+type Scope string
+
+const (
+	// ScopeWrite allows everything the key's user could do logged in.
+	ScopeWrite Scope = "write"
+	// ScopeRead only allows looking, never changing anything.
+	ScopeRead Scope = "read"
+)
+
+// APIKey lets scripts act as a user without their password. Only a hash of
+// its secret is kept, the secret itself is given out once by CreateAPIKey.
+type APIKey struct {
+	ID     string
+	UserID string
+	Name   string
+	Scope  Scope
+	// CreatedAt is maintained by the store.
+	CreatedAt time.Time
+	// ExpiresAt is when the key stops working, nil for a key that works
+	// until revoked.
+	ExpiresAt *time.Time `json:",omitempty"`
+	// Hash is the SHA-256 hash of the secret, the secrets are random enough
+	// not to need a slow hash. Keys returned by GetAPIKeys leave it out.
+	Hash []byte `json:",omitempty"`
+}
+
+// Expired reports whether the key no longer works at now.
+func (k APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// newAPIKey checks key and fills in what the store maintains, returning it
+// along with its secret. A key without a scope gets ScopeWrite.
+func newAPIKey(key APIKey, userID string, keyID string, now time.Time) (APIKey, string, error) {
+	if key.Scope == "" {
+		key.Scope = ScopeWrite
+	}
+	if key.Scope != ScopeWrite && key.Scope != ScopeRead {
+		return APIKey{}, "", errorf(ErrInvalidKey, "API key scope %q is neither %q nor %q", key.Scope, ScopeRead, ScopeWrite)
+	}
+	if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+		return APIKey{}, "", errorf(ErrInvalidKey, "API key would expire at %s, which has passed", key.ExpiresAt.Format(time.RFC3339))
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return APIKey{}, "", err
+	}
+	secret := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(raw)
+
+	key.ID = keyID
+	key.UserID = userID
+	key.CreatedAt = now
+	key.Hash = hashAPIKey(secret)
+	return key, secret, nil
+}
+
+func hashAPIKey(secret string) []byte {
+	hash := sha256.Sum256([]byte(secret))
+	return hash[:]
+}
+
+func apiKeyNotFound(userID string, keyID string) error {
+	return errorf(ErrKeyNotFound, "API key with ID %s doesn't exist for user ID %s", keyID, userID)
+}
+
+// addAPIKey gives the user in users the key made by newAPIKey.
+func addAPIKey(users map[string]*User, key APIKey) error {
+	user, exists := users[key.UserID]
+	if !exists {
+		return userNotFound(key.UserID)
+	}
+
+	if user.APIKeys == nil {
+		user.APIKeys = make(map[string]*APIKey)
+	}
+	user.APIKeys[key.ID] = &key
+	return nil
+}
+
+func revokeAPIKey(users map[string]*User, userID string, keyID string) error {
+	user, exists := users[userID]
+	if !exists {
+		return userNotFound(userID)
+	}
+	if _, exists = user.APIKeys[keyID]; !exists {
+		return apiKeyNotFound(userID, keyID)
+	}
+
+	delete(user.APIKeys, keyID)
+	return nil
+}
+
+// listAPIKeys returns the user's keys oldest first without their hashes, as
+// GetAPIKeys does.
+func listAPIKeys(user User) []APIKey {
+	keys := make([]APIKey, 0, len(user.APIKeys))
+	for _, key := range user.APIKeys {
+		listed := *key
+		listed.Hash = nil
+		keys = append(keys, listed)
+	}
+
+	slices.SortFunc(keys, func(a, b APIKey) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return keys
+}
+
+// findAPIKey is CheckAPIKey over every user in users.
+func findAPIKey(users map[string]*User, secret string, now time.Time) (APIKey, error) {
+	if !strings.HasPrefix(secret, APIKeyPrefix) {
+		return APIKey{}, errorf(ErrUnauthorized, "not an API key")
+	}
+
+	hash := hashAPIKey(secret)
+	for _, user := range users {
+		for _, key := range user.APIKeys {
+			if slices.Equal(key.Hash, hash) {
+				return checkAPIKey(*key, now)
+			}
+		}
+	}
+	return APIKey{}, errorf(ErrUnauthorized, "unknown API key")
+}
+
+// checkAPIKey turns down an expired key and leaves out the hash of one that
+// works.
+func checkAPIKey(key APIKey, now time.Time) (APIKey, error) {
+	if key.Expired(now) {
+		return APIKey{}, errorf(ErrUnauthorized, "API key %s of user ID %s has expired", key.ID, key.UserID)
+	}
+
+	key.Hash = nil
+	return key, nil
+}
+
+func cloneAPIKeys(keys map[string]*APIKey) map[string]*APIKey {
+	if keys == nil {
+		return nil
+	}
+
+	clone := make(map[string]*APIKey, len(keys))
+	for id, key := range keys {
+		k := *key
+		k.Hash = slices.Clone(key.Hash)
+		clone[id] = &k
+	}
+	return clone
+}
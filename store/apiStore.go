@@ -5,109 +5,241 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
-	"os"
+	"net/url"
+	"time"
 )
 
+// ApiStore is a Store that goes through the todo server's HTTP API for
+// everything, the server picks the IDs. Once Login or Register succeeds its
+// token is sent along with every request, copies of the store share it.
+// The server records changes as made by the user the token belongs to, so
+// the actorID its methods take is ignored. The password logged in with is
+// kept as well, the server wants it to change the password.
 type ApiStore struct {
-	Users      map[string]*User
 	serverPort string
-	storePath  string
+	token      *string
+	password   *string
 }
 
-func NewApiStore(serverPort, storePath string) ApiStore {
-	return ApiStore{
-		Users:      make(map[string]*User),
-		serverPort: serverPort,
-		storePath:  storePath,
+func NewApiStore(serverPort string) ApiStore {
+	return ApiStore{serverPort: serverPort, token: new(string), password: new(string)}
+}
+
+// loginResponse mirrors api.LoginResponse, which can't be imported here.
+type loginResponse struct {
+	Token     string
+	UserID    string
+	ExpiresAt time.Time
+}
+
+// Login logs in as the user going by name and returns their ID.
+func (s ApiStore) Login(name string, password string) (string, error) {
+	var res loginResponse
+
+	body := struct{ Name, Password string }{name, password}
+	if err := s.send(http.MethodPost, s.url("/auth/login"), body, &res); err != nil {
+		return "", err
 	}
+
+	*s.token = res.Token
+	*s.password = password
+	return res.UserID, nil
 }
 
-func (s ApiStore) getUsersFromJson() (map[string]*User, error) {
-	users := make(map[string]*User)
-	file := s.storePath + "/users.json"
+// Register signs up a user with a password and logs in as them.
+func (s ApiStore) Register(name string, password string) (string, error) {
+	var user User
 
-	jsonFile, err := os.Open(file)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return make(map[string]*User), nil
-		} else {
-			return make(map[string]*User), err
-		}
+	if err := s.send(http.MethodPost, s.url("/users"), struct{ Name, Password string }{name, password}, &user); err != nil {
+		return "", err
 	}
 
-	defer jsonFile.Close()
+	return s.Login(name, password)
+}
 
-	byteValue, _ := io.ReadAll(jsonFile)
+// UseAPIKey makes the store authenticate with an API key, as scripts do,
+// instead of logging in.
+func (s ApiStore) UseAPIKey(secret string) {
+	*s.token = secret
+	*s.password = ""
+}
 
-	err = json.Unmarshal(byteValue, &users)
+// Logout gives up the token, later requests go without one.
+func (s ApiStore) Logout() error {
+	if *s.token == "" {
+		return nil
+	}
 
-	return users, nil
+	err := s.send(http.MethodPost, s.url("/auth/logout"), nil, nil)
+	*s.token = ""
+	*s.password = ""
+	return err
 }
 
 func (s ApiStore) CreateUser(username string) (id string, e error) {
-	users, err := s.getUsersFromJson()
-	if err != nil {
-		return "json error", fmt.Errorf("%s", err)
+	var user User
+
+	if err := s.send(http.MethodPost, s.url("/users"), struct{ Name string }{username}, &user); err != nil {
+		return "", err
 	}
 
-	s.Users = users
+	return user.ID, nil
+}
 
-	userID := fmt.Sprintf("%04d", len(s.Users)+1)
-	user := NewUser(userID, username)
+func (s ApiStore) GetUser(userID string) (User, error) {
+	var user User
 
-	s.Users[userID] = &user
-	byteValue, err := json.MarshalIndent(s.Users, "", "  ")
+	if err := s.send(http.MethodGet, s.url("/users/%s", userID), nil, &user); err != nil {
+		return User{}, err
+	}
 
-	if err != nil {
-		return "Error Marshalling", fmt.Errorf("%s", err)
+	return user, nil
+}
+
+func (s ApiStore) GetUsers() ([]User, error) {
+	users := []User{}
+
+	if err := s.send(http.MethodGet, s.url("/users"), nil, &users); err != nil {
+		return nil, err
 	}
 
-	err = os.WriteFile(s.storePath+"users.json", byteValue, 0644)
+	return users, nil
+}
 
-	if err != nil {
-		return "Error Writing", fmt.Errorf("%s", err)
+func (s ApiStore) RenameUser(userID string, name string) error {
+	return s.send(http.MethodPatch, s.url("/users/%s", userID), struct{ Name string }{name}, nil)
+}
+
+func (s ApiStore) DeleteUser(userID string) error {
+	return s.send(http.MethodDelete, s.url("/users/%s", userID), nil, nil)
+}
+
+// SetPassword sends the password logged in with along as the current one,
+// which the server asks for when the store is logged in.
+func (s ApiStore) SetPassword(userID string, password string) error {
+	body := struct {
+		Password        string
+		CurrentPassword string `json:",omitempty"`
+	}{password, *s.password}
+	if err := s.send(http.MethodPatch, s.url("/users/%s", userID), body, nil); err != nil {
+		return err
 	}
 
-	return userID, nil
+	if *s.password != "" {
+		*s.password = password
+	}
+	return nil
 }
 
-func (s ApiStore) GetUser(id string) (User, error) {
-	users, err := s.getUsersFromJson()
-	if err != nil {
-		return User{}, fmt.Errorf("%s", err)
+func (s ApiStore) CreateAPIKey(userID string, key APIKey) (APIKey, string, error) {
+	var created struct {
+		Key    APIKey
+		Secret string
 	}
 
-	s.Users = users
-	if _, exists := s.Users[id]; !exists {
-		return User{}, fmt.Errorf("no user found with ID %s", id)
+	body := struct {
+		Name      string
+		Scope     Scope      `json:",omitempty"`
+		ExpiresAt *time.Time `json:",omitempty"`
+	}{key.Name, key.Scope, key.ExpiresAt}
+	if err := s.send(http.MethodPost, s.url("/users/%s/keys", userID), body, &created); err != nil {
+		return APIKey{}, "", err
 	}
 
-	return *s.Users[id], nil
+	return created.Key, created.Secret, nil
 }
 
-func (s ApiStore) GetTodoList(userID string, listID string) (TodoList, error) {
-	requestURL := fmt.Sprintf("http://localhost:%s/lists/%s/%s", s.serverPort, userID, listID)
-	req, err := http.NewRequest(http.MethodGet, requestURL, nil)
+func (s ApiStore) GetAPIKeys(userID string) ([]APIKey, error) {
+	keys := []APIKey{}
+
+	if err := s.send(http.MethodGet, s.url("/users/%s/keys", userID), nil, &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (s ApiStore) RevokeAPIKey(userID string, keyID string) error {
+	return s.send(http.MethodDelete, s.url("/users/%s/keys/%s", userID, keyID), nil, nil)
+}
+
+// CheckAPIKey asks the server about the key by making a request with it,
+// the store's own token is left alone.
+func (s ApiStore) CheckAPIKey(secret string) (APIKey, error) {
+	var key APIKey
+
+	withKey := ApiStore{serverPort: s.serverPort, token: &secret}
+	if err := withKey.send(http.MethodGet, withKey.url("/auth/key"), nil, &key); err != nil {
+		return APIKey{}, err
+	}
+
+	return key, nil
+}
+
+// CheckPassword logs in as the user on a store of its own, the store's own
+// token is left alone. The session the server hands out is given up again.
+func (s ApiStore) CheckPassword(userID string, password string) error {
+	var res loginResponse
+
+	check := ApiStore{serverPort: s.serverPort, token: new(string), password: new(string)}
+	body := struct{ UserID, Password string }{userID, password}
+	if err := check.send(http.MethodPost, check.url("/auth/login"), body, &res); err != nil {
+		return err
+	}
+
+	*check.token = res.Token
+	return check.Logout()
+}
+
+func (s ApiStore) url(format string, a ...any) string {
+	return fmt.Sprintf("http://localhost:%s", s.serverPort) + fmt.Sprintf(format, a...)
+}
+
+// send makes a request to the API, encoding body as JSON when it isn't nil and
+// decoding the response into out when it isn't nil.
+func (s ApiStore) send(method string, requestURL string, body any, out any) error {
+	var bodyReader io.Reader
+	if body != nil {
+		byteValue, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		bodyReader = bytes.NewReader(byteValue)
+	}
+
+	req, err := http.NewRequest(method, requestURL, bodyReader)
 	if err != nil {
-		return TodoList{}, err
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if *s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+*s.token)
 	}
 
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return TodoList{}, err
+		return err
 	}
+	defer res.Body.Close()
 
-	resBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		return TodoList{}, err
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return responseError(res)
+	}
+
+	if out == nil {
+		return nil
 	}
 
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func (s ApiStore) GetTodoList(userID string, listID string) (TodoList, error) {
 	var list TodoList
 
-	if err = json.Unmarshal(resBody, &list); err != nil {
-		log.Panic(err)
+	if err := s.send(http.MethodGet, s.url("/lists/%s/%s", userID, listID), nil, &list); err != nil {
 		return TodoList{}, err
 	}
 
@@ -117,97 +249,145 @@ func (s ApiStore) GetTodoList(userID string, listID string) (TodoList, error) {
 func (s ApiStore) GetTodoLists(userID string) (map[string]*TodoList, error) {
 	lists := make(map[string]*TodoList)
 
-	requestURL := fmt.Sprintf("http://localhost:%s/lists/%s", s.serverPort, userID)
-	req, err := http.NewRequest(http.MethodGet, requestURL, nil)
-	if err != nil {
+	if err := s.send(http.MethodGet, s.url("/lists/%s", userID), nil, &lists); err != nil {
 		return lists, err
 	}
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return lists, err
-	}
+	return lists, nil
+}
 
-	resBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		return lists, err
-	}
+func (s ApiStore) CreateTodoList(list TodoList, userID string) (id string, e error) {
+	var created TodoList
 
-	if err = json.Unmarshal(resBody, &lists); err != nil {
-		return lists, err
+	if err := s.send(http.MethodPost, s.url("/lists/%s", userID), list, &created); err != nil {
+		return "", err
 	}
 
-	return lists, nil
+	return created.ID, nil
 }
 
-func (s ApiStore) UpdateTodoList(list TodoList, userID string) error {
-	byteValue, err := json.MarshalIndent(list, "", "  ")
+func (s ApiStore) UpdateTodoList(list TodoList, userID string, actorID string) error {
+	return s.send(http.MethodPut, s.url("/lists/%s/%s", userID, list.ID), list, nil)
+}
 
-	bodyReader := bytes.NewReader(byteValue)
+func (s ApiStore) DeleteTodoList(userID string, listID string) error {
+	return s.send(http.MethodDelete, s.url("/lists/%s/%s", userID, listID), nil, nil)
+}
 
-	requestURL := fmt.Sprintf("http://localhost:%s/lists/%s", s.serverPort, userID)
-	req, err := http.NewRequest(http.MethodPost, requestURL, bodyReader)
-	if err != nil {
-		return err
-	}
+func (s ApiStore) AddTodo(todo Todo, listID string, userID string, actorID string) (id string, e error) {
+	var created Todo
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
+	if err := s.send(http.MethodPost, s.url("/lists/%s/%s/todos", userID, listID), todo, &created); err != nil {
+		return "", err
 	}
 
-	if res.StatusCode != 200 {
-		return fmt.Errorf(res.Status)
-	}
+	return created.ID, nil
+}
 
-	return nil
+func (s ApiStore) UpdateTodo(todo Todo, listID string, userID string, actorID string) error {
+	return s.send(http.MethodPatch, s.url("/lists/%s/%s/todos/%s", userID, listID, todo.ID), todo, nil)
 }
 
-func (s ApiStore) DeleteTodoList(userID string, listID string) error {
-	requestURL := fmt.Sprintf("http://localhost:%s/lists/%s/%s", s.serverPort, userID, listID)
-	req, err := http.NewRequest(http.MethodDelete, requestURL, nil)
-	if err != nil {
-		return err
-	}
+func (s ApiStore) DeleteTodo(userID string, listID string, todoID string, actorID string) error {
+	return s.send(http.MethodDelete, s.url("/lists/%s/%s/todos/%s", userID, listID, todoID), nil, nil)
+}
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
+func (s ApiStore) ToggleTodo(userID string, listID string, todoID string, actorID string) error {
+	return s.send(http.MethodPost, s.url("/lists/%s/%s/todos/%s/toggle", userID, listID, todoID), nil, nil)
+}
+
+func (s ApiStore) MoveTodoList(userID string, listID string, by int) error {
+	return s.send(http.MethodPost, s.url("/lists/%s/%s/move", userID, listID), struct{ By int }{by}, nil)
+}
+
+func (s ApiStore) MoveTodo(userID string, listID string, todoID string, by int, actorID string) error {
+	return s.send(http.MethodPost, s.url("/lists/%s/%s/todos/%s/move", userID, listID, todoID), struct{ By int }{by}, nil)
+}
+
+func (s ApiStore) FindTodos(userID string, query TodoQuery) ([]FoundTodo, error) {
+	found := []FoundTodo{}
+
+	params := url.Values{"tag": {query.Tag}}
+	if query.AssigneeID != "" {
+		params.Set("assignee", query.AssigneeID)
 	}
+	requestURL := s.url("/users/%s/todos?%s", userID, params.Encode())
+	if err := s.send(http.MethodGet, requestURL, nil, &found); err != nil {
+		return nil, err
+	}
+
+	return found, nil
+}
+
+func (s ApiStore) TodoHistory(userID string, listID string, todoID string) ([]HistoryEntry, error) {
+	entries := []HistoryEntry{}
 
-	if res.StatusCode != 200 {
-		return fmt.Errorf(res.Status)
+	if err := s.send(http.MethodGet, s.url("/lists/%s/%s/todos/%s/history", userID, listID, todoID), nil, &entries); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return entries, nil
 }
 
-func (s ApiStore) AddTodo(todo Todo, listID string, userID string) error {
-	list, err := s.GetTodoList(userID, listID)
-	if err != nil {
-		log.Panic(err)
-		return err
+func (s ApiStore) Trash(userID string) (Trash, error) {
+	var trash Trash
+
+	if err := s.send(http.MethodGet, s.url("/users/%s/trash", userID), nil, &trash); err != nil {
+		return Trash{}, err
 	}
-	list.Todos[todo.ID] = &todo
 
-	if err = s.UpdateTodoList(list, userID); err != nil {
-		return err
+	return trash, nil
+}
+
+func (s ApiStore) RestoreTodoList(userID string, listID string) error {
+	return s.send(http.MethodPost, s.url("/lists/%s/%s/restore", userID, listID), nil, nil)
+}
+
+func (s ApiStore) RestoreTodo(userID string, listID string, todoID string, actorID string) error {
+	return s.send(http.MethodPost, s.url("/lists/%s/%s/todos/%s/restore", userID, listID, todoID), nil, nil)
+}
+
+func (s ApiStore) PurgeTrash(userID string, before time.Time) error {
+	requestURL := s.url("/users/%s/trash?before=%s", userID, url.QueryEscape(before.Format(time.RFC3339Nano)))
+	return s.send(http.MethodDelete, requestURL, nil, nil)
+}
+
+func (s ApiStore) ShareTodoList(userID string, listID string, memberID string, role Role) error {
+	return s.send(http.MethodPut, s.url("/lists/%s/%s/members/%s", userID, listID, memberID), struct{ Role Role }{role}, nil)
+}
+
+func (s ApiStore) UnshareTodoList(userID string, listID string, memberID string) error {
+	return s.send(http.MethodDelete, s.url("/lists/%s/%s/members/%s", userID, listID, memberID), nil, nil)
+}
+
+func (s ApiStore) SharedTodoLists(userID string) ([]SharedList, error) {
+	shared := []SharedList{}
+
+	if err := s.send(http.MethodGet, s.url("/users/%s/shared", userID), nil, &shared); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return shared, nil
+}
+
+type apiError struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
 }
 
-func (s ApiStore) ToggleTodo(userID string, listID string, todoID string) error {
-	list, err := s.GetTodoList(userID, listID)
+// responseError turns the API's JSON error body back into a store error.
+func responseError(res *http.Response) error {
+	body, err := io.ReadAll(res.Body)
 	if err != nil {
-		return err
+		return fmt.Errorf("%s", res.Status)
 	}
 
-	list.Todos[todoID].Completed = !list.Todos[todoID].Completed
-
-	if err = s.UpdateTodoList(list, userID); err != nil {
-		return err
+	var apiErr apiError
+	if err = json.Unmarshal(body, &apiErr); err != nil || apiErr.Error.Message == "" {
+		return fmt.Errorf("%s", res.Status)
 	}
 
-	return nil
+	return ErrorFromCode(apiErr.Error.Code, apiErr.Error.Message)
 }
@@ -0,0 +1,47 @@
+package store
+
+import "time"
+
+// checkAssignee makes sure a todo in list is assigned to someone who can see
+// the list, its owner userID or one of its members.
+func checkAssignee(list *TodoList, todo Todo, userID string) error {
+	if todo.AssigneeID == "" || list.RoleOf(userID, todo.AssigneeID) != "" {
+		return nil
+	}
+	return errorf(ErrInvalidTodo, "todo with ID %s in list ID %s for user ID %s can't be assigned to user ID %s, who has no access to the list",
+		todo.ID, list.ID, userID, todo.AssigneeID)
+}
+
+// checkAssignees is checkAssignee for every todo of a list given to
+// CreateTodoList or UpdateTodoList, which is shared with members.
+func checkAssignees(list TodoList, members map[string]Role, userID string) error {
+	list.Members = members
+	for _, todo := range list.Todos {
+		if err := checkAssignee(&list, *todo, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unassign takes memberID off every todo of list they were assigned, when
+// they lose access to it. It stamps the todos changed, moves the list to its
+// next version when there are any and returns an entry by userID, the list's
+// owner, for each.
+func unassign(list *TodoList, memberID string, userID string, now time.Time) []HistoryEntry {
+	var entries []HistoryEntry
+	for _, todo := range SortTodos(list.Todos, ByPosition) {
+		if todo.AssigneeID != memberID {
+			continue
+		}
+		stored := *todo
+		todo.AssigneeID = ""
+		entry, _ := updated(stored, todo, list.ID, userID, now)
+		entries = append(entries, entry)
+	}
+
+	if len(entries) > 0 {
+		list.Version++
+	}
+	return entries
+}
@@ -0,0 +1,59 @@
+package store
+
+import "time"
+
+// DueStatus places a todo's due date relative to the current day.
+type DueStatus int
+
+const (
+	// NotDue is the status of todos without a due date and of completed
+	// todos, which are never overdue.
+	NotDue DueStatus = iota
+	Upcoming
+	DueToday
+	Overdue
+)
+
+func (d DueStatus) String() string {
+	switch d {
+	case Upcoming:
+		return "upcoming"
+	case DueToday:
+		return "due today"
+	case Overdue:
+		return "overdue"
+	default:
+		return ""
+	}
+}
+
+// DueStatus classifies the todo by calendar day in now's location, so a todo
+// due at any time today is DueToday until midnight and Overdue after that.
+func (t Todo) DueStatus(now time.Time) DueStatus {
+	if t.Due == nil || t.Completed {
+		return NotDue
+	}
+
+	today := startOfDay(now)
+	due := t.Due.In(now.Location())
+
+	switch {
+	case due.Before(today):
+		return Overdue
+	case due.Before(today.AddDate(0, 0, 1)):
+		return DueToday
+	default:
+		return Upcoming
+	}
+}
+
+// Started reports whether work on the todo may begin, true when it has no
+// start date.
+func (t Todo) Started(now time.Time) bool {
+	return t.Start == nil || !t.Start.After(now)
+}
+
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDueStatus(t *testing.T) {
+	loc := time.FixedZone("UTC-5", -5*60*60)
+	now := time.Date(2024, time.March, 15, 10, 0, 0, 0, loc)
+
+	at := func(t time.Time) *time.Time { return &t }
+
+	tests := []struct {
+		name string
+		todo Todo
+		want DueStatus
+	}{
+		{"no due date", Todo{}, NotDue},
+		{"yesterday", Todo{Due: at(now.AddDate(0, 0, -1))}, Overdue},
+		{"earlier today", Todo{Due: at(now.Add(-time.Hour))}, DueToday},
+		{"tonight", Todo{Due: at(time.Date(2024, time.March, 15, 23, 59, 0, 0, loc))}, DueToday},
+		{"tomorrow", Todo{Due: at(time.Date(2024, time.March, 16, 0, 0, 0, 0, loc))}, Upcoming},
+		// 02:00 UTC on the 16th is still the evening of the 15th in loc.
+		{"other zone", Todo{Due: at(time.Date(2024, time.March, 16, 2, 0, 0, 0, time.UTC))}, DueToday},
+		{"completed", Todo{Due: at(now.AddDate(0, 0, -1)), Completed: true}, NotDue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.todo.DueStatus(now); got != tt.want {
+				t.Errorf("got %q want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStarted(t *testing.T) {
+	now := time.Date(2024, time.March, 15, 10, 0, 0, 0, time.UTC)
+	later := now.Add(time.Minute)
+
+	if !(Todo{}).Started(now) {
+		t.Error("todo without a start date should count as started")
+	}
+	if (Todo{Start: &later}).Started(now) {
+		t.Error("todo starting later should not count as started")
+	}
+	if !(Todo{Start: &now}).Started(now) {
+		t.Error("todo starting now should count as started")
+	}
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrListNotFound = errors.New("list not found")
+	ErrTodoNotFound = errors.New("todo not found")
+	ErrKeyNotFound  = errors.New("API key not found")
+	// ErrMemberNotFound is a user a list isn't shared with.
+	ErrMemberNotFound = errors.New("member not found")
+	ErrConflict       = errors.New("conflict")
+	ErrInvalidTodo    = errors.New("invalid todo")
+	ErrInvalidUser    = errors.New("invalid user")
+	ErrInvalidKey     = errors.New("invalid API key")
+	ErrInvalidMember  = errors.New("invalid member")
+	// ErrUnauthorized is a wrong password, or a user without one, or an
+	// unknown or expired API key.
+	ErrUnauthorized = errors.New("unauthorized")
+)
+
+// Error carries a human readable message while still matching one of the
+// sentinel errors above with errors.Is.
+type Error struct {
+	Kind    error
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+func errorf(kind error, format string, a ...any) error {
+	return &Error{
+		Kind:    kind,
+		Message: fmt.Sprintf(format, a...),
+	}
+}
+
+func userNotFound(userID string) error {
+	return errorf(ErrUserNotFound, "no user found with ID %s", userID)
+}
+
+func listNotFound(userID string, listID string) error {
+	return errorf(ErrListNotFound, "list with ID %s doesn't exist for user ID %s", listID, userID)
+}
+
+// TodoNotFound is the error for a todo missing from a list, exported for
+// callers that look todos up in a list they got from a store.
+func TodoNotFound(userID string, listID string, todoID string) error {
+	return errorf(ErrTodoNotFound, "todo with ID %s in list ID %s for user ID %s does not exist", todoID, listID, userID)
+}
+
+var errorCodes = map[error]string{
+	ErrUserNotFound:   "user_not_found",
+	ErrListNotFound:   "list_not_found",
+	ErrTodoNotFound:   "todo_not_found",
+	ErrKeyNotFound:    "key_not_found",
+	ErrMemberNotFound: "member_not_found",
+	ErrConflict:       "conflict",
+	ErrInvalidTodo:    "invalid_todo",
+	ErrInvalidUser:    "invalid_user",
+	ErrInvalidKey:     "invalid_key",
+	ErrInvalidMember:  "invalid_member",
+	ErrUnauthorized:   "unauthorized",
+}
+
+// ErrorCode returns the code identifying err's kind over the API, or an empty
+// string when err doesn't match any of the sentinel errors.
+func ErrorCode(err error) string {
+	for kind, code := range errorCodes {
+		if errors.Is(err, kind) {
+			return code
+		}
+	}
+	return ""
+}
+
+// ErrorFromCode is the inverse of ErrorCode, unknown codes give a plain error.
+func ErrorFromCode(code string, message string) error {
+	for kind, c := range errorCodes {
+		if c == code {
+			return &Error{Kind: kind, Message: message}
+		}
+	}
+	return errors.New(message)
+}
@@ -0,0 +1,833 @@
+package store
+
+import (
+	"ToDo/store/internal/fsutil"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+type EventType string
+
+const (
+	UserCreated  EventType = "UserCreated"
+	UserRenamed  EventType = "UserRenamed"
+	UserDeleted  EventType = "UserDeleted"
+	PasswordSet  EventType = "PasswordSet"
+	KeyCreated   EventType = "KeyCreated"
+	KeyRevoked   EventType = "KeyRevoked"
+	ListCreated  EventType = "ListCreated"
+	ListUpdated  EventType = "ListUpdated"
+	ListDeleted  EventType = "ListDeleted"
+	TodoAdded    EventType = "TodoAdded"
+	TodoUpdated  EventType = "TodoUpdated"
+	TodoDeleted  EventType = "TodoDeleted"
+	TodoToggled  EventType = "TodoToggled"
+	ListMoved    EventType = "ListMoved"
+	TodoMoved    EventType = "TodoMoved"
+	ListRestored EventType = "ListRestored"
+	TodoRestored EventType = "TodoRestored"
+	TrashPurged  EventType = "TrashPurged"
+	ListShared   EventType = "ListShared"
+	ListUnshared EventType = "ListUnshared"
+)
+
+// Event is one change to the store. Only the fields relevant to Type are set.
+type Event struct {
+	Seq  int
+	Type EventType
+	// At is when the change was made, replaying the event stamps todos and
+	// their history with it.
+	At     time.Time
+	UserID string    `json:",omitempty"`
+	ListID string    `json:",omitempty"`
+	TodoID string    `json:",omitempty"`
+	KeyID  string    `json:",omitempty"`
+	User   *User     `json:",omitempty"`
+	Key    *APIKey   `json:",omitempty"`
+	List   *TodoList `json:",omitempty"`
+	Todo   *Todo     `json:",omitempty"`
+	By     int       `json:",omitempty"`
+	// Before is what a TrashPurged event purged up to.
+	Before *time.Time `json:",omitempty"`
+	// MemberID is who a list is shared with or taken away from, and Role
+	// what a ListShared event lets them do.
+	MemberID string `json:",omitempty"`
+	Role     Role   `json:",omitempty"`
+	// ActorID is who made a change to a list or its todos, see Store. It is
+	// empty in logs written before it was recorded, when that was UserID.
+	ActorID string `json:",omitempty"`
+}
+
+// actor returns who made the change the event records.
+func (e Event) actor() string {
+	if e.ActorID == "" {
+		return e.UserID
+	}
+	return e.ActorID
+}
+
+type snapshot struct {
+	Seq     int
+	Users   map[string]*User
+	History map[string][]HistoryEntry `json:",omitempty"`
+	Trash   map[string]*Trash         `json:",omitempty"`
+}
+
+const (
+	eventLogFile = "events.log"
+	snapshotFile = "snapshot.json"
+
+	DefaultSnapshotEvery = 1000
+)
+
+// EventLogStore appends every change as an Event to events.log, one JSON
+// record per line, and keeps the current state in memory. Every
+// snapshotEvery events the state is written to snapshot.json and the log is
+// started afresh. The directory is locked for as long as the store is open.
+type EventLogStore struct {
+	mu            sync.Mutex
+	dir           string
+	state         *InMemoryStore
+	log           *os.File
+	seq           int
+	sinceSnapshot int
+	snapshotEvery int
+	opts          []Option
+	unlock        func()
+	now           func() time.Time
+	retention     time.Duration
+	// at is the time the state stamps changes with: now when a change is
+	// made, the time of the event when it is replayed.
+	at time.Time
+}
+
+func NewEventLogStore(dir string, snapshotEvery int, opts ...Option) (*EventLogStore, error) {
+	if snapshotEvery <= 0 {
+		snapshotEvery = DefaultSnapshotEvery
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	unlock, err := lockFile(filepath.Join(dir, lockName), true)
+	if err != nil {
+		return nil, err
+	}
+
+	o := applyOptions(opts)
+	s := &EventLogStore{
+		dir:           dir,
+		snapshotEvery: snapshotEvery,
+		opts:          opts,
+		unlock:        unlock,
+		now:           o.now,
+		retention:     o.retention,
+	}
+
+	if err = s.load(); err != nil {
+		unlock()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *EventLogStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.log.Close()
+	s.unlock()
+	return err
+}
+
+// load rebuilds the state from the snapshot and the events logged after it,
+// dropping a final record that was only partly written. The state never
+// purges the trash itself, see expire.
+func (s *EventLogStore) load() error {
+	opts := append(slices.Clone(s.opts), WithClock(func() time.Time { return s.at }), WithRetention(0))
+	s.state = NewInMemoryStore(opts...)
+	s.seq = 0
+	s.sinceSnapshot = 0
+
+	byteValue, err := os.ReadFile(filepath.Join(s.dir, snapshotFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var snap snapshot
+		if err = json.Unmarshal(byteValue, &snap); err != nil {
+			return fmt.Errorf("reading %s: %w", snapshotFile, err)
+		}
+		for _, user := range snap.Users {
+			if user.TodoLists == nil {
+				user.TodoLists = make(map[string]*TodoList)
+			}
+			for _, list := range user.TodoLists {
+				if list.Todos == nil {
+					list.Todos = make(map[string]*Todo)
+				}
+			}
+			s.state.users[user.ID] = user
+		}
+		if snap.History != nil {
+			s.state.history = snap.History
+		}
+		if snap.Trash != nil {
+			s.state.trash = snap.Trash
+		}
+		s.seq = snap.Seq
+	}
+
+	logFile, err := os.OpenFile(filepath.Join(s.dir, eventLogFile), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+
+	good, err := s.replay(logFile)
+	if err != nil {
+		logFile.Close()
+		return err
+	}
+
+	if err = logFile.Truncate(good); err != nil {
+		logFile.Close()
+		return err
+	}
+	if _, err = logFile.Seek(good, io.SeekStart); err != nil {
+		logFile.Close()
+		return err
+	}
+
+	s.log = logFile
+	return nil
+}
+
+// replay applies every complete record in r and returns the offset just past
+// the last one.
+func (s *EventLogStore) replay(r io.Reader) (int64, error) {
+	reader := bufio.NewReader(r)
+	var good int64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// Anything after the last newline is a torn record.
+			return good, nil
+		}
+		if err != nil {
+			return good, err
+		}
+
+		var event Event
+		if err = json.Unmarshal(line, &event); err != nil {
+			if _, peekErr := reader.Peek(1); peekErr == io.EOF {
+				return good, nil
+			}
+			return good, fmt.Errorf("%s is corrupt at offset %d: %w", eventLogFile, good, err)
+		}
+
+		good += int64(len(line))
+
+		// Events already folded into the snapshot are still in the log if
+		// we crashed between writing the snapshot and resetting the log.
+		if event.Seq <= s.seq {
+			continue
+		}
+
+		if err = s.apply(event); err != nil {
+			return good, fmt.Errorf("replaying event %d: %w", event.Seq, err)
+		}
+		s.seq = event.Seq
+		s.sinceSnapshot++
+	}
+}
+
+func (s *EventLogStore) apply(event Event) error {
+	s.at = event.At
+
+	switch event.Type {
+	case UserCreated:
+		s.state.mu.Lock()
+		defer s.state.mu.Unlock()
+		return s.state.addUser(NewUser(event.User.ID, event.User.Name))
+	case UserRenamed:
+		s.state.mu.Lock()
+		defer s.state.mu.Unlock()
+		return s.state.renameUser(event.UserID, event.User.Name)
+	case UserDeleted:
+		return s.state.DeleteUser(event.UserID)
+	case PasswordSet:
+		s.state.mu.Lock()
+		defer s.state.mu.Unlock()
+		return s.state.setPasswordHash(event.UserID, event.User.PasswordHash)
+	case KeyCreated:
+		s.state.mu.Lock()
+		defer s.state.mu.Unlock()
+		return addAPIKey(s.state.users, *event.Key)
+	case KeyRevoked:
+		return s.state.RevokeAPIKey(event.UserID, event.KeyID)
+	case ListCreated:
+		return s.state.AddTodoList(*event.List, event.UserID)
+	case ListUpdated:
+		list := *event.List
+		list.Version = 0
+		s.state.mu.Lock()
+		defer s.state.mu.Unlock()
+		return s.state.updateTodoList(list, event.UserID, event.actor())
+	case ListDeleted:
+		return s.state.DeleteTodoList(event.UserID, event.ListID)
+	case TodoAdded:
+		s.state.mu.Lock()
+		defer s.state.mu.Unlock()
+		return s.state.addTodo(*event.Todo, event.ListID, event.UserID, event.actor())
+	case TodoUpdated:
+		return s.state.UpdateTodo(*event.Todo, event.ListID, event.UserID, event.actor())
+	case TodoDeleted:
+		return s.state.DeleteTodo(event.UserID, event.ListID, event.TodoID, event.actor())
+	case TodoToggled:
+		return s.state.ToggleTodo(event.UserID, event.ListID, event.TodoID, event.actor())
+	case ListMoved:
+		return s.state.MoveTodoList(event.UserID, event.ListID, event.By)
+	case TodoMoved:
+		return s.state.MoveTodo(event.UserID, event.ListID, event.TodoID, event.By, event.actor())
+	case ListRestored:
+		return s.state.RestoreTodoList(event.UserID, event.ListID)
+	case TodoRestored:
+		return s.state.RestoreTodo(event.UserID, event.ListID, event.TodoID, event.actor())
+	case TrashPurged:
+		return s.state.PurgeTrash(event.UserID, *event.Before)
+	case ListShared:
+		return s.state.ShareTodoList(event.UserID, event.ListID, event.MemberID, event.Role)
+	case ListUnshared:
+		return s.state.UnshareTodoList(event.UserID, event.ListID, event.MemberID)
+	default:
+		return fmt.Errorf("unknown event type %q", event.Type)
+	}
+}
+
+// record appends an event that has already been applied to the state. If it
+// can't be made durable the state is rebuilt from disk so it doesn't hold a
+// change that was never logged.
+func (s *EventLogStore) record(event Event) error {
+	event.Seq = s.seq + 1
+	event.At = s.at
+
+	byteValue, err := json.Marshal(event)
+	if err != nil {
+		return errors.Join(err, s.reload())
+	}
+	byteValue = append(byteValue, '\n')
+
+	if _, err = s.log.Write(byteValue); err != nil {
+		return errors.Join(err, s.reload())
+	}
+	if err = s.log.Sync(); err != nil {
+		return errors.Join(err, s.reload())
+	}
+
+	s.seq = event.Seq
+	s.sinceSnapshot++
+
+	// The event is durable whether or not compaction works, a failed
+	// compaction is simply tried again after the next event.
+	if s.sinceSnapshot >= s.snapshotEvery {
+		s.compact()
+	}
+	return nil
+}
+
+func (s *EventLogStore) reload() error {
+	s.log.Close()
+	return s.load()
+}
+
+// compact writes the state to snapshot.json and starts an empty log.
+func (s *EventLogStore) compact() error {
+	s.state.mu.RLock()
+	byteValue, err := json.MarshalIndent(snapshot{Seq: s.seq, Users: s.state.users, History: s.state.history, Trash: s.state.trash}, "", "  ")
+	s.state.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if err = fsutil.WriteFileAtomic(filepath.Join(s.dir, snapshotFile), byteValue, 0644); err != nil {
+		return err
+	}
+
+	if err = s.log.Truncate(0); err != nil {
+		return err
+	}
+	if _, err = s.log.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err = s.log.Sync(); err != nil {
+		return err
+	}
+
+	s.sinceSnapshot = 0
+	return nil
+}
+
+// Compact forces a snapshot regardless of how many events have been logged.
+func (s *EventLogStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.compact()
+}
+
+func (s *EventLogStore) CreateUser(username string) (id string, e error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.at = s.now()
+
+	userID, err := s.state.CreateUser(username)
+	if err != nil {
+		return "", err
+	}
+
+	user := NewUser(userID, username)
+	if err = s.record(Event{Type: UserCreated, UserID: userID, User: &user}); err != nil {
+		return "", err
+	}
+
+	return userID, nil
+}
+
+func (s *EventLogStore) GetUser(userID string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state.GetUser(userID)
+}
+
+func (s *EventLogStore) GetUsers() ([]User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state.GetUsers()
+}
+
+func (s *EventLogStore) RenameUser(userID string, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.at = s.now()
+
+	if err := s.state.RenameUser(userID, name); err != nil {
+		return err
+	}
+
+	return s.record(Event{Type: UserRenamed, UserID: userID, User: &User{ID: userID, Name: name}})
+}
+
+func (s *EventLogStore) DeleteUser(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.at = s.now()
+
+	if err := s.state.DeleteUser(userID); err != nil {
+		return err
+	}
+
+	return s.record(Event{Type: UserDeleted, UserID: userID})
+}
+
+// SetPassword logs the hash rather than the password so replaying the log
+// gives the same hash back.
+func (s *EventLogStore) SetPassword(userID string, password string) error {
+	hash, err := hashPassword(userID, password)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.at = s.now()
+
+	s.state.mu.Lock()
+	err = s.state.setPasswordHash(userID, hash)
+	s.state.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return s.record(Event{Type: PasswordSet, UserID: userID, User: &User{ID: userID, PasswordHash: hash}})
+}
+
+func (s *EventLogStore) CheckPassword(userID string, password string) error {
+	s.mu.Lock()
+	user, err := s.state.GetUser(userID)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return checkPassword(user, password)
+}
+
+// CreateAPIKey logs the key with its hash, the secret is never written
+// anywhere.
+func (s *EventLogStore) CreateAPIKey(userID string, key APIKey) (APIKey, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.at = s.now()
+
+	s.state.mu.Lock()
+	if _, exists := s.state.users[userID]; !exists {
+		s.state.mu.Unlock()
+		return APIKey{}, "", userNotFound(userID)
+	}
+	key, secret, err := newAPIKey(key, userID, s.state.ids.NewID(), s.at)
+	if err == nil {
+		err = addAPIKey(s.state.users, key)
+	}
+	s.state.mu.Unlock()
+	if err != nil {
+		return APIKey{}, "", err
+	}
+
+	if err = s.record(Event{Type: KeyCreated, UserID: userID, Key: &key}); err != nil {
+		return APIKey{}, "", err
+	}
+
+	key.Hash = nil
+	return key, secret, nil
+}
+
+func (s *EventLogStore) GetAPIKeys(userID string) ([]APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state.GetAPIKeys(userID)
+}
+
+func (s *EventLogStore) RevokeAPIKey(userID string, keyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.at = s.now()
+
+	if err := s.state.RevokeAPIKey(userID, keyID); err != nil {
+		return err
+	}
+
+	return s.record(Event{Type: KeyRevoked, UserID: userID, KeyID: keyID})
+}
+
+func (s *EventLogStore) CheckAPIKey(secret string) (APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state.mu.RLock()
+	defer s.state.mu.RUnlock()
+
+	return findAPIKey(s.state.users, secret, s.now())
+}
+
+func (s *EventLogStore) GetTodoList(userID string, listID string) (TodoList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state.GetTodoList(userID, listID)
+}
+
+func (s *EventLogStore) GetTodoLists(userID string) (map[string]*TodoList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state.GetTodoLists(userID)
+}
+
+func (s *EventLogStore) CreateTodoList(list TodoList, userID string) (id string, e error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.at = s.now()
+
+	listID, err := s.state.CreateTodoList(list, userID)
+	if err != nil {
+		return "", err
+	}
+
+	list, err = s.state.GetTodoList(userID, listID)
+	if err != nil {
+		return "", err
+	}
+
+	if err = s.record(Event{Type: ListCreated, UserID: userID, ListID: listID, List: &list}); err != nil {
+		return "", err
+	}
+
+	return listID, nil
+}
+
+func (s *EventLogStore) UpdateTodoList(list TodoList, userID string, actorID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.at = s.now()
+
+	if err := s.state.UpdateTodoList(list, userID, actorID); err != nil {
+		return err
+	}
+
+	// Record the list as stored, with the IDs its new todos were given.
+	list, err := s.state.GetTodoList(userID, list.ID)
+	if err != nil {
+		return err
+	}
+	return s.record(Event{Type: ListUpdated, UserID: userID, ActorID: actorID, ListID: list.ID, List: &list})
+}
+
+func (s *EventLogStore) DeleteTodoList(userID string, listID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.at = s.now()
+
+	if err := s.expire(userID); err != nil {
+		return err
+	}
+	if err := s.state.DeleteTodoList(userID, listID); err != nil {
+		return err
+	}
+
+	return s.record(Event{Type: ListDeleted, UserID: userID, ListID: listID})
+}
+
+func (s *EventLogStore) AddTodo(todo Todo, listID string, userID string, actorID string) (id string, e error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.at = s.now()
+
+	todoID, err := s.state.AddTodo(todo, listID, userID, actorID)
+	if err != nil {
+		return "", err
+	}
+
+	// Record the todo as stored, with the ID and position it was given.
+	list, err := s.state.GetTodoList(userID, listID)
+	if err != nil {
+		return "", err
+	}
+	todo = *list.Todos[todoID]
+
+	if err = s.record(Event{Type: TodoAdded, UserID: userID, ActorID: actorID, ListID: listID, TodoID: todoID, Todo: &todo}); err != nil {
+		return "", err
+	}
+
+	return todoID, nil
+}
+
+func (s *EventLogStore) UpdateTodo(todo Todo, listID string, userID string, actorID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.at = s.now()
+
+	if err := s.state.UpdateTodo(todo, listID, userID, actorID); err != nil {
+		return err
+	}
+
+	return s.record(Event{Type: TodoUpdated, UserID: userID, ActorID: actorID, ListID: listID, TodoID: todo.ID, Todo: &todo})
+}
+
+func (s *EventLogStore) DeleteTodo(userID string, listID string, todoID string, actorID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.at = s.now()
+
+	if err := s.expire(userID); err != nil {
+		return err
+	}
+	if err := s.state.DeleteTodo(userID, listID, todoID, actorID); err != nil {
+		return err
+	}
+
+	return s.record(Event{Type: TodoDeleted, UserID: userID, ActorID: actorID, ListID: listID, TodoID: todoID})
+}
+
+func (s *EventLogStore) ToggleTodo(userID string, listID string, todoID string, actorID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.at = s.now()
+
+	if err := s.state.ToggleTodo(userID, listID, todoID, actorID); err != nil {
+		return err
+	}
+
+	return s.record(Event{Type: TodoToggled, UserID: userID, ActorID: actorID, ListID: listID, TodoID: todoID})
+}
+
+func (s *EventLogStore) MoveTodoList(userID string, listID string, by int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.at = s.now()
+
+	if err := s.state.MoveTodoList(userID, listID, by); err != nil {
+		return err
+	}
+
+	return s.record(Event{Type: ListMoved, UserID: userID, ListID: listID, By: by})
+}
+
+func (s *EventLogStore) MoveTodo(userID string, listID string, todoID string, by int, actorID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.at = s.now()
+
+	if err := s.state.MoveTodo(userID, listID, todoID, by, actorID); err != nil {
+		return err
+	}
+
+	return s.record(Event{Type: TodoMoved, UserID: userID, ActorID: actorID, ListID: listID, TodoID: todoID, By: by})
+}
+
+func (s *EventLogStore) FindTodos(userID string, query TodoQuery) ([]FoundTodo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state.FindTodos(userID, query)
+}
+
+func (s *EventLogStore) TodoHistory(userID string, listID string, todoID string) ([]HistoryEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state.TodoHistory(userID, listID, todoID)
+}
+
+func (s *EventLogStore) Trash(userID string) (Trash, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.at = s.now()
+
+	if err := s.expire(userID); err != nil {
+		return Trash{}, err
+	}
+	return s.state.Trash(userID)
+}
+
+func (s *EventLogStore) RestoreTodoList(userID string, listID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.at = s.now()
+
+	if err := s.expire(userID); err != nil {
+		return err
+	}
+	if err := s.state.RestoreTodoList(userID, listID); err != nil {
+		return err
+	}
+
+	return s.record(Event{Type: ListRestored, UserID: userID, ListID: listID})
+}
+
+func (s *EventLogStore) RestoreTodo(userID string, listID string, todoID string, actorID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.at = s.now()
+
+	if err := s.expire(userID); err != nil {
+		return err
+	}
+	if err := s.state.RestoreTodo(userID, listID, todoID, actorID); err != nil {
+		return err
+	}
+
+	return s.record(Event{Type: TodoRestored, UserID: userID, ActorID: actorID, ListID: listID, TodoID: todoID})
+}
+
+func (s *EventLogStore) PurgeTrash(userID string, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.at = s.now()
+
+	if err := s.state.PurgeTrash(userID, before); err != nil {
+		return err
+	}
+
+	return s.record(Event{Type: TrashPurged, UserID: userID, Before: &before})
+}
+
+func (s *EventLogStore) ShareTodoList(userID string, listID string, memberID string, role Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.at = s.now()
+
+	if err := s.state.ShareTodoList(userID, listID, memberID, role); err != nil {
+		return err
+	}
+
+	return s.record(Event{Type: ListShared, UserID: userID, ListID: listID, MemberID: memberID, Role: role})
+}
+
+func (s *EventLogStore) UnshareTodoList(userID string, listID string, memberID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.at = s.now()
+
+	if err := s.state.UnshareTodoList(userID, listID, memberID); err != nil {
+		return err
+	}
+
+	return s.record(Event{Type: ListUnshared, UserID: userID, ListID: listID, MemberID: memberID})
+}
+
+func (s *EventLogStore) SharedTodoLists(userID string) ([]SharedList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state.SharedTodoLists(userID)
+}
+
+// expire purges what has been in the user's trash for longer than the
+// retention. The purge is logged like any other so replaying the log gives
+// the same state whatever the retention is then.
+func (s *EventLogStore) expire(userID string) error {
+	if s.retention <= 0 {
+		return nil
+	}
+
+	before := s.at.Add(-s.retention)
+	s.state.mu.Lock()
+	purged := s.state.purge(userID, before)
+	s.state.mu.Unlock()
+	if !purged {
+		return nil
+	}
+
+	return s.record(Event{Type: TrashPurged, UserID: userID, Before: &before})
+}
+
+// Events returns the events logged since the last snapshot, oldest first.
+func (s *EventLogStore) Events() ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byteValue, err := os.ReadFile(filepath.Join(s.dir, eventLogFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	for _, line := range bytes.Split(byteValue, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+
+		var event Event
+		if err = json.Unmarshal(line, &event); err != nil {
+			return events, err
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
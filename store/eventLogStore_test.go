@@ -0,0 +1,448 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// populated holds the IDs the store picked in populateEventLogStore.
+type populated struct {
+	userID string
+	listID string
+	milk   string
+	bread  string
+}
+
+func populateEventLogStore(t *testing.T, store *EventLogStore) populated {
+	t.Helper()
+
+	var p populated
+	var err error
+
+	if p.userID, err = store.CreateUser("Steve"); err != nil {
+		t.Fatal(err)
+	}
+	if p.listID, err = store.CreateTodoList(NewTodoList("", "groceries"), p.userID); err != nil {
+		t.Fatal(err)
+	}
+	if p.milk, err = store.AddTodo(Todo{Title: "milk"}, p.listID, p.userID, p.userID); err != nil {
+		t.Fatal(err)
+	}
+	if p.bread, err = store.AddTodo(Todo{Title: "bread"}, p.listID, p.userID, p.userID); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.ToggleTodo(p.userID, p.listID, p.milk, p.userID); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func assertPopulated(t *testing.T, store *EventLogStore, p populated) {
+	t.Helper()
+
+	list, err := store.GetTodoList(p.userID, p.listID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list.Todos) != 2 {
+		t.Fatalf("got %d todos want 2", len(list.Todos))
+	}
+	if !list.Todos[p.milk].Completed {
+		t.Errorf("got milk incomplete want complete")
+	}
+	if list.Todos[p.bread].Completed {
+		t.Errorf("got bread complete want incomplete")
+	}
+	if list.Version != 4 {
+		t.Errorf("got version %d want 4", list.Version)
+	}
+}
+
+func TestEventLogStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewEventLogStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := populateEventLogStore(t, store)
+	store.Close()
+
+	store, err = NewEventLogStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	assertPopulated(t, store, p)
+
+	events, err := store.Events()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []EventType{UserCreated, ListCreated, TodoAdded, TodoAdded, TodoToggled}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events want %d", len(events), len(want))
+	}
+	for i, event := range events {
+		if event.Type != want[i] || event.Seq != i+1 {
+			t.Errorf("event %d: got %s #%d want %s #%d", i, event.Type, event.Seq, want[i], i+1)
+		}
+	}
+}
+
+func TestEventLogStoreReplaysNewTodoIDs(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewEventLogStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := populateEventLogStore(t, store)
+
+	list, err := store.GetTodoList(p.userID, p.listID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list.Todos["eggs"] = &Todo{ID: "eggs", Title: "eggs"}
+	if err = store.UpdateTodoList(list, p.userID, p.userID); err != nil {
+		t.Fatal(err)
+	}
+	want, err := store.GetTodoList(p.userID, p.listID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = NewEventLogStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	got, err := store.GetTodoList(p.userID, p.listID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Todos) != 3 || got.Todos["eggs"] != nil {
+		t.Fatalf("got todos %v after replay want eggs under an ID the store picked", got.Todos)
+	}
+	for id := range want.Todos {
+		if got.Todos[id] == nil {
+			t.Errorf("todo %s is gone after replay", id)
+		}
+	}
+}
+
+func TestEventLogStoreTornRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewEventLogStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := populateEventLogStore(t, store)
+	store.Close()
+
+	logPath := filepath.Join(dir, eventLogFile)
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"Seq":6,"Type":"TodoToggled","UserID":"00`)
+	f.Close()
+
+	store, err = NewEventLogStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	assertPopulated(t, store, p)
+
+	if err = store.ToggleTodo(p.userID, p.listID, p.bread, p.userID); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := store.Events()
+	if err != nil {
+		t.Fatalf("log not repaired: %v", err)
+	}
+	if len(events) != 6 || events[5].Seq != 6 {
+		t.Errorf("got %d events want 6 ending at seq 6", len(events))
+	}
+}
+
+func TestEventLogStoreCompaction(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewEventLogStore(dir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := populateEventLogStore(t, store)
+
+	events, err := store.Events()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Errorf("got %d events since the snapshot want 2", len(events))
+	}
+	store.Close()
+
+	store, err = NewEventLogStore(dir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	assertPopulated(t, store, p)
+}
+
+func TestEventLogStoreSkipsEventsInSnapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewEventLogStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := populateEventLogStore(t, store)
+
+	logged, err := os.ReadFile(filepath.Join(dir, eventLogFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = store.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// As if we crashed after writing the snapshot but before the log was reset.
+	if err = os.WriteFile(filepath.Join(dir, eventLogFile), logged, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = NewEventLogStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	assertPopulated(t, store, p)
+}
+
+func TestEventLogStoreReplaysTimes(t *testing.T) {
+	dir := t.TempDir()
+
+	now := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+
+	store, err := NewEventLogStore(dir, 0, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := populateEventLogStore(t, store)
+
+	want, err := store.TodoHistory(p.userID, p.listID, p.milk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantList, err := store.GetTodoList(p.userID, p.listID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	for _, compact := range []bool{false, true} {
+		// Reopened with the real clock, the times must come from the log.
+		store, err = NewEventLogStore(dir, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := store.TodoHistory(p.userID, p.listID, p.milk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("compact %t: got history %+v want %+v", compact, got, want)
+		}
+
+		list, err := store.GetTodoList(p.userID, p.listID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		milk, wantMilk := list.Todos[p.milk], wantList.Todos[p.milk]
+		if !milk.UpdatedAt.Equal(wantMilk.UpdatedAt) || milk.CompletedAt == nil || !milk.CompletedAt.Equal(*wantMilk.CompletedAt) {
+			t.Errorf("compact %t: got milk %+v want %+v", compact, milk, wantMilk)
+		}
+
+		if compact {
+			store.Close()
+			break
+		}
+		if err = store.Compact(); err != nil {
+			t.Fatal(err)
+		}
+		store.Close()
+	}
+}
+
+func TestEventLogStoreReplaysPurge(t *testing.T) {
+	dir := t.TempDir()
+
+	now := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	store, err := NewEventLogStore(dir, 0, WithClock(func() time.Time { return now }), WithRetention(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := populateEventLogStore(t, store)
+
+	if err = store.DeleteTodoList(p.userID, p.listID); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(2 * time.Hour)
+	if _, err = store.Trash(p.userID); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// Reopened keeping the trash forever, the purge must come from the log.
+	store, err = NewEventLogStore(dir, 0, WithRetention(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	trash, err := store.Trash(p.userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash.Lists) != 0 {
+		t.Errorf("got %+v want the purge replayed", trash.Lists)
+	}
+}
+
+func TestEventLogStoreReplaysPassword(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewEventLogStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := populateEventLogStore(t, store)
+
+	if err = store.SetPassword(p.userID, "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = NewEventLogStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if err = store.CheckPassword(p.userID, "correct horse"); err != nil {
+		t.Errorf("CheckPassword after replay: %v", err)
+	}
+}
+
+func TestEventLogStoreReplaysAPIKeys(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewEventLogStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := populateEventLogStore(t, store)
+
+	_, kept, err := store.CreateAPIKey(p.userID, APIKey{Name: "ci"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, revokedSecret, err := store.CreateAPIKey(p.userID, APIKey{Name: "backup"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.RevokeAPIKey(p.userID, revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = NewEventLogStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if _, err = store.CheckAPIKey(kept); err != nil {
+		t.Errorf("CheckAPIKey after replay: %v", err)
+	}
+	if _, err = store.CheckAPIKey(revokedSecret); err == nil {
+		t.Error("the revoked key works after replay")
+	}
+}
+
+func TestEventLogStoreReplaysSharing(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewEventLogStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := populateEventLogStore(t, store)
+
+	editor, err := store.CreateUser("Editor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	viewer, err := store.CreateUser("Viewer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for memberID, role := range map[string]Role{editor: RoleEditor, viewer: RoleViewer} {
+		if err = store.ShareTodoList(p.userID, p.listID, memberID, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = store.UnshareTodoList(p.userID, p.listID, viewer); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.ToggleTodo(p.userID, p.listID, p.bread, editor); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = NewEventLogStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	list, err := store.GetTodoList(p.userID, p.listID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Members) != 1 || list.Members[editor] != RoleEditor {
+		t.Errorf("got members %v after replay want only the editor", list.Members)
+	}
+
+	history, err := store.TodoHistory(p.userID, p.listID, p.bread)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].UserID != p.userID || history[1].UserID != editor {
+		t.Errorf("got history %+v after replay want the owner adding bread and the editor completing it", history)
+	}
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"slices"
+	"time"
+)
+
+// Action is the kind of change a HistoryEntry records.
+type Action string
+
+const (
+	ActionCreated   Action = "created"
+	ActionUpdated   Action = "updated"
+	ActionCompleted Action = "completed"
+	ActionReopened  Action = "reopened"
+	ActionMoved     Action = "moved"
+	ActionDeleted   Action = "deleted"
+	ActionRestored  Action = "restored"
+)
+
+// HistoryEntry is one change to a todo: who made it, when and to what.
+type HistoryEntry struct {
+	ListID string
+	TodoID string
+	// UserID is the user who made the change.
+	UserID string
+	At     time.Time
+	Action Action
+	// Fields names the fields an update changed, such as "Title" or "Due".
+	Fields []string `json:",omitempty"`
+}
+
+// historyKey identifies the history of one todo of a user.
+func historyKey(userID string, listID string, todoID string) string {
+	return userID + "/" + listID + "/" + todoID
+}
+
+// created stamps a todo that is being added and returns its first entry.
+func created(todo *Todo, listID string, userID string, now time.Time) HistoryEntry {
+	todo.CreatedAt = now
+	todo.UpdatedAt = now
+	todo.CompletedAt = nil
+	todo.DeletedAt = nil
+	if todo.Completed {
+		todo.CompletedAt = &now
+	}
+
+	return HistoryEntry{ListID: listID, TodoID: todo.ID, UserID: userID, At: now, Action: ActionCreated}
+}
+
+// updated carries the timestamps of stored over to todo, which replaces it,
+// and returns the entry for what changed or false when nothing did.
+func updated(stored Todo, todo *Todo, listID string, userID string, now time.Time) (HistoryEntry, bool) {
+	todo.CreatedAt = stored.CreatedAt
+	todo.UpdatedAt = stored.UpdatedAt
+	todo.CompletedAt = stored.CompletedAt
+	todo.DeletedAt = nil
+
+	fields := changedFields(stored, *todo)
+	if len(fields) == 0 {
+		return HistoryEntry{}, false
+	}
+
+	todo.UpdatedAt = now
+	action := ActionUpdated
+	if todo.Completed != stored.Completed {
+		todo.CompletedAt = nil
+		if todo.Completed {
+			todo.CompletedAt = &now
+		}
+		if len(fields) == 1 {
+			action = completion(*todo)
+		}
+	}
+
+	return HistoryEntry{ListID: listID, TodoID: todo.ID, UserID: userID, At: now, Action: action, Fields: fields}, true
+}
+
+// updatedList stamps the todos of list, which replaces stored, returning an
+// entry for each todo that was added or changed.
+func updatedList(stored *TodoList, list *TodoList, userID string, now time.Time) []HistoryEntry {
+	var entries []HistoryEntry
+	for _, todo := range SortTodos(list.Todos, ByPosition) {
+		old, exists := stored.Todos[todo.ID]
+		if !exists {
+			entries = append(entries, created(todo, list.ID, userID, now))
+			continue
+		}
+		if entry, changed := updated(*old, todo, list.ID, userID, now); changed {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// moved stamps a todo moved by MoveTodo and returns the entry for it.
+func moved(todo *Todo, listID string, userID string, now time.Time) HistoryEntry {
+	todo.UpdatedAt = now
+	return HistoryEntry{ListID: listID, TodoID: todo.ID, UserID: userID, At: now, Action: ActionMoved}
+}
+
+func completion(todo Todo) Action {
+	if todo.Completed {
+		return ActionCompleted
+	}
+	return ActionReopened
+}
+
+// changedFields names the fields the caller can set that differ between a
+// and b. Fields the store maintains, like Position, aren't compared.
+func changedFields(a Todo, b Todo) []string {
+	var fields []string
+	add := func(name string, changed bool) {
+		if changed {
+			fields = append(fields, name)
+		}
+	}
+
+	add("ParentID", a.ParentID != b.ParentID)
+	add("Title", a.Title != b.Title)
+	add("Notes", a.Notes != b.Notes)
+	add("Completed", a.Completed != b.Completed)
+	add("Priority", a.Priority != b.Priority)
+	add("Tags", !slices.Equal(a.Tags, b.Tags))
+	add("Start", !equalTimes(a.Start, b.Start))
+	add("Due", !equalTimes(a.Due, b.Due))
+	add("Recurrence", a.Recurrence != b.Recurrence)
+	add("TimeZone", a.TimeZone != b.TimeZone)
+	add("AssigneeID", a.AssigneeID != b.AssigneeID)
+	return fields
+}
+
+func equalTimes(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
@@ -0,0 +1,151 @@
+package store
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// IDGenerator hands out the IDs stores assign to users, lists and todos.
+// Implementations must be safe for concurrent use.
+type IDGenerator interface {
+	NewID() string
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDGenerator produces 26 character ULIDs: a millisecond timestamp followed
+// by 80 random bits, encoded so IDs sort in the order they were made. IDs
+// made within the same millisecond increment the random part to stay sorted.
+type ULIDGenerator struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	lastMs  uint64
+	lastRnd [10]byte
+}
+
+func NewULIDGenerator() *ULIDGenerator {
+	return &ULIDGenerator{now: time.Now}
+}
+
+func (g *ULIDGenerator) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := uint64(g.now().UnixMilli())
+
+	if ms <= g.lastMs {
+		ms = g.lastMs
+		if !increment(g.lastRnd[:]) {
+			// The random part overflowed, borrow the next millisecond.
+			ms++
+			rand.Read(g.lastRnd[:])
+		}
+	} else {
+		rand.Read(g.lastRnd[:])
+	}
+	g.lastMs = ms
+
+	var id [16]byte
+	for i := 0; i < 6; i++ {
+		id[i] = byte(ms >> (40 - 8*i))
+	}
+	copy(id[6:], g.lastRnd[:])
+
+	return encodeULID(id)
+}
+
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeULID(id [16]byte) string {
+	var out [26]byte
+
+	// 128 bits in 26 characters of 5 bits, the first character holds 3.
+	var acc uint64
+	bits := 0
+	pos := 25
+	for i := len(id) - 1; i >= 0; i-- {
+		acc |= uint64(id[i]) << bits
+		bits += 8
+		for bits >= 5 && pos >= 0 {
+			out[pos] = crockford[acc&31]
+			acc >>= 5
+			bits -= 5
+			pos--
+		}
+	}
+	if pos >= 0 {
+		out[pos] = crockford[acc&31]
+	}
+
+	return string(out[:])
+}
+
+// SequenceGenerator counts up from 1, formatting IDs as 0001, 0002 and so on.
+// It starts over whenever it is created so it is only suitable for tests and
+// other throwaway stores.
+type SequenceGenerator struct {
+	mu   sync.Mutex
+	next int
+}
+
+func NewSequenceGenerator() *SequenceGenerator {
+	return &SequenceGenerator{next: 1}
+}
+
+func (g *SequenceGenerator) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	id := fmt.Sprintf("%04d", g.next)
+	g.next++
+	return id
+}
+
+type Option func(*options)
+
+type options struct {
+	ids       IDGenerator
+	now       func() time.Time
+	retention time.Duration
+}
+
+// WithIDGenerator makes a store assign IDs from g instead of ULIDs.
+func WithIDGenerator(g IDGenerator) Option {
+	return func(o *options) {
+		o.ids = g
+	}
+}
+
+// WithClock makes a store take the time it stamps todos with from now instead
+// of time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
+
+// WithRetention makes a store purge what has been in the trash longer than d
+// instead of DefaultRetention. Zero or less keeps it until purged by hand.
+func WithRetention(d time.Duration) Option {
+	return func(o *options) {
+		o.retention = d
+	}
+}
+
+func applyOptions(opts []Option) options {
+	o := options{ids: NewULIDGenerator(), now: time.Now, retention: DefaultRetention}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestULIDGeneratorSortable(t *testing.T) {
+	g := NewULIDGenerator()
+
+	ids := make([]string, 1000)
+	seen := make(map[string]bool)
+	for i := range ids {
+		ids[i] = g.NewID()
+
+		if len(ids[i]) != 26 {
+			t.Fatalf("got ID %q of length %d want 26", ids[i], len(ids[i]))
+		}
+		if strings.Trim(ids[i], crockford) != "" {
+			t.Fatalf("got ID %q with characters outside %s", ids[i], crockford)
+		}
+		if seen[ids[i]] {
+			t.Fatalf("got ID %q twice", ids[i])
+		}
+		seen[ids[i]] = true
+	}
+
+	if !sort.StringsAreSorted(ids) {
+		t.Error("IDs are not in the order they were made")
+	}
+}
+
+func TestULIDGeneratorClockGoesBack(t *testing.T) {
+	now := time.UnixMilli(1_700_000_000_000)
+	g := &ULIDGenerator{now: func() time.Time { return now }}
+
+	first := g.NewID()
+	now = now.Add(-time.Second)
+	second := g.NewID()
+
+	if second <= first {
+		t.Errorf("got %q after %q want it to sort later", second, first)
+	}
+}
+
+func TestSequenceGenerator(t *testing.T) {
+	g := NewSequenceGenerator()
+
+	for _, want := range []string{"0001", "0002", "0003"} {
+		if got := g.NewID(); got != want {
+			t.Errorf("got %q want %q", got, want)
+		}
+	}
+}
+
+func TestStoreUsesIDGenerator(t *testing.T) {
+	s := NewInMemoryStore(WithIDGenerator(NewSequenceGenerator()))
+
+	userID, _ := s.CreateUser("Steve")
+	listID, _ := s.CreateTodoList(NewTodoList("", "groceries"), userID)
+	todoID, _ := s.AddTodo(Todo{Title: "milk"}, listID, userID, userID)
+
+	got := []string{userID, listID, todoID}
+	want := []string{"0001", "0002", "0003"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got IDs %v want %v", got, want)
+			break
+		}
+	}
+}
@@ -1,74 +1,765 @@
 package store
 
-import "fmt"
+import (
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
 
 type InMemoryStore struct {
+	mu    sync.RWMutex
 	users map[string]*User
+	// history holds the entries of every todo keyed by historyKey.
+	history map[string][]HistoryEntry
+	// trash holds what each user deleted keyed by user ID.
+	trash     map[string]*Trash
+	ids       IDGenerator
+	now       func() time.Time
+	retention time.Duration
 }
 
-func NewInMemoryStore() *InMemoryStore {
+func NewInMemoryStore(opts ...Option) *InMemoryStore {
+	o := applyOptions(opts)
+
 	return &InMemoryStore{
-		users: make(map[string]*User),
+		users:     make(map[string]*User),
+		history:   make(map[string][]HistoryEntry),
+		trash:     make(map[string]*Trash),
+		ids:       o.ids,
+		now:       o.now,
+		retention: o.retention,
 	}
 }
 
 func (s *InMemoryStore) CreateUser(username string) (id string, e error) {
-	userID := fmt.Sprintf("%04d", len(s.users)+1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := checkName(s.users, "", username); err != nil {
+		return "", err
+	}
+
+	userID := s.ids.NewID()
 	user := NewUser(userID, username)
 
 	err := s.addUser(user)
 	if err != nil {
-		return "", fmt.Errorf("%s", err.Error())
+		return "", err
 	}
 	return userID, nil
 }
 
 func (s *InMemoryStore) addUser(user User) error {
 	if _, exists := s.users[user.ID]; exists {
-		return fmt.Errorf("user with ID %s already exists", user.ID)
+		return errorf(ErrConflict, "user with ID %s already exists", user.ID)
 	}
 	s.users[user.ID] = &user
 	return nil
 }
 
 func (s *InMemoryStore) GetUser(userID string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, exists := s.users[userID]
+	if !exists {
+		return User{}, userNotFound(userID)
+	}
+
+	return cloneUser(*user), nil
+}
+
+func (s *InMemoryStore) GetUsers() ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return listUsers(s.users), nil
+}
+
+func (s *InMemoryStore) RenameUser(userID string, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.users[userID]; !exists {
+		return userNotFound(userID)
+	}
+	if err := checkName(s.users, userID, name); err != nil {
+		return err
+	}
+
+	return s.renameUser(userID, name)
+}
+
+// renameUser is RenameUser without the check that the name is free, for
+// replaying renames from before names had to be. Callers must hold s.mu.
+func (s *InMemoryStore) renameUser(userID string, name string) error {
+	user, exists := s.users[userID]
+	if !exists {
+		return userNotFound(userID)
+	}
+
+	user.Name = name
+	return nil
+}
+
+func (s *InMemoryStore) DeleteUser(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.users[userID]; !exists {
+		return userNotFound(userID)
+	}
+
+	delete(s.users, userID)
+	delete(s.trash, userID)
+	for key := range s.history {
+		if strings.HasPrefix(key, userID+"/") {
+			delete(s.history, key)
+		}
+	}
+	now := s.now()
+	for ownerID, user := range s.users {
+		_, entries := forgetMember(slices.Collect(maps.Values(user.TodoLists)), ownerID, userID, now)
+		s.record(ownerID, entries...)
+	}
+	for ownerID, trash := range s.trash {
+		_, entries := forgetMember(trash.listPointers(), ownerID, userID, now)
+		s.record(ownerID, entries...)
+	}
+	return nil
+}
+
+func (s *InMemoryStore) SetPassword(userID string, password string) error {
+	hash, err := hashPassword(userID, password)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.setPasswordHash(userID, hash)
+}
+
+// setPasswordHash is SetPassword once the password is hashed, callers must
+// hold s.mu.
+func (s *InMemoryStore) setPasswordHash(userID string, hash []byte) error {
+	user, exists := s.users[userID]
+	if !exists {
+		return userNotFound(userID)
+	}
+
+	user.PasswordHash = hash
+	return nil
+}
+
+func (s *InMemoryStore) CheckPassword(userID string, password string) error {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return err
+	}
+
+	return checkPassword(user, password)
+}
+
+func (s *InMemoryStore) CreateAPIKey(userID string, key APIKey) (APIKey, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if _, exists := s.users[userID]; !exists {
-		return User{}, fmt.Errorf("no user found with ID %s", userID)
+		return APIKey{}, "", userNotFound(userID)
+	}
+
+	key, secret, err := newAPIKey(key, userID, s.ids.NewID(), s.now())
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	if err = addAPIKey(s.users, key); err != nil {
+		return APIKey{}, "", err
+	}
+
+	key.Hash = nil
+	return key, secret, nil
+}
+
+func (s *InMemoryStore) GetAPIKeys(userID string) ([]APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, exists := s.users[userID]
+	if !exists {
+		return nil, userNotFound(userID)
+	}
+
+	return listAPIKeys(*user), nil
+}
+
+func (s *InMemoryStore) RevokeAPIKey(userID string, keyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return revokeAPIKey(s.users, userID, keyID)
+}
+
+func (s *InMemoryStore) CheckAPIKey(secret string) (APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return findAPIKey(s.users, secret, s.now())
+}
+
+func (s *InMemoryStore) GetTodoLists(userID string) (map[string]*TodoList, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, exists := s.users[userID]
+	if !exists {
+		return nil, userNotFound(userID)
+	}
+
+	return cloneTodoLists(user.TodoLists), nil
+}
+
+func (s *InMemoryStore) GetTodoList(userID string, listID string) (TodoList, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list, err := s.todoList(userID, listID)
+	if err != nil {
+		return TodoList{}, err
 	}
 
-	return *s.users[userID], nil
+	return cloneTodoList(*list), nil
 }
 
 func (s *InMemoryStore) AddTodoList(list TodoList, userID string) error {
-	user := s.users[userID]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.users[userID]
+	if !exists {
+		return userNotFound(userID)
+	}
+
 	if _, exists := user.TodoLists[list.ID]; exists {
-		return fmt.Errorf("list with ID %s for user %s already exists", list.ID, userID)
+		return errorf(ErrConflict, "list with ID %s for user %s already exists", list.ID, userID)
+	}
+
+	s.created(&list, userID)
+	user.TodoLists[list.ID] = &list
+	return nil
+}
+
+// created stamps every todo of a new list and starts its history, callers
+// must hold s.mu.
+func (s *InMemoryStore) created(list *TodoList, userID string) {
+	now := s.now()
+	for _, todo := range SortTodos(list.Todos, ByPosition) {
+		s.record(userID, created(todo, list.ID, userID, now))
+	}
+}
+
+func (s *InMemoryStore) CreateTodoList(list TodoList, userID string) (id string, e error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.users[userID]
+	if !exists {
+		return "", userNotFound(userID)
 	}
 
+	list = cloneTodoList(list)
+	list.ID = s.ids.NewID()
+	newTodoIDs(&list, nil, s.ids)
+	if err := checkTree(list, userID); err != nil {
+		return "", err
+	}
+	if err := checkAssignees(list, nil, userID); err != nil {
+		return "", err
+	}
+	list.DeletedAt = nil
+	list.Members = nil
+	list.Version = 1
+	list.Position = nextListPosition(user.TodoLists)
+	s.created(&list, userID)
 	user.TodoLists[list.ID] = &list
+	return list.ID, nil
+}
+
+func (s *InMemoryStore) UpdateTodoList(list TodoList, userID string, actorID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, err := s.todoList(userID, list.ID)
+	if err != nil {
+		return err
+	}
+
+	list = cloneTodoList(list)
+	newTodoIDs(&list, stored, s.ids)
+	return s.updateTodoList(list, userID, actorID)
+}
+
+// updateTodoList replaces the stored list with list, keeping the IDs of its
+// todos. list must be the store's own copy, callers must hold s.mu.
+func (s *InMemoryStore) updateTodoList(list TodoList, userID string, actorID string) error {
+	stored, err := s.todoList(userID, list.ID)
+	if err != nil {
+		return err
+	}
+
+	if err = checkVersion(list, stored, userID); err != nil {
+		return err
+	}
+	if err = checkTree(list, userID); err != nil {
+		return err
+	}
+	if err = checkAssignees(list, stored.Members, userID); err != nil {
+		return err
+	}
+
+	list.Version = stored.Version + 1
+	list.Position = stored.Position
+	list.DeletedAt = nil
+	list.Members = maps.Clone(stored.Members)
+	s.record(userID, updatedList(stored, &list, actorID, s.now())...)
+	for id := range stored.Todos {
+		if _, exists := list.Todos[id]; !exists {
+			s.forget(userID, list.ID, id)
+		}
+	}
+	s.trashOf(userID).forgetLive(&list)
+	s.users[userID].TodoLists[list.ID] = &list
 	return nil
 }
 
-func (s *InMemoryStore) AddTodo(todo Todo, listID string, userID string) error {
-	list := s.users[userID].TodoLists[listID]
+func (s *InMemoryStore) DeleteTodoList(userID string, listID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.users[userID]
+	if !exists {
+		return userNotFound(userID)
+	}
+
+	s.expire(userID)
+	if !trashList(s.trashOf(userID), user.TodoLists, listID, s.now()) {
+		return listNotFound(userID, listID)
+	}
+	return nil
+}
+
+func (s *InMemoryStore) AddTodo(todo Todo, listID string, userID string, actorID string) (id string, e error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := s.todoList(userID, listID)
+	if err != nil {
+		return "", err
+	}
+
+	if err = checkParent(list, todo, userID); err != nil {
+		return "", err
+	}
+	if err = checkRecurrence(todo, listID, userID); err != nil {
+		return "", err
+	}
+	if err = checkAssignee(list, todo, userID); err != nil {
+		return "", err
+	}
+
+	todo.ID = s.ids.NewID()
+	todo.Position = nextTodoPosition(list, todo.ParentID)
+	if err = s.addTodo(todo, listID, userID, actorID); err != nil {
+		return "", err
+	}
+	return todo.ID, nil
+}
+
+// addTodo adds todo keeping its ID, callers must hold s.mu.
+func (s *InMemoryStore) addTodo(todo Todo, listID string, userID string, actorID string) error {
+	list, err := s.todoList(userID, listID)
+	if err != nil {
+		return err
+	}
+
 	if _, exists := list.Todos[todo.ID]; exists {
-		return fmt.Errorf("todo with ID %s in list ID %s for user ID %s already exists", todo.ID, listID, userID)
+		return errorf(ErrConflict, "todo with ID %s in list ID %s for user ID %s already exists", todo.ID, listID, userID)
+	}
+	todo = cloneTodo(todo)
+	s.record(userID, created(&todo, listID, actorID, s.now()))
+	list.Todos[todo.ID] = &todo
+	list.Version++
+	return nil
+}
+
+func (s *InMemoryStore) UpdateTodo(todo Todo, listID string, userID string, actorID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := s.todoList(userID, listID)
+	if err != nil {
+		return err
+	}
+
+	stored, exists := list.Todos[todo.ID]
+	if !exists {
+		return TodoNotFound(userID, listID, todo.ID)
+	}
+	if err = checkRecurrence(todo, listID, userID); err != nil {
+		return err
+	}
+	if err = checkAssignee(list, todo, userID); err != nil {
+		return err
+	}
+	todo = cloneTodo(todo)
+	todo.ParentID = stored.ParentID
+	todo.Position = stored.Position
+	if entry, changed := updated(*stored, &todo, listID, actorID, s.now()); changed {
+		s.record(userID, entry)
 	}
 	list.Todos[todo.ID] = &todo
+	list.Version++
+	return nil
+}
+
+func (s *InMemoryStore) DeleteTodo(userID string, listID string, todoID string, actorID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := s.todoList(userID, listID)
+	if err != nil {
+		return err
+	}
+
+	s.expire(userID)
+	entries := trashTodo(s.trashOf(userID), list, todoID, actorID, s.now())
+	if entries == nil {
+		return TodoNotFound(userID, listID, todoID)
+	}
+	s.record(userID, entries...)
+	list.Version++
+	return nil
+}
+
+func (s *InMemoryStore) ToggleTodo(userID string, listID string, todoID string, actorID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := s.todoList(userID, listID)
+	if err != nil {
+		return err
+	}
+
+	entries := toggleTodo(list, todoID, actorID, s.now())
+	if entries == nil {
+		return TodoNotFound(userID, listID, todoID)
+	}
+	s.record(userID, entries...)
+	list.Version++
+
+	return nil
+}
+
+func (s *InMemoryStore) MoveTodoList(userID string, listID string, by int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.users[userID]
+	if !exists {
+		return userNotFound(userID)
+	}
+
+	if !moveList(user.TodoLists, listID, by) {
+		return listNotFound(userID, listID)
+	}
+	return nil
+}
+
+func (s *InMemoryStore) MoveTodo(userID string, listID string, todoID string, by int, actorID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := s.todoList(userID, listID)
+	if err != nil {
+		return err
+	}
+
+	if !moveTodo(list, todoID, by) {
+		return TodoNotFound(userID, listID, todoID)
+	}
+	s.record(userID, moved(list.Todos[todoID], listID, actorID, s.now()))
+	list.Version++
 	return nil
 }
 
-func (s *InMemoryStore) ToggleTodo(userID string, listID string, todoID string) error {
-	user := s.users[userID]
-	list := user.TodoLists[listID]
+func (s *InMemoryStore) FindTodos(userID string, query TodoQuery) ([]FoundTodo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, exists := s.users[userID]
+	if !exists {
+		return nil, userNotFound(userID)
+	}
 
+	return findSharedTodos(findTodos(user.TodoLists, userID, query), sharedWith(s.users, userID), query), nil
+}
+
+func (s *InMemoryStore) TodoHistory(userID string, listID string, todoID string) ([]HistoryEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list, err := s.todoList(userID, listID)
+	if err != nil {
+		return nil, err
+	}
 	if _, exists := list.Todos[todoID]; !exists {
-		return fmt.Errorf("todo with ID %s in list ID %s for user ID %s does not exist", todoID, listID, userID)
+		return nil, TodoNotFound(userID, listID, todoID)
+	}
+
+	history := s.history[historyKey(userID, listID, todoID)]
+	entries := make([]HistoryEntry, len(history))
+	for i, entry := range history {
+		entry.Fields = slices.Clone(entry.Fields)
+		entries[i] = entry
+	}
+	return entries, nil
+}
+
+func (s *InMemoryStore) Trash(userID string) (Trash, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.users[userID]; !exists {
+		return Trash{}, userNotFound(userID)
+	}
+
+	s.expire(userID)
+	trash := cloneTrash(*s.trashOf(userID))
+	sortTrash(&trash)
+	return trash, nil
+}
+
+func (s *InMemoryStore) RestoreTodoList(userID string, listID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.users[userID]
+	if !exists {
+		return userNotFound(userID)
+	}
+
+	s.expire(userID)
+	if !restoreList(s.trashOf(userID), user.TodoLists, listID) {
+		return listNotFound(userID, listID)
+	}
+	return nil
+}
+
+func (s *InMemoryStore) RestoreTodo(userID string, listID string, todoID string, actorID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := s.todoList(userID, listID)
+	if err != nil {
+		return err
+	}
+
+	s.expire(userID)
+	entries := restoreTodo(s.trashOf(userID), list, todoID, actorID, s.now())
+	if entries == nil {
+		return TodoNotFound(userID, listID, todoID)
+	}
+	s.record(userID, entries...)
+	list.Version++
+	return nil
+}
+
+func (s *InMemoryStore) PurgeTrash(userID string, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.users[userID]; !exists {
+		return userNotFound(userID)
+	}
+
+	s.purge(userID, before)
+	return nil
+}
+
+// trashOf returns the user's trash, callers must hold s.mu.
+func (s *InMemoryStore) trashOf(userID string) *Trash {
+	trash, exists := s.trash[userID]
+	if !exists {
+		trash = &Trash{}
+		s.trash[userID] = trash
+	}
+	return trash
+}
+
+// expire purges what has been in the user's trash for longer than the
+// retention, callers must hold s.mu.
+func (s *InMemoryStore) expire(userID string) {
+	if s.retention > 0 {
+		s.purge(userID, s.now().Add(-s.retention))
+	}
+}
+
+// purge drops what went into the user's trash at or before before along with
+// its history, reporting whether there was any. Callers must hold s.mu.
+func (s *InMemoryStore) purge(userID string, before time.Time) bool {
+	trash, exists := s.trash[userID]
+	if !exists {
+		return false
+	}
+
+	purged := trash.purge(before)
+	for _, list := range purged.Lists {
+		for id := range list.Todos {
+			s.forget(userID, list.ID, id)
+		}
 	}
+	for _, todo := range purged.Todos {
+		s.forget(userID, todo.ListID, todo.ID)
+	}
+	return len(purged.Lists) > 0 || len(purged.Todos) > 0
+}
+
+// record appends entries to the history of the todos of userID they are
+// about, callers must hold s.mu.
+func (s *InMemoryStore) record(userID string, entries ...HistoryEntry) {
+	for _, entry := range entries {
+		key := historyKey(userID, entry.ListID, entry.TodoID)
+		s.history[key] = append(s.history[key], entry)
+	}
+}
+
+// forget drops the history of todos deleted for good, callers must hold s.mu.
+func (s *InMemoryStore) forget(userID string, listID string, todoIDs ...string) {
+	for _, todoID := range todoIDs {
+		delete(s.history, historyKey(userID, listID, todoID))
+	}
+}
+
+func (s *InMemoryStore) ShareTodoList(userID string, listID string, memberID string, role Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := s.todoList(userID, listID)
+	if err != nil {
+		return err
+	}
+	if err = checkShare(userID, listID, memberID, role); err != nil {
+		return err
+	}
+	if _, exists := s.users[memberID]; !exists {
+		return userNotFound(memberID)
+	}
+
+	shareList(list, memberID, role)
+	return nil
+}
 
-	todo := list.Todos[todoID]
+func (s *InMemoryStore) UnshareTodoList(userID string, listID string, memberID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	todo.Toggle()
+	list, err := s.todoList(userID, listID)
+	if err != nil {
+		return err
+	}
+
+	entries, err := unshareList(list, userID, memberID, s.now())
+	if err != nil {
+		return err
+	}
 
+	s.record(userID, entries...)
 	return nil
 }
+
+func (s *InMemoryStore) SharedTodoLists(userID string) ([]SharedList, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, exists := s.users[userID]; !exists {
+		return nil, userNotFound(userID)
+	}
+
+	return sharedWith(s.users, userID), nil
+}
+
+// todoList returns the stored list itself, callers must hold s.mu.
+func (s *InMemoryStore) todoList(userID string, listID string) (*TodoList, error) {
+	user, exists := s.users[userID]
+	if !exists {
+		return nil, userNotFound(userID)
+	}
+
+	list, exists := user.TodoLists[listID]
+	if !exists {
+		return nil, listNotFound(userID, listID)
+	}
+
+	return list, nil
+}
+
+func cloneUser(user User) User {
+	user.TodoLists = cloneTodoLists(user.TodoLists)
+	user.PasswordHash = slices.Clone(user.PasswordHash)
+	user.APIKeys = cloneAPIKeys(user.APIKeys)
+	return user
+}
+
+func cloneTodoLists(lists map[string]*TodoList) map[string]*TodoList {
+	clone := make(map[string]*TodoList, len(lists))
+	for id, list := range lists {
+		l := cloneTodoList(*list)
+		clone[id] = &l
+	}
+	return clone
+}
+
+func cloneTodoList(list TodoList) TodoList {
+	todos := make(map[string]*Todo, len(list.Todos))
+	for id, todo := range list.Todos {
+		t := cloneTodo(*todo)
+		todos[id] = &t
+	}
+	list.Todos = todos
+	list.DeletedAt = cloneTime(list.DeletedAt)
+	list.Members = maps.Clone(list.Members)
+	return list
+}
+
+func cloneTrash(trash Trash) Trash {
+	lists := make([]TodoList, len(trash.Lists))
+	for i, list := range trash.Lists {
+		lists[i] = cloneTodoList(list)
+	}
+	todos := make([]TrashedTodo, len(trash.Todos))
+	for i, todo := range trash.Todos {
+		todos[i] = TrashedTodo{ListID: todo.ListID, Todo: cloneTodo(todo.Todo)}
+	}
+	return Trash{Lists: lists, Todos: todos}
+}
+
+// cloneTodo copies the todo along with anything it points to.
+func cloneTodo(todo Todo) Todo {
+	todo.Tags = slices.Clone(todo.Tags)
+	todo.Start = cloneTime(todo.Start)
+	todo.Due = cloneTime(todo.Due)
+	todo.CompletedAt = cloneTime(todo.CompletedAt)
+	todo.DeletedAt = cloneTime(todo.DeletedAt)
+	return todo
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	clone := *t
+	return &clone
+}
@@ -1,8 +1,11 @@
 package store
 
 import (
+	"errors"
 	"strconv"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestAddUser(t *testing.T) {
@@ -80,15 +83,15 @@ func TestAddDuplicateListID(t *testing.T) {
 }
 
 func TestAddTodo(t *testing.T) {
-	store := NewInMemoryStore()
+	store := NewInMemoryStore(WithIDGenerator(NewSequenceGenerator()))
 
 	user := NewUser("0001", "Steve")
 	store.addUser(user)
 
 	list := NewTodoList("0001", "test list")
 	store.AddTodoList(list, "0001")
-	todo := Todo{"0001", "Make Todo App", false}
-	store.AddTodo(todo, "0001", "0001")
+	todo := Todo{ID: "0001", Title: "Make Todo App"}
+	store.AddTodo(todo, "0001", "0001", "0001")
 
 	got := user.TodoLists["0001"].Todos["0001"].Title
 	want := "Make Todo App"
@@ -107,11 +110,11 @@ func TestAddDuplicateTodoID(t *testing.T) {
 	list := NewTodoList("0001", "test list")
 	store.AddTodoList(list, "0001")
 
-	todo := Todo{"0001", "original", false}
-	todo2 := Todo{"0001", "duplicate", false}
-	store.AddTodo(todo, "0001", "0001")
+	todo := Todo{ID: "0001", Title: "original"}
+	todo2 := Todo{ID: "0001", Title: "duplicate"}
+	store.addTodo(todo, "0001", "0001", "0001")
 
-	err := store.AddTodo(todo2, "0001", "0001")
+	err := store.addTodo(todo2, "0001", "0001", "0001")
 
 	if err == nil {
 		t.Fatal("expected an error")
@@ -125,7 +128,7 @@ func TestAddDuplicateTodoID(t *testing.T) {
 }
 
 func TestCompleteTodo(t *testing.T) {
-	store := NewInMemoryStore()
+	store := NewInMemoryStore(WithIDGenerator(NewSequenceGenerator()))
 
 	user := NewUser("0001", "Steve")
 	store.addUser(user)
@@ -133,10 +136,10 @@ func TestCompleteTodo(t *testing.T) {
 	list := NewTodoList("0001", "test list")
 	store.AddTodoList(list, "0001")
 
-	todo := Todo{"0001", "to complete", false}
-	store.AddTodo(todo, "0001", "0001")
+	todo := Todo{ID: "0001", Title: "to complete"}
+	store.AddTodo(todo, "0001", "0001", "0001")
 
-	store.CompleteTodo("0001", "0001", "0001")
+	store.ToggleTodo("0001", "0001", "0001", "0001")
 
 	got := user.TodoLists["0001"].Todos["0001"].Completed
 	want := true
@@ -145,3 +148,104 @@ func TestCompleteTodo(t *testing.T) {
 		t.Errorf("got %q want %q", strconv.FormatBool(got), strconv.FormatBool(want))
 	}
 }
+
+func TestGetTodoListReturnsCopy(t *testing.T) {
+	store := NewInMemoryStore()
+
+	userID, _ := store.CreateUser("Steve")
+	listID, _ := store.CreateTodoList(NewTodoList("", "test list"), userID)
+	todoID, _ := store.AddTodo(Todo{Title: "original"}, listID, userID, userID)
+
+	list, _ := store.GetTodoList(userID, listID)
+	list.Name = "changed"
+	list.Todos[todoID].Title = "changed"
+
+	got, _ := store.GetTodoList(userID, listID)
+
+	if got.Name != "test list" {
+		t.Errorf("got %q want %q", got.Name, "test list")
+	}
+	if got.Todos[todoID].Title != "original" {
+		t.Errorf("got %q want %q", got.Todos[todoID].Title, "original")
+	}
+}
+
+func TestConcurrentToggleTodo(t *testing.T) {
+	store := NewInMemoryStore()
+
+	userID, _ := store.CreateUser("Steve")
+	listID, _ := store.CreateTodoList(NewTodoList("", "test list"), userID)
+	todoID, _ := store.AddTodo(Todo{Title: "to toggle"}, listID, userID, userID)
+
+	var wg sync.WaitGroup
+	for range 100 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			store.ToggleTodo(userID, listID, todoID, userID)
+		}()
+		go func() {
+			defer wg.Done()
+			store.GetTodoLists(userID)
+		}()
+	}
+	wg.Wait()
+
+	list, _ := store.GetTodoList(userID, listID)
+
+	if list.Todos[todoID].Completed {
+		t.Errorf("got %q want %q", "true", "false")
+	}
+}
+
+func TestTrashRetention(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	store := NewInMemoryStore(WithClock(func() time.Time { return now }), WithRetention(24*time.Hour))
+
+	userID, _ := store.CreateUser("Steve")
+	groceries, _ := store.CreateTodoList(NewTodoList("", "groceries"), userID)
+	chores, _ := store.CreateTodoList(NewTodoList("", "chores"), userID)
+
+	store.DeleteTodoList(userID, groceries)
+	now = now.Add(12 * time.Hour)
+	store.DeleteTodoList(userID, chores)
+
+	now = now.Add(13 * time.Hour)
+	trash, err := store.Trash(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash.Lists) != 1 || trash.Lists[0].ID != chores {
+		t.Errorf("got %+v want only %s left in the trash", trash.Lists, chores)
+	}
+
+	if err = store.RestoreTodoList(userID, groceries); err == nil {
+		t.Error("restored a purged list")
+	}
+}
+
+func TestAPIKeyExpiry(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	store := NewInMemoryStore(WithClock(func() time.Time { return now }))
+
+	userID, _ := store.CreateUser("Steve")
+	expires := now.Add(time.Hour)
+	key, secret, err := store.CreateAPIKey(userID, APIKey{Name: "ci", ExpiresAt: &expires})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = store.CheckAPIKey(secret); err != nil {
+		t.Errorf("CheckAPIKey before it expires: %v", err)
+	}
+
+	now = expires
+	if _, err = store.CheckAPIKey(secret); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("got %v once expired want ErrUnauthorized", err)
+	}
+
+	keys, _ := store.GetAPIKeys(userID)
+	if len(keys) != 1 || keys[0].ID != key.ID || !keys[0].Expired(now) {
+		t.Errorf("got %+v want the expired key still listed", keys)
+	}
+}
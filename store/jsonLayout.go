@@ -0,0 +1,124 @@
+package store
+
+import (
+	"ToDo/store/internal/fsutil"
+	"ToDo/store/migrate"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// A JsonStore directory is laid out as:
+//
+//	VERSION            the schema version of the directory, see jsonMigrations
+//	users.json         every user, keyed by user ID
+//	lists/<ID>.json    the todo lists of the user with that ID, keyed by list ID
+//	history/<ID>.log   the history of that user's todos, one JSON entry a line
+//	trash/<ID>.json    what that user deleted, see Trash
+//	backups/           copies of the directory taken before each migration
+//	.lock              advisory lock shared by every process using the directory
+const (
+	usersFile  = "users.json"
+	listsDir   = "lists"
+	historyDir = "history"
+	trashDir   = "trash"
+	lockName   = ".lock"
+)
+
+var jsonMigrations = migrate.NewRegistry(func(rel string) bool {
+	return rel == lockName || strings.HasPrefix(filepath.Base(rel), ".")
+})
+
+func init() {
+	jsonMigrations.Register(migrate.Migration{
+		Version:     2,
+		Description: "move <ID>lists.json files into lists/<ID>.json",
+		Apply:       migrateLegacyLists,
+	})
+}
+
+// MigrateJsonDir brings the JsonStore directory at dir up to the current
+// schema version. NewJsonStore does this itself, calling it directly is
+// mostly useful with opts.DryRun to see what would change.
+func MigrateJsonDir(dir string, opts migrate.Options) (migrate.Result, error) {
+	s := JsonStore{storePath: dir, mu: &sync.Mutex{}}
+
+	unlock, err := s.lock(true)
+	if err != nil {
+		return migrate.Result{}, err
+	}
+	defer unlock()
+
+	return jsonMigrations.Run(dir, opts)
+}
+
+func (s JsonStore) usersPath() string {
+	return filepath.Join(s.storePath, usersFile)
+}
+
+func (s JsonStore) lockPath() string {
+	return filepath.Join(s.storePath, lockName)
+}
+
+// listsPath is where userID's lists live. IDs that would escape lists/ can't
+// belong to a user so they're reported as missing.
+func (s JsonStore) listsPath(userID string) (string, error) {
+	if userID == "" || userID == "." || userID == ".." || strings.ContainsAny(userID, `/\`) {
+		return "", userNotFound(userID)
+	}
+	return filepath.Join(s.storePath, listsDir, userID+".json"), nil
+}
+
+// historyPath is where the history of userID's todos is appended to.
+func (s JsonStore) historyPath(userID string) (string, error) {
+	if _, err := s.listsPath(userID); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.storePath, historyDir, userID+".log"), nil
+}
+
+// trashPath is where userID's trash is kept.
+func (s JsonStore) trashPath(userID string) (string, error) {
+	if _, err := s.listsPath(userID); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.storePath, trashDir, userID+".json"), nil
+}
+
+var legacyListsRe = regexp.MustCompile(`^(.+)lists\.json$`)
+
+func migrateLegacyLists(dir string) error {
+	if err := os.MkdirAll(filepath.Join(dir, listsDir), 0755); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		matches := legacyListsRe.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+
+		from := filepath.Join(dir, entry.Name())
+		to := filepath.Join(dir, listsDir, matches[1]+".json")
+
+		if _, err = os.Stat(to); err == nil {
+			return fmt.Errorf("%s already exists", to)
+		}
+
+		if err = os.Rename(from, to); err != nil {
+			return err
+		}
+	}
+
+	fsutil.SyncDir(filepath.Join(dir, listsDir))
+	fsutil.SyncDir(dir)
+	return nil
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"ToDo/store/migrate"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewJsonStoreMigratesLegacyLists(t *testing.T) {
+	dir := t.TempDir()
+
+	users := `{"0001": {"ID": "0001", "Name": "Steve", "TodoLists": {}}}`
+	lists := `{"1": {"ID": "1", "Name": "groceries", "Todos": {}}}`
+
+	if err := os.WriteFile(filepath.Join(dir, "users.json"), []byte(users), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "0001lists.json"), []byte(lists), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewJsonStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := store.GetTodoList("0001", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Name != "groceries" {
+		t.Errorf("got %q want %q", list.Name, "groceries")
+	}
+
+	if _, err = os.Stat(filepath.Join(dir, "0001lists.json")); !os.IsNotExist(err) {
+		t.Errorf("legacy lists file still exists: %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "lists", "0001.json")); err != nil {
+		t.Errorf("migrated lists file missing: %v", err)
+	}
+
+	version, err := migrate.ReadVersion(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != jsonMigrations.Latest() {
+		t.Errorf("got version %d want %d", version, jsonMigrations.Latest())
+	}
+
+	backups, err := os.ReadDir(filepath.Join(dir, migrate.BackupDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("got %d backups want 1", len(backups))
+	}
+
+	backup := filepath.Join(dir, migrate.BackupDir, backups[0].Name(), "0001lists.json")
+	if _, err = os.Stat(backup); err != nil {
+		t.Errorf("legacy lists file missing from backup: %v", err)
+	}
+}
+
+func TestMigrateJsonDirDryRun(t *testing.T) {
+	dir := t.TempDir()
+
+	lists := `{"1": {"ID": "1", "Name": "groceries", "Todos": {}}}`
+	if err := os.WriteFile(filepath.Join(dir, "0001lists.json"), []byte(lists), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := MigrateJsonDir(dir, migrate.Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.From != 1 || result.To != jsonMigrations.Latest() {
+		t.Errorf("got %d -> %d want 1 -> %d", result.From, result.To, jsonMigrations.Latest())
+	}
+
+	if _, err = os.Stat(filepath.Join(dir, "0001lists.json")); err != nil {
+		t.Errorf("dry run moved the legacy lists file: %v", err)
+	}
+
+	version, err := migrate.ReadVersion(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 1 {
+		t.Errorf("dry run changed the version to %d", version)
+	}
+}
+
+func TestNewJsonStoreRejectsNewerLayout(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := migrate.WriteVersion(dir, jsonMigrations.Latest()+1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewJsonStore(dir); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestJsonStoreRejectsPathsInUserIDs(t *testing.T) {
+	store, err := NewJsonStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, userID := range []string{"../0001", "..", "a/b"} {
+		if _, err = store.listsPath(userID); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("%q: got %v want %v", userID, err, ErrUserNotFound)
+		}
+	}
+}
@@ -1,27 +1,66 @@
 package store
 
 import (
+	"ToDo/store/internal/fsutil"
+	"ToDo/store/migrate"
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
 )
 
+// JsonStore keeps users and their lists as JSON files in a single directory,
+// see jsonLayout.go for how that directory is laid out.
 type JsonStore struct {
 	Users     map[string]*User
 	storePath string
+	mu        *sync.Mutex
+	ids       IDGenerator
+	now       func() time.Time
+	retention time.Duration
 }
 
-func NewJsonStore(storagePath string) (JsonStore, error) {
-	return JsonStore{
+func NewJsonStore(storagePath string, opts ...Option) (JsonStore, error) {
+	o := applyOptions(opts)
+
+	s := JsonStore{
 		Users:     make(map[string]*User),
 		storePath: storagePath,
-	}, nil
+		mu:        &sync.Mutex{},
+		ids:       o.ids,
+		now:       o.now,
+		retention: o.retention,
+	}
+
+	for _, dir := range []string{listsDir, historyDir, trashDir} {
+		if err := os.MkdirAll(filepath.Join(storagePath, dir), 0755); err != nil {
+			return JsonStore{}, err
+		}
+	}
+
+	unlock, err := s.lock(true)
+	if err != nil {
+		return JsonStore{}, err
+	}
+	defer unlock()
+
+	if _, err = jsonMigrations.Run(storagePath, migrate.Options{}); err != nil {
+		return JsonStore{}, err
+	}
+
+	return s, nil
 }
 
 func (s JsonStore) getUsersFromJson() (map[string]*User, error) {
 	users := make(map[string]*User)
-	file := s.storePath + "/users.json"
+	file := s.usersPath()
 
 	jsonFile, err := os.Open(file)
 	if err != nil {
@@ -34,16 +73,60 @@ func (s JsonStore) getUsersFromJson() (map[string]*User, error) {
 
 	defer jsonFile.Close()
 
-	byteValue, _ := io.ReadAll(jsonFile)
+	byteValue, err := io.ReadAll(jsonFile)
+	if err != nil {
+		return users, err
+	}
 
 	err = json.Unmarshal(byteValue, &users)
+	if err != nil {
+		return users, err
+	}
 
 	return users, nil
 }
 
-func (s JsonStore) GetTodoLists(userID string) (map[string]*TodoList, error) {
+// lock serializes access to the data directory, both between goroutines and
+// between processes sharing it.
+func (s JsonStore) lock(exclusive bool) (func(), error) {
+	s.mu.Lock()
+
+	unlock, err := lockFile(s.lockPath(), exclusive)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+
+	return func() {
+		unlock()
+		s.mu.Unlock()
+	}, nil
+}
+
+func (s JsonStore) getUser(userID string) (User, error) {
+	users, err := s.getUsersFromJson()
+	if err != nil {
+		return User{}, fmt.Errorf("%s", err)
+	}
+
+	if _, exists := users[userID]; !exists {
+		return User{}, userNotFound(userID)
+	}
+
+	return *users[userID], nil
+}
+
+func (s JsonStore) readTodoLists(userID string) (map[string]*TodoList, error) {
 	todos := make(map[string]*TodoList)
-	file := s.storePath + "/" + userID + "lists.json"
+
+	if _, err := s.getUser(userID); err != nil {
+		return todos, err
+	}
+
+	file, err := s.listsPath(userID)
+	if err != nil {
+		return todos, err
+	}
 
 	jsonFile, err := os.Open(file)
 	if err != nil {
@@ -56,7 +139,10 @@ func (s JsonStore) GetTodoLists(userID string) (map[string]*TodoList, error) {
 
 	defer jsonFile.Close()
 
-	byteValue, _ := io.ReadAll(jsonFile)
+	byteValue, err := io.ReadAll(jsonFile)
+	if err != nil {
+		return todos, err
+	}
 
 	err = json.Unmarshal(byteValue, &todos)
 	if err != nil {
@@ -66,28 +152,252 @@ func (s JsonStore) GetTodoLists(userID string) (map[string]*TodoList, error) {
 	return todos, nil
 }
 
+func (s JsonStore) writeTodoLists(userID string, todos map[string]*TodoList) error {
+	byteValue, err := json.MarshalIndent(todos, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := s.listsPath(userID)
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteFileAtomic(file, byteValue, 0644)
+}
+
+func (s JsonStore) readTrash(userID string) (*Trash, error) {
+	var trash Trash
+
+	file, err := s.trashPath(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	byteValue, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return &trash, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(byteValue, &trash); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", file, err)
+	}
+	return &trash, nil
+}
+
+func (s JsonStore) writeTrash(userID string, trash *Trash) error {
+	byteValue, err := json.MarshalIndent(trash, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := s.trashPath(userID)
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteFileAtomic(file, byteValue, 0644)
+}
+
+// readExpiredTrash reads the user's trash and purges what has been there for
+// longer than the retention, leaving the caller to write it back.
+func (s JsonStore) readExpiredTrash(userID string) (*Trash, error) {
+	trash, err := s.readTrash(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.retention > 0 {
+		trash.purge(s.now().Add(-s.retention))
+	}
+	return trash, nil
+}
+
+// appendHistory adds entries to the end of userID's history file. Entries of
+// todos purged from the trash stay in the file but can no longer be read,
+// those of todos UpdateTodoList drops are taken out by forgetHistory.
+func (s JsonStore) appendHistory(userID string, entries ...HistoryEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	byteValue, err := marshalHistory(entries)
+	if err != nil {
+		return err
+	}
+
+	file, err := s.historyPath(userID)
+	if err != nil {
+		return err
+	}
+
+	historyFile, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err = historyFile.Write(byteValue); err != nil {
+		historyFile.Close()
+		return err
+	}
+	if err = historyFile.Sync(); err != nil {
+		historyFile.Close()
+		return err
+	}
+	return historyFile.Close()
+}
+
+func (s JsonStore) readHistory(userID string, listID string, todoID string) ([]HistoryEntry, error) {
+	entries, _, err := s.scanHistory(userID, func(entry HistoryEntry) bool {
+		return entry.ListID == listID && entry.TodoID == todoID
+	})
+	return entries, err
+}
+
+// forgetHistory rewrites userID's history file without the entries of the
+// todos of listID that were deleted for good.
+func (s JsonStore) forgetHistory(userID string, listID string, todoIDs ...string) error {
+	if len(todoIDs) == 0 {
+		return nil
+	}
+
+	entries, dropped, err := s.scanHistory(userID, func(entry HistoryEntry) bool {
+		return entry.ListID != listID || !slices.Contains(todoIDs, entry.TodoID)
+	})
+	if err != nil || !dropped {
+		return err
+	}
+
+	byteValue, err := marshalHistory(entries)
+	if err != nil {
+		return err
+	}
+
+	file, err := s.historyPath(userID)
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteFileAtomic(file, byteValue, 0644)
+}
+
+// marshalHistory encodes entries the way the history file holds them, one
+// JSON object per line.
+func marshalHistory(entries []HistoryEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		byteValue, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(byteValue)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// scanHistory reads the entries of userID's history file that keep holds
+// for, reporting whether it left any out.
+func (s JsonStore) scanHistory(userID string, keep func(HistoryEntry) bool) ([]HistoryEntry, bool, error) {
+	entries := []HistoryEntry{}
+
+	file, err := s.historyPath(userID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	historyFile, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return entries, false, nil
+		}
+		return nil, false, err
+	}
+	defer historyFile.Close()
+
+	dropped := false
+	scanner := bufio.NewScanner(historyFile)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, false, fmt.Errorf("reading %s: %w", file, err)
+		}
+		if keep(entry) {
+			entries = append(entries, entry)
+		} else {
+			dropped = true
+		}
+	}
+
+	return entries, dropped, scanner.Err()
+}
+
+func (s JsonStore) readTodoList(userID string, listID string) (map[string]*TodoList, *TodoList, error) {
+	todoLists, err := s.readTodoLists(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	list, exists := todoLists[listID]
+	if !exists {
+		return nil, nil, listNotFound(userID, listID)
+	}
+
+	if list.Todos == nil {
+		list.Todos = make(map[string]*Todo)
+	}
+
+	return todoLists, list, nil
+}
+
+func (s JsonStore) GetTodoLists(userID string) (map[string]*TodoList, error) {
+	unlock, err := s.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return s.readTodoLists(userID)
+}
+
 func (s JsonStore) GetTodoList(userID string, listID string) (TodoList, error) {
-	todoLists, err := s.GetTodoLists(userID)
+	unlock, err := s.lock(false)
 	if err != nil {
 		return TodoList{}, err
 	}
+	defer unlock()
 
-	if _, exists := todoLists[listID]; !exists {
-		return TodoList{}, fmt.Errorf("list with ID %s doesn't exist for user ID %s", listID, userID)
+	_, list, err := s.readTodoList(userID, listID)
+	if err != nil {
+		return TodoList{}, err
 	}
 
-	return *todoLists[listID], nil
+	return *list, nil
 }
 
 func (s JsonStore) CreateUser(username string) (id string, e error) {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
 	users, err := s.getUsersFromJson()
 	if err != nil {
 		return "json error", fmt.Errorf("%s", err)
 	}
 
+	if err = checkName(users, "", username); err != nil {
+		return "", err
+	}
+
 	s.Users = users
 
-	userID := fmt.Sprintf("%04d", len(s.Users)+1)
+	userID := s.ids.NewID()
 	user := NewUser(userID, username)
 
 	s.Users[userID] = &user
@@ -97,7 +407,7 @@ func (s JsonStore) CreateUser(username string) (id string, e error) {
 		return "Error Marshalling", fmt.Errorf("%s", err)
 	}
 
-	err = os.WriteFile(s.storePath+"users.json", byteValue, 0644)
+	err = fsutil.WriteFileAtomic(s.usersPath(), byteValue, 0644)
 
 	if err != nil {
 		return "Error Writing", fmt.Errorf("%s", err)
@@ -107,89 +417,757 @@ func (s JsonStore) CreateUser(username string) (id string, e error) {
 }
 
 func (s JsonStore) GetUser(userID string) (User, error) {
-	users, err := s.getUsersFromJson()
+	unlock, err := s.lock(false)
 	if err != nil {
-		return User{}, fmt.Errorf("%s", err)
+		return User{}, err
 	}
+	defer unlock()
 
-	s.Users = users
-	if _, exists := s.Users[userID]; !exists {
-		return User{}, fmt.Errorf("no user found with ID %s", userID)
+	return s.getUser(userID)
+}
+
+func (s JsonStore) GetUsers() ([]User, error) {
+	unlock, err := s.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	users, err := s.getUsersFromJson()
+	if err != nil {
+		return nil, err
 	}
 
-	return *s.Users[userID], nil
+	return listUsers(users), nil
 }
 
-func (s JsonStore) UpdateTodoList(list TodoList, userID string) error {
-	todos, err := s.GetTodoLists(userID)
+func (s JsonStore) RenameUser(userID string, name string) error {
+	unlock, err := s.lock(true)
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	todos[list.ID] = &list
-	byteValue, err := json.MarshalIndent(todos, "", "  ")
-
+	users, err := s.getUsersFromJson()
 	if err != nil {
 		return err
 	}
 
-	err = os.WriteFile(s.storePath+"/"+userID+"lists.json", byteValue, 0644)
+	user, exists := users[userID]
+	if !exists {
+		return userNotFound(userID)
+	}
+	if err = checkName(users, userID, name); err != nil {
+		return err
+	}
+	user.Name = name
+
+	return s.writeUsers(users)
+}
+
+// DeleteUser drops the user from users.json before removing their files, so
+// a failure part way leaves files nobody can reach rather than a user
+// missing their lists.
+func (s JsonStore) DeleteUser(userID string) error {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
+	users, err := s.getUsersFromJson()
 	if err != nil {
 		return err
 	}
+
+	if _, exists := users[userID]; !exists {
+		return userNotFound(userID)
+	}
+	delete(users, userID)
+
+	if err = s.writeUsers(users); err != nil {
+		return err
+	}
+
+	for _, path := range []func(string) (string, error){s.listsPath, s.historyPath, s.trashPath} {
+		file, err := path(userID)
+		if err != nil {
+			return err
+		}
+		if err = os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	for ownerID := range users {
+		if err = s.forgetMember(ownerID, userID); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (s JsonStore) DeleteTodoList(userID string, listID string) error {
-	todos, err := s.GetTodoLists(userID)
+// forgetMember takes memberID off the lists of ownerID, those in the trash
+// included.
+func (s JsonStore) forgetMember(ownerID string, memberID string) error {
+	lists, err := s.readTodoLists(ownerID)
+	if err != nil {
+		return err
+	}
+	now := s.now()
+	forgot, entries := forgetMember(slices.Collect(maps.Values(lists)), ownerID, memberID, now)
+	if forgot {
+		if err = s.writeTodoLists(ownerID, lists); err != nil {
+			return err
+		}
+	}
+
+	trash, err := s.readTrash(ownerID)
 	if err != nil {
 		return err
 	}
+	forgot, trashed := forgetMember(trash.listPointers(), ownerID, memberID, now)
+	if forgot {
+		if err = s.writeTrash(ownerID, trash); err != nil {
+			return err
+		}
+	}
 
-	delete(todos, listID)
+	return s.appendHistory(ownerID, append(entries, trashed...)...)
+}
 
-	byteValue, err := json.MarshalIndent(todos, "", "  ")
+func (s JsonStore) SetPassword(userID string, password string) error {
+	hash, err := hashPassword(userID, password)
 	if err != nil {
 		return err
 	}
 
-	err = os.WriteFile(s.storePath+"/"+userID+"lists.json", byteValue, 0644)
+	unlock, err := s.lock(true)
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	return nil
+	users, err := s.getUsersFromJson()
+	if err != nil {
+		return err
+	}
+
+	user, exists := users[userID]
+	if !exists {
+		return userNotFound(userID)
+	}
+	user.PasswordHash = hash
+
+	return s.writeUsers(users)
 }
 
-func (s JsonStore) AddTodo(todo Todo, listID string, userID string) error {
-	list, err := s.GetTodoList(userID, listID)
+func (s JsonStore) CheckPassword(userID string, password string) error {
+	user, err := s.GetUser(userID)
 	if err != nil {
 		return err
 	}
 
-	list.Todos[todo.ID] = &todo
+	return checkPassword(user, password)
+}
 
-	err = s.UpdateTodoList(list, userID)
+func (s JsonStore) CreateAPIKey(userID string, key APIKey) (APIKey, string, error) {
+	unlock, err := s.lock(true)
 	if err != nil {
-		return err
+		return APIKey{}, "", err
 	}
+	defer unlock()
 
-	return nil
+	users, err := s.getUsersFromJson()
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	if _, exists := users[userID]; !exists {
+		return APIKey{}, "", userNotFound(userID)
+	}
+
+	key, secret, err := newAPIKey(key, userID, s.ids.NewID(), s.now())
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	if err = addAPIKey(users, key); err != nil {
+		return APIKey{}, "", err
+	}
+	if err = s.writeUsers(users); err != nil {
+		return APIKey{}, "", err
+	}
+
+	key.Hash = nil
+	return key, secret, nil
+}
+
+func (s JsonStore) GetAPIKeys(userID string) ([]APIKey, error) {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return listAPIKeys(user), nil
 }
 
-func (s JsonStore) ToggleTodo(userID string, listID string, todoID string) error {
-	list, err := s.GetTodoList(userID, listID)
+func (s JsonStore) RevokeAPIKey(userID string, keyID string) error {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	users, err := s.getUsersFromJson()
 	if err != nil {
 		return err
 	}
+	if err = revokeAPIKey(users, userID, keyID); err != nil {
+		return err
+	}
+
+	return s.writeUsers(users)
+}
+
+func (s JsonStore) CheckAPIKey(secret string) (APIKey, error) {
+	unlock, err := s.lock(false)
+	if err != nil {
+		return APIKey{}, err
+	}
+	defer unlock()
+
+	users, err := s.getUsersFromJson()
+	if err != nil {
+		return APIKey{}, err
+	}
 
-	list.Todos[todoID].Completed = !list.Todos[todoID].Completed
+	return findAPIKey(users, secret, s.now())
+}
 
-	err = s.UpdateTodoList(list, userID)
+func (s JsonStore) ShareTodoList(userID string, listID string, memberID string, role Role) error {
+	unlock, err := s.lock(true)
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	return nil
+	lists, list, err := s.readTodoList(userID, listID)
+	if err != nil {
+		return err
+	}
+	if err = checkShare(userID, listID, memberID, role); err != nil {
+		return err
+	}
+	if _, err = s.getUser(memberID); err != nil {
+		return err
+	}
+
+	shareList(list, memberID, role)
+	return s.writeTodoLists(userID, lists)
+}
+
+func (s JsonStore) UnshareTodoList(userID string, listID string, memberID string) error {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	lists, list, err := s.readTodoList(userID, listID)
+	if err != nil {
+		return err
+	}
+	entries, err := unshareList(list, userID, memberID, s.now())
+	if err != nil {
+		return err
+	}
+	if err = s.writeTodoLists(userID, lists); err != nil {
+		return err
+	}
+
+	return s.appendHistory(userID, entries...)
+}
+
+func (s JsonStore) SharedTodoLists(userID string) ([]SharedList, error) {
+	unlock, err := s.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return s.sharedWith(userID)
+}
+
+// sharedWith reads the lists of every user, nothing keeps track of what is
+// shared with whom. Callers must hold the lock.
+func (s JsonStore) sharedWith(userID string) ([]SharedList, error) {
+	users, err := s.getUsersFromJson()
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := users[userID]; !exists {
+		return nil, userNotFound(userID)
+	}
+
+	for ownerID, user := range users {
+		if user.TodoLists, err = s.readTodoLists(ownerID); err != nil {
+			return nil, err
+		}
+	}
+	return sharedWith(users, userID), nil
+}
+
+func (s JsonStore) writeUsers(users map[string]*User) error {
+	byteValue, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteFileAtomic(s.usersPath(), byteValue, 0644)
+}
+
+func (s JsonStore) CreateTodoList(list TodoList, userID string) (id string, e error) {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	todos, err := s.readTodoLists(userID)
+	if err != nil {
+		return "", err
+	}
+
+	list = cloneTodoList(list)
+	list.ID = s.ids.NewID()
+	newTodoIDs(&list, nil, s.ids)
+	if err = checkTree(list, userID); err != nil {
+		return "", err
+	}
+	if err = checkAssignees(list, nil, userID); err != nil {
+		return "", err
+	}
+	list.DeletedAt = nil
+	list.Members = nil
+	list.Version = 1
+	list.Position = nextListPosition(todos)
+	var entries []HistoryEntry
+	now := s.now()
+	for _, todo := range SortTodos(list.Todos, ByPosition) {
+		entries = append(entries, created(todo, list.ID, userID, now))
+	}
+	todos[list.ID] = &list
+
+	if err = s.writeTodoLists(userID, todos); err != nil {
+		return "", err
+	}
+	if err = s.appendHistory(userID, entries...); err != nil {
+		return "", err
+	}
+
+	return list.ID, nil
+}
+
+func (s JsonStore) UpdateTodoList(list TodoList, userID string, actorID string) error {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	todos, stored, err := s.readTodoList(userID, list.ID)
+	if err != nil {
+		return err
+	}
+
+	list = cloneTodoList(list)
+	newTodoIDs(&list, stored, s.ids)
+	if err = checkVersion(list, stored, userID); err != nil {
+		return err
+	}
+	if err = checkTree(list, userID); err != nil {
+		return err
+	}
+	if err = checkAssignees(list, stored.Members, userID); err != nil {
+		return err
+	}
+
+	list.Version = stored.Version + 1
+	list.Position = stored.Position
+	list.DeletedAt = nil
+	list.Members = stored.Members
+	entries := updatedList(stored, &list, actorID, s.now())
+	var dropped []string
+	for id := range stored.Todos {
+		if _, exists := list.Todos[id]; !exists {
+			dropped = append(dropped, id)
+		}
+	}
+	todos[list.ID] = &list
+
+	trash, err := s.readTrash(userID)
+	if err != nil {
+		return err
+	}
+	trashed := len(trash.Todos)
+	trash.forgetLive(&list)
+
+	if err = s.writeTodoLists(userID, todos); err != nil {
+		return err
+	}
+	if len(trash.Todos) != trashed {
+		if err = s.writeTrash(userID, trash); err != nil {
+			return err
+		}
+	}
+	if err = s.forgetHistory(userID, list.ID, dropped...); err != nil {
+		return err
+	}
+	return s.appendHistory(userID, entries...)
+}
+
+func (s JsonStore) DeleteTodoList(userID string, listID string) error {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	todos, err := s.readTodoLists(userID)
+	if err != nil {
+		return err
+	}
+
+	trash, err := s.readExpiredTrash(userID)
+	if err != nil {
+		return err
+	}
+
+	if !trashList(trash, todos, listID, s.now()) {
+		return listNotFound(userID, listID)
+	}
+
+	// The trash is written first so a failure can't lose the list.
+	if err = s.writeTrash(userID, trash); err != nil {
+		return err
+	}
+	return s.writeTodoLists(userID, todos)
+}
+
+func (s JsonStore) AddTodo(todo Todo, listID string, userID string, actorID string) (id string, e error) {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	todos, list, err := s.readTodoList(userID, listID)
+	if err != nil {
+		return "", err
+	}
+
+	if err = checkParent(list, todo, userID); err != nil {
+		return "", err
+	}
+	if err = checkRecurrence(todo, listID, userID); err != nil {
+		return "", err
+	}
+	if err = checkAssignee(list, todo, userID); err != nil {
+		return "", err
+	}
+
+	todo.ID = s.ids.NewID()
+	todo.Position = nextTodoPosition(list, todo.ParentID)
+	entry := created(&todo, listID, actorID, s.now())
+	list.Todos[todo.ID] = &todo
+	list.Version++
+
+	if err = s.writeTodoLists(userID, todos); err != nil {
+		return "", err
+	}
+	if err = s.appendHistory(userID, entry); err != nil {
+		return "", err
+	}
+
+	return todo.ID, nil
+}
+
+func (s JsonStore) UpdateTodo(todo Todo, listID string, userID string, actorID string) error {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	todos, list, err := s.readTodoList(userID, listID)
+	if err != nil {
+		return err
+	}
+
+	stored, exists := list.Todos[todo.ID]
+	if !exists {
+		return TodoNotFound(userID, listID, todo.ID)
+	}
+	if err = checkRecurrence(todo, listID, userID); err != nil {
+		return err
+	}
+	if err = checkAssignee(list, todo, userID); err != nil {
+		return err
+	}
+
+	todo.ParentID = stored.ParentID
+	todo.Position = stored.Position
+	entry, changed := updated(*stored, &todo, listID, actorID, s.now())
+	list.Todos[todo.ID] = &todo
+	list.Version++
+
+	if err = s.writeTodoLists(userID, todos); err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+	return s.appendHistory(userID, entry)
+}
+
+func (s JsonStore) DeleteTodo(userID string, listID string, todoID string, actorID string) error {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	todos, list, err := s.readTodoList(userID, listID)
+	if err != nil {
+		return err
+	}
+
+	trash, err := s.readExpiredTrash(userID)
+	if err != nil {
+		return err
+	}
+
+	entries := trashTodo(trash, list, todoID, actorID, s.now())
+	if entries == nil {
+		return TodoNotFound(userID, listID, todoID)
+	}
+	list.Version++
+
+	if err = s.writeTrash(userID, trash); err != nil {
+		return err
+	}
+	if err = s.writeTodoLists(userID, todos); err != nil {
+		return err
+	}
+	return s.appendHistory(userID, entries...)
+}
+
+func (s JsonStore) ToggleTodo(userID string, listID string, todoID string, actorID string) error {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	todos, list, err := s.readTodoList(userID, listID)
+	if err != nil {
+		return err
+	}
+
+	entries := toggleTodo(list, todoID, actorID, s.now())
+	if entries == nil {
+		return TodoNotFound(userID, listID, todoID)
+	}
+	list.Version++
+
+	if err = s.writeTodoLists(userID, todos); err != nil {
+		return err
+	}
+	return s.appendHistory(userID, entries...)
+}
+
+func (s JsonStore) MoveTodoList(userID string, listID string, by int) error {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	todos, err := s.readTodoLists(userID)
+	if err != nil {
+		return err
+	}
+
+	if !moveList(todos, listID, by) {
+		return listNotFound(userID, listID)
+	}
+
+	return s.writeTodoLists(userID, todos)
+}
+
+func (s JsonStore) MoveTodo(userID string, listID string, todoID string, by int, actorID string) error {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	todos, list, err := s.readTodoList(userID, listID)
+	if err != nil {
+		return err
+	}
+
+	if !moveTodo(list, todoID, by) {
+		return TodoNotFound(userID, listID, todoID)
+	}
+	entry := moved(list.Todos[todoID], listID, actorID, s.now())
+	list.Version++
+
+	if err = s.writeTodoLists(userID, todos); err != nil {
+		return err
+	}
+	return s.appendHistory(userID, entry)
+}
+
+func (s JsonStore) FindTodos(userID string, query TodoQuery) ([]FoundTodo, error) {
+	unlock, err := s.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	todos, err := s.readTodoLists(userID)
+	if err != nil {
+		return nil, err
+	}
+	found := findTodos(todos, userID, query)
+	if query.AssigneeID == "" {
+		return found, nil
+	}
+
+	shared, err := s.sharedWith(userID)
+	if err != nil {
+		return nil, err
+	}
+	return findSharedTodos(found, shared, query), nil
+}
+
+func (s JsonStore) TodoHistory(userID string, listID string, todoID string) ([]HistoryEntry, error) {
+	unlock, err := s.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	_, list, err := s.readTodoList(userID, listID)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := list.Todos[todoID]; !exists {
+		return nil, TodoNotFound(userID, listID, todoID)
+	}
+
+	return s.readHistory(userID, listID, todoID)
+}
+
+func (s JsonStore) Trash(userID string) (Trash, error) {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return Trash{}, err
+	}
+	defer unlock()
+
+	if _, err = s.getUser(userID); err != nil {
+		return Trash{}, err
+	}
+
+	trash, err := s.readExpiredTrash(userID)
+	if err != nil {
+		return Trash{}, err
+	}
+	if err = s.writeTrash(userID, trash); err != nil {
+		return Trash{}, err
+	}
+
+	sortTrash(trash)
+	return *trash, nil
+}
+
+func (s JsonStore) RestoreTodoList(userID string, listID string) error {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	todos, err := s.readTodoLists(userID)
+	if err != nil {
+		return err
+	}
+
+	trash, err := s.readExpiredTrash(userID)
+	if err != nil {
+		return err
+	}
+
+	if !restoreList(trash, todos, listID) {
+		return listNotFound(userID, listID)
+	}
+
+	// The lists are written first so a failure can't lose the list.
+	if err = s.writeTodoLists(userID, todos); err != nil {
+		return err
+	}
+	return s.writeTrash(userID, trash)
+}
+
+func (s JsonStore) RestoreTodo(userID string, listID string, todoID string, actorID string) error {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	todos, list, err := s.readTodoList(userID, listID)
+	if err != nil {
+		return err
+	}
+
+	trash, err := s.readExpiredTrash(userID)
+	if err != nil {
+		return err
+	}
+
+	entries := restoreTodo(trash, list, todoID, actorID, s.now())
+	if entries == nil {
+		return TodoNotFound(userID, listID, todoID)
+	}
+	list.Version++
+
+	if err = s.writeTodoLists(userID, todos); err != nil {
+		return err
+	}
+	if err = s.writeTrash(userID, trash); err != nil {
+		return err
+	}
+	return s.appendHistory(userID, entries...)
+}
+
+func (s JsonStore) PurgeTrash(userID string, before time.Time) error {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err = s.getUser(userID); err != nil {
+		return err
+	}
+
+	trash, err := s.readTrash(userID)
+	if err != nil {
+		return err
+	}
+
+	trash.purge(before)
+	return s.writeTrash(userID, trash)
 }
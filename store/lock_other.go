@@ -0,0 +1,9 @@
+//go:build !unix
+
+package store
+
+// lockFile is a no-op where flock isn't available, JsonStore then only
+// serializes access within a single process.
+func lockFile(name string, exclusive bool) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,184 @@
+// Package migrate upgrades a directory of persisted data from one schema
+// version to the next.
+//
+// The schema version lives in a VERSION file at the root of the directory, a
+// directory without one is at version 1. Each Migration moves the data up to
+// its Version and a Registry runs the pending ones in order, backing up the
+// directory first.
+package migrate
+
+import (
+	"ToDo/store/internal/fsutil"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	VersionFile = "VERSION"
+	BackupDir   = "backups"
+)
+
+type Migration struct {
+	// Version is the schema version the data is at once Apply has run.
+	Version     int
+	Description string
+	Apply       func(dir string) error
+}
+
+type Registry struct {
+	migrations []Migration
+	// skip reports files that aren't part of the data, such as lock files,
+	// which are left out of backups and dry runs.
+	skip func(rel string) bool
+}
+
+type Options struct {
+	// DryRun applies the pending migrations to a scratch copy of the
+	// directory, leaving the real one untouched.
+	DryRun bool
+	// NoBackup skips copying the directory into BackupDir before migrating.
+	NoBackup bool
+}
+
+type Result struct {
+	From    int
+	To      int
+	Applied []Migration
+	// Backup is the directory the pre-migration files were copied to, empty
+	// when nothing was backed up.
+	Backup string
+}
+
+func NewRegistry(skip func(rel string) bool) *Registry {
+	return &Registry{skip: skip}
+}
+
+// Register adds m to the registry. Migrations must be registered in order,
+// each one version above the last, starting at version 2.
+func (r *Registry) Register(m Migration) {
+	if m.Version != r.Latest()+1 {
+		panic(fmt.Sprintf("migrate: registered version %d after version %d", m.Version, r.Latest()))
+	}
+	r.migrations = append(r.migrations, m)
+}
+
+// Latest is the version data is at once every migration has run.
+func (r *Registry) Latest() int {
+	if len(r.migrations) == 0 {
+		return 1
+	}
+	return r.migrations[len(r.migrations)-1].Version
+}
+
+// Pending returns the migrations still to run on data at version.
+func (r *Registry) Pending(version int) []Migration {
+	var pending []Migration
+	for _, m := range r.migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+// Run brings dir up to the latest version. Callers are responsible for
+// making sure nothing else writes to dir while it runs.
+func (r *Registry) Run(dir string, opts Options) (Result, error) {
+	version, err := ReadVersion(dir)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{From: version, To: version}
+
+	if version > r.Latest() {
+		return result, fmt.Errorf("migrate: %s is at version %d, newer than the supported %d", dir, version, r.Latest())
+	}
+
+	pending := r.Pending(version)
+	if len(pending) == 0 {
+		return result, nil
+	}
+
+	if opts.DryRun {
+		scratch, err := os.MkdirTemp("", "migrate-dry-run")
+		if err != nil {
+			return result, err
+		}
+		defer os.RemoveAll(scratch)
+
+		if _, err = fsutil.CopyDir(dir, scratch, r.skipWithBackups); err != nil {
+			return result, err
+		}
+		dir = scratch
+	} else if !opts.NoBackup {
+		if result.Backup, err = r.backup(dir, version); err != nil {
+			return result, err
+		}
+	}
+
+	for _, m := range pending {
+		if err = m.Apply(dir); err != nil {
+			return result, fmt.Errorf("migrate: to version %d (%s): %w", m.Version, m.Description, err)
+		}
+		if err = WriteVersion(dir, m.Version); err != nil {
+			return result, err
+		}
+
+		result.To = m.Version
+		result.Applied = append(result.Applied, m)
+	}
+
+	return result, nil
+}
+
+func (r *Registry) skipWithBackups(rel string) bool {
+	if rel == BackupDir {
+		return true
+	}
+	return r.skip != nil && r.skip(rel)
+}
+
+func (r *Registry) backup(dir string, version int) (string, error) {
+	name := fmt.Sprintf("%s-v%d", time.Now().UTC().Format("20060102T150405.000000000"), version)
+	target := filepath.Join(dir, BackupDir, name)
+
+	copied, err := fsutil.CopyDir(dir, target, r.skipWithBackups)
+	if err != nil {
+		os.RemoveAll(target)
+		return "", err
+	}
+
+	if copied == 0 {
+		os.RemoveAll(target)
+		os.Remove(filepath.Join(dir, BackupDir))
+		return "", nil
+	}
+
+	fsutil.SyncDir(target)
+	return target, nil
+}
+
+func ReadVersion(dir string) (int, error) {
+	byteValue, err := os.ReadFile(filepath.Join(dir, VersionFile))
+	if os.IsNotExist(err) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	version, err := strconv.Atoi(strings.TrimSpace(string(byteValue)))
+	if err != nil {
+		return 0, fmt.Errorf("migrate: reading %s: %w", VersionFile, err)
+	}
+	return version, nil
+}
+
+func WriteVersion(dir string, version int) error {
+	return fsutil.WriteFileAtomic(filepath.Join(dir, VersionFile), []byte(strconv.Itoa(version)+"\n"), 0644)
+}
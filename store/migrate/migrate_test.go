@@ -0,0 +1,134 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func appendLine(name string, line string) func(dir string) error {
+	return func(dir string) error {
+		path := filepath.Join(dir, name)
+
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return os.WriteFile(path, append(data, line+"\n"...), 0644)
+	}
+}
+
+func newTestRegistry() *Registry {
+	r := NewRegistry(func(rel string) bool {
+		return rel == ".lock"
+	})
+	r.Register(Migration{Version: 2, Description: "two", Apply: appendLine("data.txt", "two")})
+	r.Register(Migration{Version: 3, Description: "three", Apply: appendLine("data.txt", "three")})
+	return r
+}
+
+func TestRegisterOutOfOrder(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+
+	r := NewRegistry(nil)
+	r.Register(Migration{Version: 3})
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "data.txt"), []byte("one\n"), 0644)
+	os.WriteFile(filepath.Join(dir, ".lock"), nil, 0644)
+
+	result, err := newTestRegistry().Run(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.From != 1 || result.To != 3 || len(result.Applied) != 2 {
+		t.Errorf("got %+v want 1 -> 3 with 2 applied", result)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(dir, "data.txt"))
+	if string(got) != "one\ntwo\nthree\n" {
+		t.Errorf("got %q want %q", got, "one\ntwo\nthree\n")
+	}
+
+	version, err := ReadVersion(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 3 {
+		t.Errorf("got version %d want 3", version)
+	}
+
+	backedUp, err := os.ReadFile(filepath.Join(result.Backup, "data.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(backedUp) != "one\n" {
+		t.Errorf("got backup %q want %q", backedUp, "one\n")
+	}
+	if _, err = os.Stat(filepath.Join(result.Backup, ".lock")); !os.IsNotExist(err) {
+		t.Error("lock file was backed up")
+	}
+}
+
+func TestRunFromIntermediateVersion(t *testing.T) {
+	dir := t.TempDir()
+	WriteVersion(dir, 2)
+
+	result, err := newTestRegistry().Run(dir, Options{NoBackup: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Applied) != 1 || result.Applied[0].Version != 3 {
+		t.Errorf("got %+v want only version 3 applied", result.Applied)
+	}
+	if result.Backup != "" {
+		t.Errorf("got backup %q want none", result.Backup)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(dir, "data.txt"))
+	if string(got) != "three\n" {
+		t.Errorf("got %q want %q", got, "three\n")
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "data.txt"), []byte("one\n"), 0644)
+
+	result, err := newTestRegistry().Run(dir, Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.To != 3 || len(result.Applied) != 2 {
+		t.Errorf("got %+v want 2 migrations applied to the copy", result)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(dir, "data.txt"))
+	if string(got) != "one\n" {
+		t.Errorf("dry run changed data to %q", got)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("dry run left %d entries want 1", len(entries))
+	}
+}
+
+func TestRunNewerVersion(t *testing.T) {
+	dir := t.TempDir()
+	WriteVersion(dir, 4)
+
+	if _, err := newTestRegistry().Run(dir, Options{}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,170 @@
+package store
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+)
+
+type Priority int
+
+const (
+	PriorityNone Priority = iota
+	PriorityLow
+	PriorityMedium
+	PriorityHigh
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityMedium:
+		return "medium"
+	case PriorityHigh:
+		return "high"
+	default:
+		return ""
+	}
+}
+
+// SortOrder picks how SortTodos orders todos.
+type SortOrder int
+
+const (
+	// ByPosition is the order the user arranged the todos in.
+	ByPosition SortOrder = iota
+	// ByPriority puts the highest priority first.
+	ByPriority
+	// ByDue puts the earliest due date first and todos without one last.
+	ByDue
+	// ByCreated puts the oldest todo first, by CreatedAt.
+	ByCreated
+)
+
+func (o SortOrder) String() string {
+	switch o {
+	case ByPriority:
+		return "priority"
+	case ByDue:
+		return "due date"
+	case ByCreated:
+		return "creation time"
+	default:
+		return "position"
+	}
+}
+
+// SortTodos returns the todos ordered by order, falling back on position and
+// then ID so the result is the same every time.
+func SortTodos(todos map[string]*Todo, order SortOrder) []*Todo {
+	sorted := slices.Collect(maps.Values(todos))
+
+	slices.SortFunc(sorted, func(a, b *Todo) int {
+		var c int
+		switch order {
+		case ByPriority:
+			c = cmp.Compare(b.Priority, a.Priority)
+		case ByDue:
+			c = compareDue(a, b)
+		case ByCreated:
+			return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+		}
+		if c != 0 {
+			return c
+		}
+		return cmp.Or(cmp.Compare(a.Position, b.Position), cmp.Compare(a.ID, b.ID))
+	})
+
+	return sorted
+}
+
+func compareDue(a, b *Todo) int {
+	switch {
+	case a.Due == nil && b.Due == nil:
+		return 0
+	case a.Due == nil:
+		return 1
+	case b.Due == nil:
+		return -1
+	default:
+		return a.Due.Compare(*b.Due)
+	}
+}
+
+// SortTodoLists returns the lists in the order the user arranged them.
+func SortTodoLists(lists map[string]*TodoList) []*TodoList {
+	sorted := slices.Collect(maps.Values(lists))
+
+	slices.SortFunc(sorted, func(a, b *TodoList) int {
+		return cmp.Or(cmp.Compare(a.Position, b.Position), cmp.Compare(a.ID, b.ID))
+	})
+
+	return sorted
+}
+
+// nextTodoPosition is the position that puts a new todo at the end of the
+// todos under parentID in list.
+func nextTodoPosition(list *TodoList, parentID string) int {
+	next := 0
+	for _, todo := range list.Todos {
+		if todo.ParentID == parentID {
+			next = max(next, todo.Position+1)
+		}
+	}
+	return next
+}
+
+func nextListPosition(lists map[string]*TodoList) int {
+	next := 0
+	for _, list := range lists {
+		next = max(next, list.Position+1)
+	}
+	return next
+}
+
+// moveTodo moves the todo by places among the todos with the same parent, up
+// towards the start when negative, stopping at either end. Those todos are
+// renumbered from 0 so ties left by older data are resolved.
+func moveTodo(list *TodoList, todoID string, by int) bool {
+	todo, exists := list.Todos[todoID]
+	if !exists {
+		return false
+	}
+	sorted := Subtasks(list.Todos, parentOf(list.Todos, todo), ByPosition)
+
+	from := slices.IndexFunc(sorted, func(todo *Todo) bool { return todo.ID == todoID })
+	if from < 0 {
+		return false
+	}
+
+	sorted = moveElement(sorted, from, by)
+	for i, todo := range sorted {
+		todo.Position = i
+	}
+	return true
+}
+
+// moveList is moveTodo for a user's lists.
+func moveList(lists map[string]*TodoList, listID string, by int) bool {
+	sorted := SortTodoLists(lists)
+
+	from := slices.IndexFunc(sorted, func(list *TodoList) bool { return list.ID == listID })
+	if from < 0 {
+		return false
+	}
+
+	sorted = moveElement(sorted, from, by)
+	for i, list := range sorted {
+		list.Position = i
+	}
+	return true
+}
+
+func moveElement[T any](s []T, from int, by int) []T {
+	to := min(max(from+by, 0), len(s)-1)
+
+	element := s[from]
+	s = slices.Delete(s, from, from+1)
+	return slices.Insert(s, to, element)
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSortTodos(t *testing.T) {
+	soon := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	later := soon.AddDate(0, 1, 0)
+
+	todos := map[string]*Todo{
+		"01A": {ID: "01A", Title: "a", Position: 2, Priority: PriorityLow, CreatedAt: soon},
+		"01B": {ID: "01B", Title: "b", Position: 0, Due: &later, CreatedAt: soon},
+		"01C": {ID: "01C", Title: "c", Position: 1, Priority: PriorityHigh, Due: &soon, CreatedAt: later},
+		"01D": {ID: "01D", Title: "d", Position: 1, CreatedAt: soon.Add(-time.Hour)},
+	}
+
+	tests := []struct {
+		order SortOrder
+		want  []string
+	}{
+		{ByPosition, []string{"b", "c", "d", "a"}},
+		{ByPriority, []string{"c", "a", "b", "d"}},
+		{ByDue, []string{"c", "b", "d", "a"}},
+		{ByCreated, []string{"d", "a", "b", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.order.String(), func(t *testing.T) {
+			var got []string
+			for _, todo := range SortTodos(todos, tt.order) {
+				got = append(got, todo.Title)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
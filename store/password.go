@@ -0,0 +1,30 @@
+package store
+
+import (
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the shortest password SetPassword accepts.
+const MinPasswordLength = 8
+
+// hashPassword checks password is long enough for SetPassword and hashes
+// it. bcrypt only looks at the first 72 bytes so longer ones are refused
+// rather than silently cut short.
+func hashPassword(userID string, password string) ([]byte, error) {
+	if len(password) < MinPasswordLength {
+		return nil, errorf(ErrInvalidUser, "password for user ID %s is shorter than %d characters", userID, MinPasswordLength)
+	}
+	if len(password) > 72 {
+		return nil, errorf(ErrInvalidUser, "password for user ID %s is longer than 72 bytes", userID)
+	}
+
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
+// checkPassword is CheckPassword once the user has been loaded.
+func checkPassword(user User, password string) error {
+	if len(user.PasswordHash) == 0 || bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(password)) != nil {
+		return errorf(ErrUnauthorized, "wrong password for user ID %s", user.ID)
+	}
+	return nil
+}
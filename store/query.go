@@ -0,0 +1,88 @@
+package store
+
+import (
+	"slices"
+	"strings"
+)
+
+// TodoQuery picks todos out of all of a user's lists for FindTodos. Empty
+// fields match every todo.
+type TodoQuery struct {
+	Tag string
+	// AssigneeID matches the todos assigned to that user. As those are as
+	// likely to be on lists others share, a query with one searches the
+	// lists shared with the user as well.
+	AssigneeID string
+}
+
+// FoundTodo is a todo returned by FindTodos along with the list holding it
+// and the user owning that list.
+type FoundTodo struct {
+	OwnerID  string
+	ListID   string
+	ListName string
+	Todo
+}
+
+func (q TodoQuery) matches(todo *Todo) bool {
+	if q.Tag != "" && !todo.HasTag(q.Tag) {
+		return false
+	}
+	if q.AssigneeID != "" && todo.AssigneeID != q.AssigneeID {
+		return false
+	}
+	return true
+}
+
+// findTodos runs query over the lists of ownerID, returning the matches
+// ordered by list and then by position within the list.
+func findTodos(lists map[string]*TodoList, ownerID string, query TodoQuery) []FoundTodo {
+	found := []FoundTodo{}
+
+	for _, list := range SortTodoLists(lists) {
+		for _, todo := range SortTodos(list.Todos, ByPosition) {
+			if query.matches(todo) {
+				found = append(found, FoundTodo{OwnerID: ownerID, ListID: list.ID, ListName: list.Name, Todo: cloneTodo(*todo)})
+			}
+		}
+	}
+
+	return found
+}
+
+// findSharedTodos is findTodos over lists shared with the user, which only
+// an assignee query looks at. The matches follow those of the user's own
+// lists, in the order of shared.
+func findSharedTodos(found []FoundTodo, shared []SharedList, query TodoQuery) []FoundTodo {
+	if query.AssigneeID == "" {
+		return found
+	}
+	for _, list := range shared {
+		found = append(found, findTodos(map[string]*TodoList{list.ID: &list.TodoList}, list.OwnerID, query)...)
+	}
+	return found
+}
+
+// NormalizeTag puts a tag in the form it is stored in, lower case and without
+// a leading #, so #Work and work are the same tag.
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+// NormalizeTags normalizes every tag, dropping empty and repeated ones.
+func NormalizeTags(tags []string) []string {
+	var normalized []string
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		if tag == "" || slices.Contains(normalized, tag) {
+			continue
+		}
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// HasTag reports whether the todo carries tag, in any of its spellings.
+func (t Todo) HasTag(tag string) bool {
+	return slices.Contains(t.Tags, NormalizeTag(tag))
+}
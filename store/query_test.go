@@ -0,0 +1,15 @@
+package store
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	got := NormalizeTags([]string{"#Work", " home ", "work", "", "#", "Home"})
+	want := []string{"work", "home"}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
@@ -0,0 +1,378 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is how often a Recurrence repeats before INTERVAL is applied.
+type Frequency int
+
+const (
+	Daily Frequency = iota + 1
+	Weekly
+	Monthly
+	Yearly
+)
+
+var frequencyNames = map[Frequency]string{
+	Daily:   "DAILY",
+	Weekly:  "WEEKLY",
+	Monthly: "MONTHLY",
+	Yearly:  "YEARLY",
+}
+
+func (f Frequency) String() string {
+	return frequencyNames[f]
+}
+
+var weekdayNames = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+const untilDateLayout = "20060102"
+const untilTimeLayout = "20060102T150405Z"
+
+// Recurrence is the subset of an RFC 5545 RRULE a todo can repeat by: FREQ of
+// DAILY, WEEKLY, MONTHLY or YEARLY with INTERVAL, COUNT, UNTIL, BYDAY (plain
+// weekdays with DAILY or WEEKLY) and BYMONTHDAY (with MONTHLY, negative days
+// counting back from the end of the month).
+//
+// Occurrences keep the wall clock time of the one before them in its
+// location, so a todo due at 9:00 stays due at 9:00 across a DST change
+// as long as that location is a zone rather than a fixed offset, see
+// Todo.TimeZone.
+// Like RFC 5545, dates that don't exist, such as the 31st of a short month,
+// are skipped rather than moved.
+type Recurrence struct {
+	Freq       Frequency
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay []int
+	// Count is the number of occurrences left including the current one,
+	// zero when unlimited.
+	Count int
+	// Until is the last time an occurrence may fall on, nil when unlimited.
+	// When untilDate is set only its date counts.
+	Until     *time.Time
+	untilDate bool
+}
+
+// ParseRecurrence parses a rule such as "FREQ=WEEKLY;BYDAY=MO,TH", with or
+// without a leading "RRULE:".
+func ParseRecurrence(rule string) (Recurrence, error) {
+	r := Recurrence{Interval: 1}
+
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+	if rule == "" {
+		return r, fmt.Errorf("empty recurrence rule")
+	}
+
+	for _, part := range strings.Split(rule, ";") {
+		name, value, found := strings.Cut(part, "=")
+		if !found || value == "" {
+			return r, fmt.Errorf("recurrence rule part %q isn't NAME=VALUE", part)
+		}
+
+		var err error
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			r.Freq, err = parseFrequency(value)
+		case "INTERVAL":
+			r.Interval, err = parsePositive(name, value)
+		case "COUNT":
+			r.Count, err = parsePositive(name, value)
+		case "UNTIL":
+			err = r.parseUntil(value)
+		case "BYDAY":
+			r.ByDay, err = parseWeekdays(value)
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = parseMonthDays(value)
+		default:
+			err = fmt.Errorf("unsupported recurrence rule part %s", name)
+		}
+		if err != nil {
+			return r, err
+		}
+	}
+
+	switch {
+	case r.Freq == 0:
+		return r, fmt.Errorf("recurrence rule %q has no FREQ", rule)
+	case len(r.ByDay) > 0 && r.Freq != Daily && r.Freq != Weekly:
+		return r, fmt.Errorf("BYDAY is only supported with DAILY or WEEKLY")
+	case len(r.ByMonthDay) > 0 && r.Freq != Monthly:
+		return r, fmt.Errorf("BYMONTHDAY is only supported with MONTHLY")
+	case r.Count > 0 && r.Until != nil:
+		return r, fmt.Errorf("a recurrence rule can't have both COUNT and UNTIL")
+	}
+
+	return r, nil
+}
+
+func parseFrequency(value string) (Frequency, error) {
+	for freq, name := range frequencyNames {
+		if strings.EqualFold(value, name) {
+			return freq, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported FREQ %s", value)
+}
+
+func parsePositive(name string, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s must be a positive number, not %s", name, value)
+	}
+	return n, nil
+}
+
+func (r *Recurrence) parseUntil(value string) error {
+	if until, err := time.Parse(untilTimeLayout, value); err == nil {
+		r.Until = &until
+		return nil
+	}
+
+	until, err := time.Parse(untilDateLayout, value)
+	if err != nil {
+		return fmt.Errorf("UNTIL must be YYYYMMDD or YYYYMMDDTHHMMSSZ, not %s", value)
+	}
+	r.Until = &until
+	r.untilDate = true
+	return nil
+}
+
+func parseWeekdays(value string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	for _, name := range strings.Split(value, ",") {
+		day := slices.Index(weekdayNames, strings.ToUpper(name))
+		if day < 0 {
+			return nil, fmt.Errorf("unsupported BYDAY %s, only plain weekdays such as MO are", name)
+		}
+		days = append(days, time.Weekday(day))
+	}
+	return days, nil
+}
+
+func parseMonthDays(value string) ([]int, error) {
+	var days []int
+	for _, s := range strings.Split(value, ",") {
+		day, err := strconv.Atoi(s)
+		if err != nil || day == 0 || day < -31 || day > 31 {
+			return nil, fmt.Errorf("BYMONTHDAY must be between 1 and 31 or -31 and -1, not %s", s)
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+// String formats the rule in RRULE form, without the "RRULE:" prefix.
+func (r Recurrence) String() string {
+	parts := []string{"FREQ=" + r.Freq.String()}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		var names []string
+		for _, day := range r.ByDay {
+			names = append(names, weekdayNames[day])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(names, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		var days []string
+		for _, day := range r.ByMonthDay {
+			days = append(days, strconv.Itoa(day))
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if r.Until != nil && r.untilDate {
+		parts = append(parts, "UNTIL="+r.Until.Format(untilDateLayout))
+	} else if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilTimeLayout))
+	}
+	return strings.Join(parts, ";")
+}
+
+// maxPeriods bounds the search for the next occurrence, so a rule that can
+// never match again, like the 31st of every 12th month starting in April,
+// ends rather than looping.
+const maxPeriods = 1000
+
+// Next returns the first occurrence after from, taking from as the start of
+// the rule, and false when there is none before UNTIL. COUNT is left to the
+// caller.
+func (r Recurrence) Next(from time.Time) (time.Time, bool) {
+	interval := max(r.Interval, 1)
+
+	for period := 0; period < maxPeriods; period++ {
+		for _, next := range r.candidates(from, period*interval) {
+			if !next.After(from) {
+				continue
+			}
+			if r.ended(next) {
+				return time.Time{}, false
+			}
+			return next, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// candidates lists, in order, the times that could occur in the period the
+// given number of FREQ units after the one holding from.
+func (r Recurrence) candidates(from time.Time, offset int) []time.Time {
+	year, month, day := from.Date()
+	// on is the time on a day at from's clock time, days past the end of the
+	// month carry over into the next.
+	on := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, from.Hour(), from.Minute(), from.Second(), from.Nanosecond(), from.Location())
+	}
+	exists := func(year int, month time.Month, day int) bool {
+		return day >= 1 && day <= daysIn(year, month)
+	}
+
+	var times []time.Time
+	switch r.Freq {
+	case Daily:
+		t := on(year, month, day+offset)
+		if len(r.ByDay) == 0 || slices.Contains(r.ByDay, t.Weekday()) {
+			times = append(times, t)
+		}
+	case Weekly:
+		// Weeks start on Monday, the RFC 5545 default for WKST.
+		monday := day - (int(from.Weekday())+6)%7 + 7*offset
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []time.Weekday{from.Weekday()}
+		}
+		for i := range 7 {
+			if t := on(year, month, monday+i); slices.Contains(days, t.Weekday()) {
+				times = append(times, t)
+			}
+		}
+	case Monthly:
+		first := time.Date(year, month+time.Month(offset), 1, 0, 0, 0, 0, time.UTC)
+		days := r.ByMonthDay
+		if len(days) == 0 {
+			days = []int{day}
+		}
+		for _, d := range days {
+			if d < 0 {
+				d += daysIn(first.Year(), first.Month()) + 1
+			}
+			if exists(first.Year(), first.Month(), d) {
+				times = append(times, on(first.Year(), first.Month(), d))
+			}
+		}
+		slices.SortFunc(times, time.Time.Compare)
+		times = slices.Compact(times)
+	case Yearly:
+		if exists(year+offset, month, day) {
+			times = append(times, on(year+offset, month, day))
+		}
+	}
+	return times
+}
+
+// Matches reports whether t falls on a day BYDAY and BYMONTHDAY allow, which
+// makes it a fitting first occurrence.
+func (r Recurrence) Matches(t time.Time) bool {
+	if len(r.ByDay) > 0 && !slices.Contains(r.ByDay, t.Weekday()) {
+		return false
+	}
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+
+	year, month, day := t.Date()
+	return slices.ContainsFunc(r.ByMonthDay, func(d int) bool {
+		return d == day || d+daysIn(year, month)+1 == day
+	})
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func (r Recurrence) ended(t time.Time) bool {
+	switch {
+	case r.Until == nil:
+		return false
+	case r.untilDate:
+		year, month, day := t.Date()
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC).After(*r.Until)
+	default:
+		return t.After(*r.Until)
+	}
+}
+
+// checkRecurrence makes sure a recurring todo has a rule that parses and a
+// due date to repeat from, and that its time zone is known.
+func checkRecurrence(todo Todo, listID string, userID string) error {
+	if _, err := time.LoadLocation(todo.TimeZone); err != nil {
+		return errorf(ErrInvalidTodo, "todo with ID %s in list ID %s for user ID %s has unknown time zone %q", todo.ID, listID, userID, todo.TimeZone)
+	}
+	if todo.Recurrence == "" {
+		return nil
+	}
+
+	if _, err := ParseRecurrence(todo.Recurrence); err != nil {
+		return errorf(ErrInvalidTodo, "todo with ID %s in list ID %s for user ID %s: %v", todo.ID, listID, userID, err)
+	}
+	if todo.Due == nil {
+		return errorf(ErrInvalidTodo, "todo with ID %s in list ID %s for user ID %s repeats but has no due date", todo.ID, listID, userID)
+	}
+	return nil
+}
+
+// nextOccurrence moves a recurring todo on to its next occurrence in its
+// time zone, keeping the time between its start and due dates. It reports
+// false when the rule has run out, leaving the todo to be completed instead.
+func nextOccurrence(todo *Todo) bool {
+	if todo.Recurrence == "" || todo.Due == nil {
+		return false
+	}
+
+	r, err := ParseRecurrence(todo.Recurrence)
+	if err != nil || r.Count == 1 {
+		return false
+	}
+
+	from := *todo.Due
+	if todo.TimeZone != "" {
+		loc, err := time.LoadLocation(todo.TimeZone)
+		if err != nil {
+			return false
+		}
+		from = from.In(loc)
+	}
+
+	due, ok := r.Next(from)
+	if !ok {
+		return false
+	}
+
+	if todo.Start != nil {
+		start := todo.Start.AddDate(0, 0, daysBetween(from, due))
+		todo.Start = &start
+	}
+	todo.Due = &due
+
+	if r.Count > 1 {
+		r.Count--
+		todo.Recurrence = r.String()
+	}
+	return true
+}
+
+// daysBetween counts calendar days from a to b, each in its own location.
+func daysBetween(a time.Time, b time.Time) int {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return int(time.Date(by, bm, bd, 0, 0, 0, 0, time.UTC).Sub(time.Date(ay, am, ad, 0, 0, 0, 0, time.UTC)).Hours() / 24)
+}
@@ -0,0 +1,242 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecurrenceNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone data: ", err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone data: ", err)
+	}
+
+	tests := []struct {
+		name string
+		rule string
+		from time.Time
+		want []time.Time
+	}{
+		{
+			"daily across spring forward keeps the clock time",
+			"FREQ=DAILY",
+			time.Date(2024, time.March, 30, 9, 0, 0, 0, berlin),
+			[]time.Time{
+				time.Date(2024, time.March, 31, 9, 0, 0, 0, berlin),
+				time.Date(2024, time.April, 1, 9, 0, 0, 0, berlin),
+			},
+		},
+		{
+			"weekly across fall back keeps the clock time",
+			"FREQ=WEEKLY",
+			time.Date(2024, time.October, 29, 23, 59, 0, 0, newYork),
+			[]time.Time{
+				time.Date(2024, time.November, 5, 23, 59, 0, 0, newYork),
+				time.Date(2024, time.November, 12, 23, 59, 0, 0, newYork),
+			},
+		},
+		{
+			"time in the skipped hour moves past it",
+			"FREQ=DAILY",
+			time.Date(2024, time.March, 30, 2, 30, 0, 0, berlin),
+			[]time.Time{
+				time.Date(2024, time.March, 31, 3, 30, 0, 0, berlin),
+				time.Date(2024, time.April, 1, 3, 30, 0, 0, berlin),
+			},
+		},
+		{
+			"every other day",
+			"FREQ=DAILY;INTERVAL=2",
+			time.Date(2024, time.February, 28, 8, 0, 0, 0, time.UTC),
+			[]time.Time{
+				time.Date(2024, time.March, 1, 8, 0, 0, 0, time.UTC),
+				time.Date(2024, time.March, 3, 8, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"weekdays",
+			"FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR",
+			time.Date(2024, time.March, 8, 8, 0, 0, 0, time.UTC), // a Friday
+			[]time.Time{
+				time.Date(2024, time.March, 11, 8, 0, 0, 0, time.UTC),
+				time.Date(2024, time.March, 12, 8, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"fortnightly on two days",
+			"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR",
+			time.Date(2024, time.March, 4, 8, 0, 0, 0, time.UTC), // a Monday
+			[]time.Time{
+				time.Date(2024, time.March, 8, 8, 0, 0, 0, time.UTC),
+				time.Date(2024, time.March, 18, 8, 0, 0, 0, time.UTC),
+				time.Date(2024, time.March, 22, 8, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"monthly on the 31st skips short months",
+			"FREQ=MONTHLY",
+			time.Date(2024, time.January, 31, 12, 0, 0, 0, time.UTC),
+			[]time.Time{
+				time.Date(2024, time.March, 31, 12, 0, 0, 0, time.UTC),
+				time.Date(2024, time.May, 31, 12, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"last day of the month",
+			"FREQ=MONTHLY;BYMONTHDAY=-1",
+			time.Date(2024, time.January, 31, 12, 0, 0, 0, time.UTC),
+			[]time.Time{
+				time.Date(2024, time.February, 29, 12, 0, 0, 0, time.UTC),
+				time.Date(2024, time.March, 31, 12, 0, 0, 0, time.UTC),
+				time.Date(2024, time.April, 30, 12, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"twice a month",
+			"FREQ=MONTHLY;BYMONTHDAY=15,1",
+			time.Date(2024, time.December, 15, 12, 0, 0, 0, time.UTC),
+			[]time.Time{
+				time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC),
+				time.Date(2025, time.January, 15, 12, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"quarterly across the year end",
+			"FREQ=MONTHLY;INTERVAL=3",
+			time.Date(2024, time.November, 30, 12, 0, 0, 0, time.UTC),
+			[]time.Time{
+				time.Date(2025, time.May, 30, 12, 0, 0, 0, time.UTC),
+				time.Date(2025, time.August, 30, 12, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"leap day waits for a leap year",
+			"FREQ=YEARLY",
+			time.Date(2024, time.February, 29, 12, 0, 0, 0, time.UTC),
+			[]time.Time{
+				time.Date(2028, time.February, 29, 12, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"until a date includes that day",
+			"FREQ=DAILY;UNTIL=20240302",
+			time.Date(2024, time.February, 29, 23, 0, 0, 0, berlin),
+			[]time.Time{
+				time.Date(2024, time.March, 1, 23, 0, 0, 0, berlin),
+				time.Date(2024, time.March, 2, 23, 0, 0, 0, berlin),
+			},
+		},
+		{
+			"until a time",
+			"FREQ=WEEKLY;UNTIL=20240315T000000Z",
+			time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC),
+			[]time.Time{
+				time.Date(2024, time.March, 8, 9, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ParseRecurrence(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			from := tt.from
+			for _, want := range tt.want {
+				got, ok := r.Next(from)
+				if !ok || !got.Equal(want) {
+					t.Fatalf("after %v got %v, %t want %v", from, got, ok, want)
+				}
+				from = got
+			}
+
+			if r.Until == nil {
+				return
+			}
+			if got, ok := r.Next(from); ok {
+				t.Errorf("after %v got %v want no more before UNTIL", from, got)
+			}
+		})
+	}
+}
+
+func TestParseRecurrence(t *testing.T) {
+	valid := map[string]string{
+		"RRULE:FREQ=WEEKLY;BYDAY=MO": "FREQ=WEEKLY;BYDAY=MO",
+		"freq=daily;interval=1":      "FREQ=DAILY",
+		"FREQ=MONTHLY;BYMONTHDAY=-1": "FREQ=MONTHLY;BYMONTHDAY=-1",
+		"FREQ=DAILY;COUNT=3":         "FREQ=DAILY;COUNT=3",
+		"FREQ=YEARLY;UNTIL=20301231": "FREQ=YEARLY;UNTIL=20301231",
+	}
+	for rule, want := range valid {
+		r, err := ParseRecurrence(rule)
+		if err != nil {
+			t.Errorf("%q: %v", rule, err)
+			continue
+		}
+		if got := r.String(); got != want {
+			t.Errorf("%q: got %q want %q", rule, got, want)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"FREQ=HOURLY",
+		"INTERVAL=2",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=MONTHLY;BYDAY=MO",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=DAILY;COUNT=2;UNTIL=20300101",
+		"FREQ=DAILY;UNTIL=tomorrow",
+		"FREQ=DAILY;WKST=SU",
+	}
+	for _, rule := range invalid {
+		if _, err := ParseRecurrence(rule); err == nil {
+			t.Errorf("%q: expected an error", rule)
+		}
+	}
+}
+
+func TestNextOccurrence(t *testing.T) {
+	start := time.Date(2024, time.March, 4, 9, 0, 0, 0, time.UTC)
+	due := time.Date(2024, time.March, 5, 17, 0, 0, 0, time.UTC)
+	todo := Todo{Title: "bins", Start: &start, Due: &due, Recurrence: "FREQ=WEEKLY;COUNT=2"}
+
+	if !nextOccurrence(&todo) {
+		t.Fatal("expected a next occurrence")
+	}
+	if want := due.AddDate(0, 0, 7); !todo.Due.Equal(want) {
+		t.Errorf("got due %v want %v", todo.Due, want)
+	}
+	if want := start.AddDate(0, 0, 7); !todo.Start.Equal(want) {
+		t.Errorf("got start %v want %v", todo.Start, want)
+	}
+	if todo.Recurrence != "FREQ=WEEKLY;COUNT=1" {
+		t.Errorf("got recurrence %q want the count to go down", todo.Recurrence)
+	}
+
+	if nextOccurrence(&todo) {
+		t.Error("expected the last occurrence to have no next")
+	}
+}
+
+func TestRecurrenceMatches(t *testing.T) {
+	r, err := ParseRecurrence("FREQ=MONTHLY;BYMONTHDAY=1,-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for day, want := range map[int]bool{1: true, 15: false, 29: true} {
+		if got := r.Matches(time.Date(2024, time.February, day, 0, 0, 0, 0, time.UTC)); got != want {
+			t.Errorf("February %d: got %t want %t", day, got, want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package store
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// Role is what a user may do with a list. The user whose lists hold it is
+// its owner, the users it is shared with are its members.
+type Role string
+
+const (
+	// RoleOwner may do anything, including sharing and deleting the list.
+	RoleOwner Role = "owner"
+	// RoleEditor may change the list and its todos.
+	RoleEditor Role = "editor"
+	// RoleViewer may only look.
+	RoleViewer Role = "viewer"
+)
+
+var roleRanks = map[Role]int{RoleViewer: 1, RoleEditor: 2, RoleOwner: 3}
+
+// Allows reports whether the role may do what needs at least needed.
+func (r Role) Allows(needed Role) bool {
+	return roleRanks[r] > 0 && roleRanks[r] >= roleRanks[needed]
+}
+
+// RoleOf returns the role userID has on a list owned by ownerID, empty when
+// they have none.
+func (l TodoList) RoleOf(ownerID string, userID string) Role {
+	if userID == ownerID {
+		return RoleOwner
+	}
+	return l.Members[userID]
+}
+
+// SharedList is a list another user shared, as SharedTodoLists returns it.
+type SharedList struct {
+	TodoList
+	OwnerID string
+	Role    Role
+}
+
+func memberNotFound(userID string, listID string, memberID string) error {
+	return errorf(ErrMemberNotFound, "user ID %s isn't a member of list ID %s of user ID %s", memberID, listID, userID)
+}
+
+// checkShare reports whether the owner's list can be shared with memberID as
+// role. Lists can only be shared as RoleEditor or RoleViewer and not with
+// their owner.
+func checkShare(userID string, listID string, memberID string, role Role) error {
+	if role != RoleEditor && role != RoleViewer {
+		return errorf(ErrInvalidMember, "lists are shared as %q or %q, not %q", RoleEditor, RoleViewer, role)
+	}
+	if memberID == userID {
+		return errorf(ErrInvalidMember, "list ID %s can't be shared with user ID %s, who owns it", listID, userID)
+	}
+	return nil
+}
+
+func shareList(list *TodoList, memberID string, role Role) {
+	if list.Members == nil {
+		list.Members = make(map[string]Role)
+	}
+	list.Members[memberID] = role
+}
+
+func unshareList(list *TodoList, userID string, memberID string, now time.Time) ([]HistoryEntry, error) {
+	if _, exists := list.Members[memberID]; !exists {
+		return nil, memberNotFound(userID, list.ID, memberID)
+	}
+
+	return removeMember(list, userID, memberID, now), nil
+}
+
+// removeMember takes memberID off the list of userID and off the todos they
+// were assigned there, returning the entries for those, see unassign.
+func removeMember(list *TodoList, userID string, memberID string, now time.Time) []HistoryEntry {
+	delete(list.Members, memberID)
+	if len(list.Members) == 0 {
+		list.Members = nil
+	}
+	return unassign(list, memberID, userID, now)
+}
+
+// sharedWith collects the lists of users that are shared with memberID.
+func sharedWith(users map[string]*User, memberID string) []SharedList {
+	shared := []SharedList{}
+	for _, user := range users {
+		for _, list := range user.TodoLists {
+			if role, exists := list.Members[memberID]; exists && list.DeletedAt == nil {
+				shared = append(shared, SharedList{TodoList: cloneTodoList(*list), OwnerID: user.ID, Role: role})
+			}
+		}
+	}
+
+	sortShared(shared)
+	return shared
+}
+
+// sortShared orders shared lists by owner, then as the owner orders them.
+func sortShared(shared []SharedList) {
+	slices.SortFunc(shared, func(a, b SharedList) int {
+		return cmp.Or(cmp.Compare(a.OwnerID, b.OwnerID), cmp.Compare(a.Position, b.Position), cmp.Compare(a.ID, b.ID))
+	})
+}
+
+// listPointers returns pointers to the lists in the trash, for changing
+// them in place.
+func (t *Trash) listPointers() []*TodoList {
+	lists := make([]*TodoList, len(t.Lists))
+	for i := range t.Lists {
+		lists[i] = &t.Lists[i]
+	}
+	return lists
+}
+
+// forgetMember drops memberID from every list of userID in lists, reporting
+// whether any was shared with them and returning the entries for the todos
+// they were assigned.
+func forgetMember(lists []*TodoList, userID string, memberID string, now time.Time) (bool, []HistoryEntry) {
+	forgot := false
+	var entries []HistoryEntry
+	for _, list := range lists {
+		if _, exists := list.Members[memberID]; exists {
+			entries = append(entries, removeMember(list, userID, memberID, now)...)
+			forgot = true
+		}
+	}
+	return forgot, entries
+}
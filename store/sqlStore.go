@@ -0,0 +1,1652 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+)
+
+// sqlMigrations build the schema, each entry runs once in order and the
+// number applied is kept in schema_version. Only append to this list.
+var sqlMigrations = []string{
+	`CREATE TABLE users (
+		id   TEXT PRIMARY KEY,
+		name TEXT NOT NULL
+	);
+	CREATE TABLE lists (
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		id      TEXT NOT NULL,
+		name    TEXT NOT NULL,
+		version INTEGER NOT NULL,
+		PRIMARY KEY (user_id, id)
+	);
+	CREATE TABLE todos (
+		user_id   TEXT NOT NULL,
+		list_id   TEXT NOT NULL,
+		id        TEXT NOT NULL,
+		title     TEXT NOT NULL,
+		completed BOOLEAN NOT NULL DEFAULT FALSE,
+		PRIMARY KEY (user_id, list_id, id),
+		FOREIGN KEY (user_id, list_id) REFERENCES lists(user_id, id) ON DELETE CASCADE
+	);
+	CREATE INDEX lists_user_id ON lists(user_id);
+	CREATE INDEX todos_list ON todos(user_id, list_id);
+	CREATE INDEX todos_user_completed ON todos(user_id, completed);`,
+	`ALTER TABLE todos ADD COLUMN start TEXT;
+	ALTER TABLE todos ADD COLUMN due TEXT;`,
+	`ALTER TABLE lists ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE todos ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE todos ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;`,
+	`CREATE TABLE todo_tags (
+		user_id  TEXT NOT NULL,
+		list_id  TEXT NOT NULL,
+		todo_id  TEXT NOT NULL,
+		tag      TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		PRIMARY KEY (user_id, list_id, todo_id, tag),
+		FOREIGN KEY (user_id, list_id, todo_id) REFERENCES todos(user_id, list_id, id) ON DELETE CASCADE
+	);
+	CREATE INDEX todo_tags_user_tag ON todo_tags(user_id, tag);`,
+	`ALTER TABLE todos ADD COLUMN parent_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE lists ADD COLUMN complete_subtasks BOOLEAN NOT NULL DEFAULT FALSE;`,
+	`ALTER TABLE todos ADD COLUMN recurrence TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE todos ADD COLUMN notes TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE todos ADD COLUMN created_at TEXT;
+	ALTER TABLE todos ADD COLUMN updated_at TEXT;
+	ALTER TABLE todos ADD COLUMN completed_at TEXT;
+	CREATE TABLE todo_history (
+		seq        INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id    TEXT NOT NULL,
+		list_id    TEXT NOT NULL,
+		todo_id    TEXT NOT NULL,
+		changed_by TEXT NOT NULL,
+		at         TEXT NOT NULL,
+		action     TEXT NOT NULL,
+		fields     TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX todo_history_todo ON todo_history(user_id, list_id, todo_id);`,
+	`ALTER TABLE lists ADD COLUMN deleted_at TEXT;
+	ALTER TABLE todos ADD COLUMN deleted_at TEXT;`,
+	`ALTER TABLE users ADD COLUMN password_hash BLOB;`,
+	`CREATE TABLE api_keys (
+		user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		id         TEXT NOT NULL,
+		name       TEXT NOT NULL,
+		scope      TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		expires_at TEXT,
+		hash       BLOB NOT NULL UNIQUE,
+		PRIMARY KEY (user_id, id)
+	);`,
+	`CREATE TABLE list_members (
+		user_id   TEXT NOT NULL,
+		list_id   TEXT NOT NULL,
+		member_id TEXT NOT NULL,
+		role      TEXT NOT NULL,
+		PRIMARY KEY (user_id, list_id, member_id),
+		FOREIGN KEY (user_id, list_id) REFERENCES lists(user_id, id) ON DELETE CASCADE
+	);
+	CREATE INDEX list_members_member ON list_members(member_id);`,
+	`ALTER TABLE todos ADD COLUMN assignee_id TEXT NOT NULL DEFAULT '';
+	CREATE INDEX todos_assignee ON todos(assignee_id);`,
+	`ALTER TABLE todos ADD COLUMN time_zone TEXT NOT NULL DEFAULT '';`,
+}
+
+// SQLStore keeps users, lists and todos in normalized tables through
+// database/sql. Queries are written for SQLite, every operation runs in its
+// own transaction. Lists and todos in the trash stay in their tables with
+// deleted_at set.
+type SQLStore struct {
+	db        *sql.DB
+	ids       IDGenerator
+	now       func() time.Time
+	retention time.Duration
+}
+
+func NewSQLStore(db *sql.DB, opts ...Option) (*SQLStore, error) {
+	o := applyOptions(opts)
+
+	s := &SQLStore{db: db, ids: o.ids, now: o.now, retention: o.retention}
+
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *SQLStore) migrate() error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`); err != nil {
+			return err
+		}
+
+		var version int
+		err := tx.QueryRow(`SELECT version FROM schema_version`).Scan(&version)
+		if errors.Is(err, sql.ErrNoRows) {
+			if _, err = tx.Exec(`INSERT INTO schema_version (version) VALUES (0)`); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+
+		if version > len(sqlMigrations) {
+			return fmt.Errorf("database schema version %d is newer than the supported %d", version, len(sqlMigrations))
+		}
+
+		for i, migration := range sqlMigrations[version:] {
+			if _, err = tx.Exec(migration); err != nil {
+				return fmt.Errorf("migrating database to version %d: %w", version+i+1, err)
+			}
+		}
+
+		_, err = tx.Exec(`UPDATE schema_version SET version = ?`, len(sqlMigrations))
+		return err
+	})
+}
+
+func (s *SQLStore) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err = fn(tx); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
+func sqlUserExists(tx *sql.Tx, userID string) error {
+	var exists bool
+	err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE id = ?)`, userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return userNotFound(userID)
+	}
+	return nil
+}
+
+// sqlListVersion returns the stored version of a list, checking that both the
+// user and the list exist and that the list isn't in the trash.
+func sqlListVersion(tx *sql.Tx, userID string, listID string) (int, error) {
+	if err := sqlUserExists(tx, userID); err != nil {
+		return 0, err
+	}
+
+	var version int
+	err := tx.QueryRow(`SELECT version FROM lists WHERE user_id = ? AND id = ? AND deleted_at IS NULL`, userID, listID).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, listNotFound(userID, listID)
+	}
+	return version, err
+}
+
+func sqlBumpVersion(tx *sql.Tx, userID string, listID string) error {
+	_, err := tx.Exec(`UPDATE lists SET version = version + 1 WHERE user_id = ? AND id = ?`, userID, listID)
+	return err
+}
+
+// sqlTodoColumns are the todos columns that make up a Todo, in the order
+// sqlTodoValues and scanSQLTodo use.
+const sqlTodoColumns = `id, parent_id, title, notes, completed, priority, position, start, due, recurrence, time_zone, assignee_id, created_at, updated_at, completed_at, deleted_at`
+
+func sqlTodoValues(todo Todo) []any {
+	return []any{todo.ID, todo.ParentID, todo.Title, todo.Notes, todo.Completed, todo.Priority, todo.Position, sqlTime(todo.Start), sqlTime(todo.Due), todo.Recurrence,
+		todo.TimeZone, todo.AssigneeID, sqlTime(&todo.CreatedAt), sqlTime(&todo.UpdatedAt), sqlTime(todo.CompletedAt), sqlTime(todo.DeletedAt)}
+}
+
+// scanSQLTodo scans a row of the list ID followed by sqlTodoColumns.
+func scanSQLTodo(rows *sql.Rows) (string, Todo, error) {
+	var listID string
+	var todo Todo
+	var start, due, createdAt, updatedAt, completedAt, deletedAt sql.NullString
+
+	if err := rows.Scan(&listID, &todo.ID, &todo.ParentID, &todo.Title, &todo.Notes, &todo.Completed, &todo.Priority, &todo.Position, &start, &due, &todo.Recurrence,
+		&todo.TimeZone, &todo.AssigneeID, &createdAt, &updatedAt, &completedAt, &deletedAt); err != nil {
+		return "", Todo{}, err
+	}
+
+	var err error
+	if todo.Start, err = parseSQLTime(start); err != nil {
+		return "", Todo{}, err
+	}
+	if todo.Due, err = parseSQLTime(due); err != nil {
+		return "", Todo{}, err
+	}
+	if todo.CompletedAt, err = parseSQLTime(completedAt); err != nil {
+		return "", Todo{}, err
+	}
+	if todo.DeletedAt, err = parseSQLTime(deletedAt); err != nil {
+		return "", Todo{}, err
+	}
+	if todo.CreatedAt, err = parseSQLStamp(createdAt); err != nil {
+		return "", Todo{}, err
+	}
+	if todo.UpdatedAt, err = parseSQLStamp(updatedAt); err != nil {
+		return "", Todo{}, err
+	}
+
+	return listID, todo, nil
+}
+
+func sqlInsertTodo(tx *sql.Tx, userID string, listID string, todo Todo) error {
+	_, err := tx.Exec(`INSERT INTO todos (user_id, list_id, `+sqlTodoColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		append([]any{userID, listID}, sqlTodoValues(todo)...)...)
+	if err != nil {
+		return err
+	}
+
+	return sqlInsertTags(tx, userID, listID, todo)
+}
+
+// sqlInsertTags stores the todo's tags, a repeated tag is only kept once.
+func sqlInsertTags(tx *sql.Tx, userID string, listID string, todo Todo) error {
+	for i, tag := range todo.Tags {
+		_, err := tx.Exec(`INSERT OR IGNORE INTO todo_tags (user_id, list_id, todo_id, tag, position) VALUES (?, ?, ?, ?, ?)`,
+			userID, listID, todo.ID, tag, i)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type sqlTodoKey struct {
+	listID string
+	todoID string
+}
+
+// sqlTags loads the tags of every todo of the user, or only of those in
+// listID when it isn't empty.
+func sqlTags(tx *sql.Tx, userID string, listID string) (map[sqlTodoKey][]string, error) {
+	query := `SELECT list_id, todo_id, tag FROM todo_tags WHERE user_id = ?`
+	args := []any{userID}
+	if listID != "" {
+		query += ` AND list_id = ?`
+		args = append(args, listID)
+	}
+	query += ` ORDER BY position`
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make(map[sqlTodoKey][]string)
+	for rows.Next() {
+		var key sqlTodoKey
+		var tag string
+		if err = rows.Scan(&key.listID, &key.todoID, &tag); err != nil {
+			return nil, err
+		}
+		tags[key] = append(tags[key], tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// sqlInsertHistory appends entries to the history of userID's todos.
+func sqlInsertHistory(tx *sql.Tx, userID string, entries ...HistoryEntry) error {
+	for _, entry := range entries {
+		_, err := tx.Exec(`INSERT INTO todo_history (user_id, list_id, todo_id, changed_by, at, action, fields) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			userID, entry.ListID, entry.TodoID, entry.UserID, sqlTime(&entry.At), entry.Action, strings.Join(entry.Fields, ","))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sqlDeleteHistory(tx *sql.Tx, userID string, listID string, todoID string) error {
+	_, err := tx.Exec(`DELETE FROM todo_history WHERE user_id = ? AND list_id = ? AND todo_id = ?`, userID, listID, todoID)
+	return err
+}
+
+// sqlDeleteTodo removes a todo and its tags for good, leaving any below it.
+func sqlDeleteTodo(tx *sql.Tx, userID string, listID string, todoID string) error {
+	_, err := tx.Exec(`DELETE FROM todo_tags WHERE user_id = ? AND list_id = ? AND todo_id = ?`, userID, listID, todoID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM todos WHERE user_id = ? AND list_id = ? AND id = ?`, userID, listID, todoID)
+	return err
+}
+
+func sqlInsertTodos(tx *sql.Tx, userID string, listID string, todos map[string]*Todo) error {
+	for _, todo := range todos {
+		if err := sqlInsertTodo(tx, userID, listID, *todo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Times are stored as RFC 3339 text so they keep their offset and sort
+// sensibly, NULL when unset.
+func sqlTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func parseSQLTime(value sql.NullString) (*time.Time, error) {
+	if !value.Valid {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, value.String)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// parseSQLStamp is parseSQLTime for a timestamp the store maintains, zero
+// for todos stored before it was kept.
+func parseSQLStamp(value sql.NullString) (time.Time, error) {
+	t, err := parseSQLTime(value)
+	if err != nil || t == nil {
+		return time.Time{}, err
+	}
+	return *t, nil
+}
+
+// sqlTodoLists loads the user's lists that aren't in the trash, or only
+// listID when it isn't empty.
+func sqlTodoLists(tx *sql.Tx, userID string, listID string) (map[string]*TodoList, error) {
+	return sqlLoadLists(tx, userID, listID, false)
+}
+
+// sqlLoadLists loads either the user's lists in the trash or those that
+// aren't, each with the todos that aren't.
+func sqlLoadLists(tx *sql.Tx, userID string, listID string, trashed bool) (map[string]*TodoList, error) {
+	query := `SELECT id, name, version, position, complete_subtasks, deleted_at FROM lists WHERE user_id = ?`
+	if trashed {
+		query += ` AND deleted_at IS NOT NULL`
+	} else {
+		query += ` AND deleted_at IS NULL`
+	}
+	args := []any{userID}
+	if listID != "" {
+		query += ` AND id = ?`
+		args = append(args, listID)
+	}
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	lists := make(map[string]*TodoList)
+	for rows.Next() {
+		list := NewTodoList("", "")
+		var deletedAt sql.NullString
+		if err = rows.Scan(&list.ID, &list.Name, &list.Version, &list.Position, &list.CompleteSubtasks, &deletedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if list.DeletedAt, err = parseSQLTime(deletedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		lists[list.ID] = &list
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `SELECT list_id, ` + sqlTodoColumns + ` FROM todos WHERE user_id = ? AND deleted_at IS NULL`
+	if listID != "" {
+		query += ` AND list_id = ?`
+	}
+
+	rows, err = tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		todoListID, todo, err := scanSQLTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		if list, exists := lists[todoListID]; exists {
+			list.Todos[todo.ID] = &todo
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tags, err := sqlTags(tx, userID, listID)
+	if err != nil {
+		return nil, err
+	}
+	for key, todoTags := range tags {
+		if list, exists := lists[key.listID]; exists && list.Todos[key.todoID] != nil {
+			list.Todos[key.todoID].Tags = todoTags
+		}
+	}
+
+	if err = sqlMembers(tx, userID, listID, lists); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+// sqlMembers fills in the members of the user's lists, or only of listID
+// when it isn't empty.
+func sqlMembers(tx *sql.Tx, userID string, listID string, lists map[string]*TodoList) error {
+	query := `SELECT list_id, member_id, role FROM list_members WHERE user_id = ?`
+	args := []any{userID}
+	if listID != "" {
+		query += ` AND list_id = ?`
+		args = append(args, listID)
+	}
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var memberListID, memberID string
+		var role Role
+		if err = rows.Scan(&memberListID, &memberID, &role); err != nil {
+			return err
+		}
+		if list, exists := lists[memberListID]; exists {
+			shareList(list, memberID, role)
+		}
+	}
+	return rows.Err()
+}
+
+// sqlTrash loads the user's trash.
+func sqlTrash(tx *sql.Tx, userID string) (*Trash, error) {
+	var trash Trash
+
+	lists, err := sqlLoadLists(tx, userID, "", true)
+	if err != nil {
+		return nil, err
+	}
+	for _, list := range lists {
+		trash.Lists = append(trash.Lists, *list)
+	}
+
+	rows, err := tx.Query(`SELECT list_id, `+sqlTodoColumns+` FROM todos WHERE user_id = ? AND deleted_at IS NOT NULL`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		listID, todo, err := scanSQLTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		trash.Todos = append(trash.Todos, TrashedTodo{ListID: listID, Todo: todo})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tags, err := sqlTags(tx, userID, "")
+	if err != nil {
+		return nil, err
+	}
+	for i := range trash.Todos {
+		trash.Todos[i].Tags = tags[sqlTodoKey{trash.Todos[i].ListID, trash.Todos[i].ID}]
+	}
+
+	return &trash, nil
+}
+
+// sqlPurge removes what the user deleted at or before before for good, along
+// with its history.
+func sqlPurge(tx *sql.Tx, userID string, before time.Time) error {
+	trash, err := sqlTrash(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	purged := trash.purge(before)
+	for _, todo := range purged.Todos {
+		if err = sqlDeleteHistory(tx, userID, todo.ListID, todo.ID); err != nil {
+			return err
+		}
+		if err = sqlDeleteTodo(tx, userID, todo.ListID, todo.ID); err != nil {
+			return err
+		}
+	}
+	for _, list := range purged.Lists {
+		if _, err = tx.Exec(`DELETE FROM todo_history WHERE user_id = ? AND list_id = ?`, userID, list.ID); err != nil {
+			return err
+		}
+		if _, err = tx.Exec(`DELETE FROM todo_tags WHERE user_id = ? AND list_id = ?`, userID, list.ID); err != nil {
+			return err
+		}
+		if _, err = tx.Exec(`DELETE FROM todos WHERE user_id = ? AND list_id = ?`, userID, list.ID); err != nil {
+			return err
+		}
+		if _, err = tx.Exec(`DELETE FROM list_members WHERE user_id = ? AND list_id = ?`, userID, list.ID); err != nil {
+			return err
+		}
+		if _, err = tx.Exec(`DELETE FROM lists WHERE user_id = ? AND id = ?`, userID, list.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expire purges what has been in the user's trash for longer than the
+// retention.
+func (s *SQLStore) expire(tx *sql.Tx, userID string) error {
+	if s.retention <= 0 {
+		return nil
+	}
+	return sqlPurge(tx, userID, s.now().Add(-s.retention))
+}
+
+func (s *SQLStore) CreateUser(username string) (id string, e error) {
+	var userID string
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		if err := sqlCheckName(tx, "", username); err != nil {
+			return err
+		}
+
+		userID = s.ids.NewID()
+		_, err := tx.Exec(`INSERT INTO users (id, name) VALUES (?, ?)`, userID, username)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return userID, nil
+}
+
+func (s *SQLStore) GetUser(userID string) (User, error) {
+	var user User
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		err := tx.QueryRow(`SELECT id, name, password_hash FROM users WHERE id = ?`, userID).Scan(&user.ID, &user.Name, &user.PasswordHash)
+		if errors.Is(err, sql.ErrNoRows) {
+			return userNotFound(userID)
+		}
+		if err != nil {
+			return err
+		}
+
+		if user.TodoLists, err = sqlTodoLists(tx, userID, ""); err != nil {
+			return err
+		}
+		user.APIKeys, err = sqlAPIKeys(tx, `WHERE user_id = ?`, userID)
+		return err
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+func (s *SQLStore) GetUsers() ([]User, error) {
+	users := []User{}
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT id, name FROM users ORDER BY id`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var user User
+			if err = rows.Scan(&user.ID, &user.Name); err != nil {
+				return err
+			}
+			users = append(users, user)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (s *SQLStore) RenameUser(userID string, name string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if err := sqlUserExists(tx, userID); err != nil {
+			return err
+		}
+		if err := sqlCheckName(tx, userID, name); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(`UPDATE users SET name = ? WHERE id = ?`, name, userID)
+		return err
+	})
+}
+
+// sqlCheckName is checkName over the users table. Names are compared in Go
+// as SQLite only folds the case of ASCII letters.
+func sqlCheckName(tx *sql.Tx, userID string, name string) error {
+	rows, err := tx.Query(`SELECT id, name FROM users`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	users := make(map[string]*User)
+	for rows.Next() {
+		var user User
+		if err = rows.Scan(&user.ID, &user.Name); err != nil {
+			return err
+		}
+		users[user.ID] = &user
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	return checkName(users, userID, name)
+}
+
+func (s *SQLStore) SetPassword(userID string, password string) error {
+	hash, err := hashPassword(userID, password)
+	if err != nil {
+		return err
+	}
+
+	return s.inTx(func(tx *sql.Tx) error {
+		if err := sqlUserExists(tx, userID); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(`UPDATE users SET password_hash = ? WHERE id = ?`, hash, userID)
+		return err
+	})
+}
+
+func (s *SQLStore) CheckPassword(userID string, password string) error {
+	var user User
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		err := tx.QueryRow(`SELECT id, password_hash FROM users WHERE id = ?`, userID).Scan(&user.ID, &user.PasswordHash)
+		if errors.Is(err, sql.ErrNoRows) {
+			return userNotFound(userID)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return checkPassword(user, password)
+}
+
+func (s *SQLStore) CreateAPIKey(userID string, key APIKey) (APIKey, string, error) {
+	var secret string
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		if err := sqlUserExists(tx, userID); err != nil {
+			return err
+		}
+
+		var err error
+		if key, secret, err = newAPIKey(key, userID, s.ids.NewID(), s.now()); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO api_keys (user_id, id, name, scope, created_at, expires_at, hash) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			userID, key.ID, key.Name, key.Scope, sqlTime(&key.CreatedAt), sqlTime(key.ExpiresAt), key.Hash)
+		return err
+	})
+	if err != nil {
+		return APIKey{}, "", err
+	}
+
+	key.Hash = nil
+	return key, secret, nil
+}
+
+func (s *SQLStore) GetAPIKeys(userID string) ([]APIKey, error) {
+	var user User
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		if err := sqlUserExists(tx, userID); err != nil {
+			return err
+		}
+
+		var err error
+		user.APIKeys, err = sqlAPIKeys(tx, `WHERE user_id = ?`, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return listAPIKeys(user), nil
+}
+
+func (s *SQLStore) RevokeAPIKey(userID string, keyID string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if err := sqlUserExists(tx, userID); err != nil {
+			return err
+		}
+
+		result, err := tx.Exec(`DELETE FROM api_keys WHERE user_id = ? AND id = ?`, userID, keyID)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return apiKeyNotFound(userID, keyID)
+		}
+		return nil
+	})
+}
+
+// CheckAPIKey looks the key up by the hash of secret, which is unique.
+func (s *SQLStore) CheckAPIKey(secret string) (APIKey, error) {
+	if !strings.HasPrefix(secret, APIKeyPrefix) {
+		return APIKey{}, errorf(ErrUnauthorized, "not an API key")
+	}
+
+	var keys map[string]*APIKey
+	err := s.inTx(func(tx *sql.Tx) error {
+		var err error
+		keys, err = sqlAPIKeys(tx, `WHERE hash = ?`, hashAPIKey(secret))
+		return err
+	})
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	for _, key := range keys {
+		return checkAPIKey(*key, s.now())
+	}
+	return APIKey{}, errorf(ErrUnauthorized, "unknown API key")
+}
+
+func (s *SQLStore) ShareTodoList(userID string, listID string, memberID string, role Role) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if _, err := sqlListVersion(tx, userID, listID); err != nil {
+			return err
+		}
+		if err := checkShare(userID, listID, memberID, role); err != nil {
+			return err
+		}
+		if err := sqlUserExists(tx, memberID); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(`INSERT INTO list_members (user_id, list_id, member_id, role) VALUES (?, ?, ?, ?)
+			ON CONFLICT (user_id, list_id, member_id) DO UPDATE SET role = excluded.role`,
+			userID, listID, memberID, role)
+		return err
+	})
+}
+
+func (s *SQLStore) UnshareTodoList(userID string, listID string, memberID string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if _, err := sqlListVersion(tx, userID, listID); err != nil {
+			return err
+		}
+
+		result, err := tx.Exec(`DELETE FROM list_members WHERE user_id = ? AND list_id = ? AND member_id = ?`, userID, listID, memberID)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return memberNotFound(userID, listID, memberID)
+		}
+
+		if err = sqlUnassign(tx, userID, listID, memberID, s.now()); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE todos SET assignee_id = '' WHERE user_id = ? AND list_id = ? AND assignee_id = ?`, userID, listID, memberID)
+		return err
+	})
+}
+
+// sqlUnassign takes memberID off the todos they were assigned on listID of
+// userID, or on every list of userID when listID is empty, recording the
+// changes as the other stores do, see unassign. Todos in the trash are left
+// to the caller.
+func sqlUnassign(tx *sql.Tx, userID string, listID string, memberID string, now time.Time) error {
+	for _, trashed := range []bool{false, true} {
+		lists, err := sqlLoadLists(tx, userID, listID, trashed)
+		if err != nil {
+			return err
+		}
+
+		for _, list := range lists {
+			entries := unassign(list, memberID, userID, now)
+			if len(entries) == 0 {
+				continue
+			}
+			for _, entry := range entries {
+				if _, err = tx.Exec(`UPDATE todos SET assignee_id = '', updated_at = ? WHERE user_id = ? AND list_id = ? AND id = ?`,
+					sqlTime(&list.Todos[entry.TodoID].UpdatedAt), userID, list.ID, entry.TodoID); err != nil {
+					return err
+				}
+			}
+			if err = sqlBumpVersion(tx, userID, list.ID); err != nil {
+				return err
+			}
+			if err = sqlInsertHistory(tx, userID, entries...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) SharedTodoLists(userID string) ([]SharedList, error) {
+	var shared []SharedList
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		if err := sqlUserExists(tx, userID); err != nil {
+			return err
+		}
+
+		var err error
+		shared, err = sqlSharedWith(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return shared, nil
+}
+
+// sqlSharedWith loads the lists shared with memberID that aren't in the
+// trash, sorted as SharedTodoLists returns them.
+func sqlSharedWith(tx *sql.Tx, memberID string) ([]SharedList, error) {
+	rows, err := tx.Query(`SELECT m.user_id, m.list_id, m.role FROM list_members m
+		JOIN lists l ON l.user_id = m.user_id AND l.id = m.list_id
+		WHERE m.member_id = ? AND l.deleted_at IS NULL`, memberID)
+	if err != nil {
+		return nil, err
+	}
+
+	shared := []SharedList{}
+	for rows.Next() {
+		var list SharedList
+		if err = rows.Scan(&list.OwnerID, &list.ID, &list.Role); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		shared = append(shared, list)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, list := range shared {
+		lists, err := sqlTodoLists(tx, list.OwnerID, list.ID)
+		if err != nil {
+			return nil, err
+		}
+		shared[i].TodoList = *lists[list.ID]
+	}
+
+	sortShared(shared)
+	return shared, nil
+}
+
+// sqlAPIKeys loads the keys matched by where, keyed by ID.
+func sqlAPIKeys(tx *sql.Tx, where string, args ...any) (map[string]*APIKey, error) {
+	rows, err := tx.Query(`SELECT user_id, id, name, scope, created_at, expires_at, hash FROM api_keys `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys map[string]*APIKey
+	for rows.Next() {
+		var key APIKey
+		var createdAt, expiresAt sql.NullString
+		if err = rows.Scan(&key.UserID, &key.ID, &key.Name, &key.Scope, &createdAt, &expiresAt, &key.Hash); err != nil {
+			return nil, err
+		}
+		if key.CreatedAt, err = parseSQLStamp(createdAt); err != nil {
+			return nil, err
+		}
+		if key.ExpiresAt, err = parseSQLTime(expiresAt); err != nil {
+			return nil, err
+		}
+
+		if keys == nil {
+			keys = make(map[string]*APIKey)
+		}
+		keys[key.ID] = &key
+	}
+	return keys, rows.Err()
+}
+
+// DeleteUser deletes the user's rows table by table rather than relying on
+// ON DELETE CASCADE, which SQLite only honours with foreign keys turned on.
+func (s *SQLStore) DeleteUser(userID string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if err := sqlUserExists(tx, userID); err != nil {
+			return err
+		}
+
+		for _, table := range []string{"todo_history", "todo_tags", "todos", "list_members", "lists", "api_keys"} {
+			if _, err := tx.Exec(`DELETE FROM `+table+` WHERE user_id = ?`, userID); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(`DELETE FROM list_members WHERE member_id = ?`, userID); err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(`SELECT DISTINCT user_id FROM todos WHERE assignee_id = ? AND deleted_at IS NULL`, userID)
+		if err != nil {
+			return err
+		}
+		var owners []string
+		for rows.Next() {
+			var ownerID string
+			if err = rows.Scan(&ownerID); err != nil {
+				rows.Close()
+				return err
+			}
+			owners = append(owners, ownerID)
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		now := s.now()
+		for _, ownerID := range owners {
+			if err = sqlUnassign(tx, ownerID, "", userID, now); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(`UPDATE todos SET assignee_id = '' WHERE assignee_id = ?`, userID); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`DELETE FROM users WHERE id = ?`, userID)
+		return err
+	})
+}
+
+func (s *SQLStore) GetTodoLists(userID string) (map[string]*TodoList, error) {
+	var lists map[string]*TodoList
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		if err := sqlUserExists(tx, userID); err != nil {
+			return err
+		}
+
+		var err error
+		lists, err = sqlTodoLists(tx, userID, "")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+func (s *SQLStore) GetTodoList(userID string, listID string) (TodoList, error) {
+	var list TodoList
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		if _, err := sqlListVersion(tx, userID, listID); err != nil {
+			return err
+		}
+
+		lists, err := sqlTodoLists(tx, userID, listID)
+		if err != nil {
+			return err
+		}
+
+		list = *lists[listID]
+		return nil
+	})
+	if err != nil {
+		return TodoList{}, err
+	}
+
+	return list, nil
+}
+
+func (s *SQLStore) CreateTodoList(list TodoList, userID string) (id string, e error) {
+	listID := s.ids.NewID()
+	list = cloneTodoList(list)
+	newTodoIDs(&list, nil, s.ids)
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		if err := sqlUserExists(tx, userID); err != nil {
+			return err
+		}
+
+		list.ID = listID
+		if err := checkTree(list, userID); err != nil {
+			return err
+		}
+		if err := checkAssignees(list, nil, userID); err != nil {
+			return err
+		}
+
+		var entries []HistoryEntry
+		now := s.now()
+		for _, todo := range SortTodos(list.Todos, ByPosition) {
+			entries = append(entries, created(todo, listID, userID, now))
+		}
+
+		_, err := tx.Exec(`INSERT INTO lists (user_id, id, name, version, position, complete_subtasks)
+			SELECT ?, ?, ?, 1, COALESCE(MAX(position) + 1, 0), ? FROM lists WHERE user_id = ?`,
+			userID, listID, list.Name, list.CompleteSubtasks, userID)
+		if err != nil {
+			return err
+		}
+
+		if err = sqlInsertTodos(tx, userID, listID, list.Todos); err != nil {
+			return err
+		}
+		return sqlInsertHistory(tx, userID, entries...)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return listID, nil
+}
+
+func (s *SQLStore) UpdateTodoList(list TodoList, userID string, actorID string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		version, err := sqlListVersion(tx, userID, list.ID)
+		if err != nil {
+			return err
+		}
+
+		if err = checkVersion(list, &TodoList{ID: list.ID, Version: version}, userID); err != nil {
+			return err
+		}
+
+		lists, err := sqlTodoLists(tx, userID, list.ID)
+		if err != nil {
+			return err
+		}
+		stored := lists[list.ID]
+		list := cloneTodoList(list)
+		newTodoIDs(&list, stored, s.ids)
+		if err = checkTree(list, userID); err != nil {
+			return err
+		}
+		if err = checkAssignees(list, stored.Members, userID); err != nil {
+			return err
+		}
+		entries := updatedList(stored, &list, actorID, s.now())
+		for id := range stored.Todos {
+			if _, exists := list.Todos[id]; exists {
+				continue
+			}
+			if err = sqlDeleteHistory(tx, userID, list.ID, id); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec(`UPDATE lists SET name = ?, version = ?, complete_subtasks = ? WHERE user_id = ? AND id = ?`,
+			list.Name, version+1, list.CompleteSubtasks, userID, list.ID)
+		if err != nil {
+			return err
+		}
+
+		// A todo in the trash that the list holds again is replaced by it.
+		for _, todos := range []map[string]*Todo{stored.Todos, list.Todos} {
+			for id := range todos {
+				if err = sqlDeleteTodo(tx, userID, list.ID, id); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err = sqlInsertTodos(tx, userID, list.ID, list.Todos); err != nil {
+			return err
+		}
+		return sqlInsertHistory(tx, userID, entries...)
+	})
+}
+
+func (s *SQLStore) DeleteTodoList(userID string, listID string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if _, err := sqlListVersion(tx, userID, listID); err != nil {
+			return err
+		}
+		if err := s.expire(tx, userID); err != nil {
+			return err
+		}
+
+		now := s.now()
+		_, err := tx.Exec(`UPDATE lists SET deleted_at = ? WHERE user_id = ? AND id = ?`, sqlTime(&now), userID, listID)
+		return err
+	})
+}
+
+func (s *SQLStore) AddTodo(todo Todo, listID string, userID string, actorID string) (id string, e error) {
+	todo.ID = s.ids.NewID()
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		if _, err := sqlListVersion(tx, userID, listID); err != nil {
+			return err
+		}
+		if err := checkRecurrence(todo, listID, userID); err != nil {
+			return err
+		}
+
+		if todo.ParentID != "" || todo.AssigneeID != "" {
+			lists, err := sqlTodoLists(tx, userID, listID)
+			if err != nil {
+				return err
+			}
+			if err = checkParent(lists[listID], todo, userID); err != nil {
+				return err
+			}
+			if err = checkAssignee(lists[listID], todo, userID); err != nil {
+				return err
+			}
+		}
+
+		err := tx.QueryRow(`SELECT COALESCE(MAX(position) + 1, 0) FROM todos
+			WHERE user_id = ? AND list_id = ? AND parent_id = ? AND deleted_at IS NULL`,
+			userID, listID, todo.ParentID).Scan(&todo.Position)
+		if err != nil {
+			return err
+		}
+
+		entry := created(&todo, listID, actorID, s.now())
+		if err = sqlInsertTodo(tx, userID, listID, todo); err != nil {
+			return err
+		}
+		if err = sqlInsertHistory(tx, userID, entry); err != nil {
+			return err
+		}
+
+		return sqlBumpVersion(tx, userID, listID)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return todo.ID, nil
+}
+
+func (s *SQLStore) UpdateTodo(todo Todo, listID string, userID string, actorID string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if _, err := sqlListVersion(tx, userID, listID); err != nil {
+			return err
+		}
+
+		lists, err := sqlTodoLists(tx, userID, listID)
+		if err != nil {
+			return err
+		}
+		stored, exists := lists[listID].Todos[todo.ID]
+		if !exists {
+			return TodoNotFound(userID, listID, todo.ID)
+		}
+
+		if err = checkRecurrence(todo, listID, userID); err != nil {
+			return err
+		}
+		if err = checkAssignee(lists[listID], todo, userID); err != nil {
+			return err
+		}
+
+		todo.ParentID = stored.ParentID
+		entry, changed := updated(*stored, &todo, listID, actorID, s.now())
+		if !changed {
+			return sqlBumpVersion(tx, userID, listID)
+		}
+
+		_, err = tx.Exec(`UPDATE todos SET title = ?, notes = ?, completed = ?, priority = ?, start = ?, due = ?, recurrence = ?,
+			time_zone = ?, assignee_id = ?, updated_at = ?, completed_at = ?
+			WHERE user_id = ? AND list_id = ? AND id = ?`,
+			todo.Title, todo.Notes, todo.Completed, todo.Priority, sqlTime(todo.Start), sqlTime(todo.Due), todo.Recurrence,
+			todo.TimeZone, todo.AssigneeID, sqlTime(&todo.UpdatedAt), sqlTime(todo.CompletedAt), userID, listID, todo.ID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`DELETE FROM todo_tags WHERE user_id = ? AND list_id = ? AND todo_id = ?`, userID, listID, todo.ID)
+		if err != nil {
+			return err
+		}
+		if err = sqlInsertTags(tx, userID, listID, todo); err != nil {
+			return err
+		}
+		if err = sqlInsertHistory(tx, userID, entry); err != nil {
+			return err
+		}
+
+		return sqlBumpVersion(tx, userID, listID)
+	})
+}
+
+func (s *SQLStore) DeleteTodo(userID string, listID string, todoID string, actorID string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if _, err := sqlListVersion(tx, userID, listID); err != nil {
+			return err
+		}
+
+		lists, err := sqlTodoLists(tx, userID, listID)
+		if err != nil {
+			return err
+		}
+
+		if err = s.expire(tx, userID); err != nil {
+			return err
+		}
+
+		var trash Trash
+		entries := trashTodo(&trash, lists[listID], todoID, actorID, s.now())
+		if entries == nil {
+			return TodoNotFound(userID, listID, todoID)
+		}
+
+		for _, todo := range trash.Todos {
+			_, err = tx.Exec(`UPDATE todos SET deleted_at = ?, updated_at = ? WHERE user_id = ? AND list_id = ? AND id = ?`,
+				sqlTime(todo.DeletedAt), sqlTime(&todo.UpdatedAt), userID, listID, todo.ID)
+			if err != nil {
+				return err
+			}
+		}
+		if err = sqlInsertHistory(tx, userID, entries...); err != nil {
+			return err
+		}
+
+		return sqlBumpVersion(tx, userID, listID)
+	})
+}
+
+func (s *SQLStore) ToggleTodo(userID string, listID string, todoID string, actorID string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if _, err := sqlListVersion(tx, userID, listID); err != nil {
+			return err
+		}
+
+		lists, err := sqlTodoLists(tx, userID, listID)
+		if err != nil {
+			return err
+		}
+
+		list := lists[listID]
+		entries := toggleTodo(list, todoID, actorID, s.now())
+		if entries == nil {
+			return TodoNotFound(userID, listID, todoID)
+		}
+
+		for _, entry := range entries {
+			todo := list.Todos[entry.TodoID]
+			_, err = tx.Exec(`UPDATE todos SET completed = ?, start = ?, due = ?, recurrence = ?, updated_at = ?, completed_at = ?
+				WHERE user_id = ? AND list_id = ? AND id = ?`,
+				todo.Completed, sqlTime(todo.Start), sqlTime(todo.Due), todo.Recurrence, sqlTime(&todo.UpdatedAt), sqlTime(todo.CompletedAt),
+				userID, listID, todo.ID)
+			if err != nil {
+				return err
+			}
+		}
+		if err = sqlInsertHistory(tx, userID, entries...); err != nil {
+			return err
+		}
+
+		return sqlBumpVersion(tx, userID, listID)
+	})
+}
+
+func (s *SQLStore) MoveTodoList(userID string, listID string, by int) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if err := sqlUserExists(tx, userID); err != nil {
+			return err
+		}
+
+		lists, err := sqlTodoLists(tx, userID, "")
+		if err != nil {
+			return err
+		}
+
+		if !moveList(lists, listID, by) {
+			return listNotFound(userID, listID)
+		}
+
+		for _, list := range lists {
+			_, err = tx.Exec(`UPDATE lists SET position = ? WHERE user_id = ? AND id = ?`, list.Position, userID, list.ID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLStore) MoveTodo(userID string, listID string, todoID string, by int, actorID string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if _, err := sqlListVersion(tx, userID, listID); err != nil {
+			return err
+		}
+
+		lists, err := sqlTodoLists(tx, userID, listID)
+		if err != nil {
+			return err
+		}
+
+		list := lists[listID]
+		if !moveTodo(list, todoID, by) {
+			return TodoNotFound(userID, listID, todoID)
+		}
+		entry := moved(list.Todos[todoID], listID, actorID, s.now())
+
+		for _, todo := range list.Todos {
+			_, err = tx.Exec(`UPDATE todos SET position = ?, updated_at = ? WHERE user_id = ? AND list_id = ? AND id = ?`,
+				todo.Position, sqlTime(&todo.UpdatedAt), userID, listID, todo.ID)
+			if err != nil {
+				return err
+			}
+		}
+		if err = sqlInsertHistory(tx, userID, entry); err != nil {
+			return err
+		}
+
+		return sqlBumpVersion(tx, userID, listID)
+	})
+}
+
+// IncompleteTodos returns every incomplete todo of the user keyed by the ID of
+// the list it belongs to, without loading the lists themselves.
+func (s *SQLStore) IncompleteTodos(userID string) (map[string][]Todo, error) {
+	todos := make(map[string][]Todo)
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		if err := sqlUserExists(tx, userID); err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(`SELECT list_id, `+sqlTodoColumns+` FROM todos
+			WHERE user_id = ? AND completed = FALSE AND deleted_at IS NULL
+			AND list_id IN (SELECT id FROM lists WHERE user_id = ? AND deleted_at IS NULL)
+			ORDER BY list_id, id`, userID, userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			listID, todo, err := scanSQLTodo(rows)
+			if err != nil {
+				return err
+			}
+			todos[listID] = append(todos[listID], todo)
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		tags, err := sqlTags(tx, userID, "")
+		if err != nil {
+			return err
+		}
+		for listID, listTodos := range todos {
+			for i := range listTodos {
+				listTodos[i].Tags = tags[sqlTodoKey{listID, listTodos[i].ID}]
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return todos, nil
+}
+
+// FindTodos narrows the lists it loads to those holding a todo with the tag
+// when the query has one.
+func (s *SQLStore) FindTodos(userID string, query TodoQuery) ([]FoundTodo, error) {
+	var found []FoundTodo
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		if err := sqlUserExists(tx, userID); err != nil {
+			return err
+		}
+
+		lists, err := sqlTaggedLists(tx, userID, query.Tag)
+		if err != nil {
+			return err
+		}
+		found = findTodos(lists, userID, query)
+		if query.AssigneeID == "" {
+			return nil
+		}
+
+		shared, err := sqlSharedWith(tx, userID)
+		if err != nil {
+			return err
+		}
+		found = findSharedTodos(found, shared, query)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return found, nil
+}
+
+// sqlTaggedLists loads the user's lists holding a todo with tag, all of them
+// when tag is empty.
+func sqlTaggedLists(tx *sql.Tx, userID string, tag string) (map[string]*TodoList, error) {
+	if tag == "" {
+		return sqlTodoLists(tx, userID, "")
+	}
+
+	rows, err := tx.Query(`SELECT DISTINCT list_id FROM todo_tags WHERE user_id = ? AND tag = ?`,
+		userID, NormalizeTag(tag))
+	if err != nil {
+		return nil, err
+	}
+
+	var listIDs []string
+	for rows.Next() {
+		var listID string
+		if err = rows.Scan(&listID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		listIDs = append(listIDs, listID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	lists := make(map[string]*TodoList)
+	for _, listID := range listIDs {
+		listLists, err := sqlTodoLists(tx, userID, listID)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(lists, listLists)
+	}
+	return lists, nil
+}
+
+func (s *SQLStore) TodoHistory(userID string, listID string, todoID string) ([]HistoryEntry, error) {
+	entries := []HistoryEntry{}
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		if _, err := sqlListVersion(tx, userID, listID); err != nil {
+			return err
+		}
+
+		var exists bool
+		err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM todos WHERE user_id = ? AND list_id = ? AND id = ? AND deleted_at IS NULL)`,
+			userID, listID, todoID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return TodoNotFound(userID, listID, todoID)
+		}
+
+		rows, err := tx.Query(`SELECT changed_by, at, action, fields FROM todo_history
+			WHERE user_id = ? AND list_id = ? AND todo_id = ? ORDER BY seq`, userID, listID, todoID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			entry := HistoryEntry{ListID: listID, TodoID: todoID}
+			var at sql.NullString
+			var fields string
+			if err = rows.Scan(&entry.UserID, &at, &entry.Action, &fields); err != nil {
+				return err
+			}
+			if entry.At, err = parseSQLStamp(at); err != nil {
+				return err
+			}
+			if fields != "" {
+				entry.Fields = strings.Split(fields, ",")
+			}
+			entries = append(entries, entry)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (s *SQLStore) Trash(userID string) (Trash, error) {
+	var trash *Trash
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		if err := sqlUserExists(tx, userID); err != nil {
+			return err
+		}
+		if err := s.expire(tx, userID); err != nil {
+			return err
+		}
+
+		var err error
+		trash, err = sqlTrash(tx, userID)
+		return err
+	})
+	if err != nil {
+		return Trash{}, err
+	}
+
+	sortTrash(trash)
+	return *trash, nil
+}
+
+func (s *SQLStore) RestoreTodoList(userID string, listID string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if err := sqlUserExists(tx, userID); err != nil {
+			return err
+		}
+		if err := s.expire(tx, userID); err != nil {
+			return err
+		}
+
+		trash, err := sqlTrash(tx, userID)
+		if err != nil {
+			return err
+		}
+		lists, err := sqlTodoLists(tx, userID, "")
+		if err != nil {
+			return err
+		}
+
+		if !restoreList(trash, lists, listID) {
+			return listNotFound(userID, listID)
+		}
+
+		_, err = tx.Exec(`UPDATE lists SET deleted_at = NULL, position = ? WHERE user_id = ? AND id = ?`,
+			lists[listID].Position, userID, listID)
+		return err
+	})
+}
+
+func (s *SQLStore) RestoreTodo(userID string, listID string, todoID string, actorID string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if _, err := sqlListVersion(tx, userID, listID); err != nil {
+			return err
+		}
+		if err := s.expire(tx, userID); err != nil {
+			return err
+		}
+
+		trash, err := sqlTrash(tx, userID)
+		if err != nil {
+			return err
+		}
+		lists, err := sqlTodoLists(tx, userID, listID)
+		if err != nil {
+			return err
+		}
+
+		list := lists[listID]
+		entries := restoreTodo(trash, list, todoID, actorID, s.now())
+		if entries == nil {
+			return TodoNotFound(userID, listID, todoID)
+		}
+
+		for _, entry := range entries {
+			todo := list.Todos[entry.TodoID]
+			_, err = tx.Exec(`UPDATE todos SET deleted_at = NULL, parent_id = ?, position = ?, updated_at = ?
+				WHERE user_id = ? AND list_id = ? AND id = ?`,
+				todo.ParentID, todo.Position, sqlTime(&todo.UpdatedAt), userID, listID, todo.ID)
+			if err != nil {
+				return err
+			}
+		}
+		if err = sqlInsertHistory(tx, userID, entries...); err != nil {
+			return err
+		}
+
+		return sqlBumpVersion(tx, userID, listID)
+	})
+}
+
+func (s *SQLStore) PurgeTrash(userID string, before time.Time) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if err := sqlUserExists(tx, userID); err != nil {
+			return err
+		}
+		return sqlPurge(tx, userID, before)
+	})
+}
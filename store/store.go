@@ -1,32 +1,160 @@
 package store
 
+import "time"
+
+// Store is implemented by every backend. The store assigns the IDs of the
+// users, lists and todos it creates, any ID set by the caller is ignored.
 type Store interface {
+	// CreateUser and RenameUser return ErrConflict when another user goes
+	// by the name already, names are compared ignoring case.
 	CreateUser(username string) (id string, e error)
 	GetUser(id string) (User, error)
+	// GetUsers returns every user in ID order, without their lists or keys.
+	GetUsers() ([]User, error)
+	RenameUser(userID string, name string) error
+	// DeleteUser permanently deletes the user along with their lists, trash
+	// and history, and takes them off the lists shared with them as
+	// UnshareTodoList does.
+	DeleteUser(userID string) error
+	// SetPassword replaces the user's password, only its hash is kept.
+	SetPassword(userID string, password string) error
+	// CheckPassword reports ErrUnauthorized unless password is the user's.
+	CheckPassword(userID string, password string) error
+	// CreateAPIKey gives the user a key, its ID picked by the store, and
+	// returns it along with the secret to authenticate with. The secret
+	// can't be had again later.
+	CreateAPIKey(userID string, key APIKey) (APIKey, string, error)
+	// GetAPIKeys returns the user's keys oldest first, without their hashes.
+	GetAPIKeys(userID string) ([]APIKey, error)
+	// RevokeAPIKey deletes a key for good.
+	RevokeAPIKey(userID string, keyID string) error
+	// CheckAPIKey returns the key secret belongs to, or ErrUnauthorized when
+	// there is none or it has expired.
+	CheckAPIKey(secret string) (APIKey, error)
+	CreateTodoList(list TodoList, userID string) (id string, e error)
 	GetTodoList(userID string, listID string) (TodoList, error)
 	GetTodoLists(userID string) (map[string]*TodoList, error)
-	UpdateTodoList(list TodoList, userID string) error
+	// UpdateTodoList and the methods changing a todo take the user making
+	// the change as actorID, which the todos' history records. That is the
+	// list's owner userID or, for a shared list, one of its members. Todos
+	// the list doesn't hold yet get IDs from the store, as in a new list.
+	UpdateTodoList(list TodoList, userID string, actorID string) error
+	// DeleteTodoList and DeleteTodo move what they delete to the trash, where
+	// it stays until restored or purged.
 	DeleteTodoList(userID string, listID string) error
-	AddTodo(todo Todo, listID string, userID string) error
-	ToggleTodo(userID string, listID string, todoID string) error
+	AddTodo(todo Todo, listID string, userID string, actorID string) (id string, e error)
+	UpdateTodo(todo Todo, listID string, userID string, actorID string) error
+	DeleteTodo(userID string, listID string, todoID string, actorID string) error
+	ToggleTodo(userID string, listID string, todoID string, actorID string) error
+	// MoveTodoList and MoveTodo shift an item by places within its user or
+	// list, towards the start when by is negative and no further than either
+	// end.
+	MoveTodoList(userID string, listID string, by int) error
+	MoveTodo(userID string, listID string, todoID string, by int, actorID string) error
+	// FindTodos searches every list of the user, and the lists shared with
+	// them too when the query has an AssigneeID.
+	FindTodos(userID string, query TodoQuery) ([]FoundTodo, error)
+	// TodoHistory returns every change made to a todo, oldest first.
+	TodoHistory(userID string, listID string, todoID string) ([]HistoryEntry, error)
+	// Trash returns what the user deleted. Anything deleted longer ago than
+	// the store's retention, see WithRetention, is purged first.
+	Trash(userID string) (Trash, error)
+	// RestoreTodoList takes a list out of the trash and puts it last.
+	RestoreTodoList(userID string, listID string) error
+	// RestoreTodo takes a todo and the subtasks deleted with it out of the
+	// trash and back into its list, which must not be in the trash itself.
+	RestoreTodo(userID string, listID string, todoID string, actorID string) error
+	// PurgeTrash permanently deletes whatever went into the trash at or
+	// before before.
+	PurgeTrash(userID string, before time.Time) error
+	// ShareTodoList gives memberID role on the user's list, replacing any
+	// role they had. Sharing doesn't change the list's version.
+	ShareTodoList(userID string, listID string, memberID string, role Role) error
+	// UnshareTodoList takes the list away from memberID. Todos assigned to
+	// them are unassigned, which the owner is recorded as doing, moving the
+	// list to its next version.
+	UnshareTodoList(userID string, listID string, memberID string) error
+	// SharedTodoLists returns the lists other users shared with the user,
+	// leaving out those in the trash.
+	SharedTodoLists(userID string) ([]SharedList, error)
 }
 
 type User struct {
 	ID        string
 	Name      string
 	TodoLists map[string]*TodoList
+	// PasswordHash is the bcrypt hash of the user's password, empty for a
+	// user who can't log in. It is maintained by the store through
+	// SetPassword.
+	PasswordHash []byte `json:",omitempty"`
+	// APIKeys are the user's keys keyed by ID, maintained by the store
+	// through CreateAPIKey and RevokeAPIKey.
+	APIKeys map[string]*APIKey `json:",omitempty"`
 }
 
 type TodoList struct {
-	ID    string
-	Name  string
-	Todos map[string]*Todo
+	ID      string
+	Name    string
+	Todos   map[string]*Todo
+	Version int
+	// Position orders the list among the user's lists. It is maintained by
+	// the store, changed only by MoveTodoList.
+	Position int
+	// CompleteSubtasks makes completing a todo with ToggleTodo complete every
+	// todo below it too.
+	CompleteSubtasks bool
+	// DeletedAt is when the list was moved to the trash, nil for a list that
+	// isn't there. It is maintained by the store.
+	DeletedAt *time.Time `json:",omitempty"`
+	// Members are the users the list is shared with and their roles, keyed
+	// by user ID. It is maintained by the store through ShareTodoList and
+	// UnshareTodoList.
+	Members map[string]Role `json:",omitempty"`
 }
 
 type Todo struct {
-	ID        string
-	Title     string
+	ID string
+	// ParentID is the todo this one is a subtask of, empty at the top level.
+	// It is set by AddTodo and only changed by UpdateTodoList.
+	ParentID string
+	Title    string
+	// Notes is a free form, possibly multi-line, body shown with the todo.
+	// It is usually Markdown.
+	Notes     string
 	Completed bool
+	Priority  Priority
+	// Tags are matched by FindTodos as stored, so callers normalize them
+	// with NormalizeTags first.
+	Tags []string
+	// Position orders the todo among the others with the same parent. It is
+	// maintained by the store, changed only by MoveTodo and UpdateTodoList.
+	Position int
+	// Start and Due are optional, nil when the todo has no such date.
+	Start *time.Time
+	Due   *time.Time
+	// Recurrence is an RRULE the todo repeats by, see ParseRecurrence. A
+	// recurring todo needs a due date, completing it with ToggleTodo moves
+	// it on to the next occurrence instead while the rule lasts.
+	Recurrence string
+	// TimeZone is the IANA name of the location a recurring todo repeats in,
+	// such as "Europe/Berlin". Due is only stored with its offset, so without
+	// one occurrences follow the clock of that offset rather than the local
+	// time across a DST change.
+	TimeZone string
+	// AssigneeID is the user doing the todo, empty when nobody is. It has to
+	// be the list's owner or one of its members, and is cleared when the
+	// list is unshared with them.
+	AssigneeID string
+	// CreatedAt, UpdatedAt and CompletedAt are maintained by the store, any
+	// value set by the caller is ignored. UpdatedAt moves with every change
+	// recorded in the todo's history. CompletedAt is nil while the todo is
+	// incomplete, except that a recurring todo keeps the time its last
+	// occurrence was completed.
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	CompletedAt *time.Time
+	// DeletedAt is when the todo was moved to the trash, like the list one.
+	DeletedAt *time.Time `json:",omitempty"`
 }
 
 func NewUser(id, name string) User {
@@ -48,3 +176,17 @@ func NewTodoList(id, name string) TodoList {
 func (t *Todo) Toggle() {
 	t.Completed = !t.Completed
 }
+
+// checkVersion reports an ErrConflict when list was read at a different
+// version than the one stored. A zero Version skips the check.
+func checkVersion(list TodoList, stored *TodoList, userID string) error {
+	if list.Version == 0 {
+		return nil
+	}
+
+	if list.Version != stored.Version {
+		return errorf(ErrConflict, "list with ID %s for user ID %s is at version %d, not %d", list.ID, userID, stored.Version, list.Version)
+	}
+
+	return nil
+}
@@ -0,0 +1,253 @@
+package store_test
+
+import (
+	"ToDo/api"
+	"ToDo/store"
+	"ToDo/store/storetest"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestInMemoryStore(t *testing.T) {
+	storetest.Run(t, func(opts ...store.Option) store.Store {
+		return store.NewInMemoryStore(opts...)
+	})
+}
+
+func TestJsonStore(t *testing.T) {
+	storetest.Run(t, func(opts ...store.Option) store.Store {
+		s, err := store.NewJsonStore(t.TempDir()+"/", opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+func TestEventLogStore(t *testing.T) {
+	storetest.Run(t, func(opts ...store.Option) store.Store {
+		s, err := store.NewEventLogStore(t.TempDir(), 4, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func newSQLStore(t *testing.T, opts ...store.Option) *store.SQLStore {
+	dsn := "file:" + filepath.Join(t.TempDir(), "todo.db") + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	s, err := store.NewSQLStore(db, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSQLStore(t *testing.T) {
+	storetest.Run(t, func(opts ...store.Option) store.Store {
+		return newSQLStore(t, opts...)
+	})
+}
+
+func TestSQLStoreIncompleteTodos(t *testing.T) {
+	s := newSQLStore(t)
+
+	userID, err := s.CreateUser("Steve")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"groceries", "chores"} {
+		list := store.NewTodoList("", name)
+		list.Todos["done"] = &store.Todo{ID: "done", Title: "done", Completed: true}
+		list.Todos["to do"] = &store.Todo{ID: "to do", Title: "to do"}
+		if _, err = s.CreateTodoList(list, userID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	todos, err := s.IncompleteTodos(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(todos) != 2 {
+		t.Fatalf("got todos in %d lists want 2", len(todos))
+	}
+	for listID, listTodos := range todos {
+		if len(listTodos) != 1 || listTodos[0].Title != "to do" {
+			t.Errorf("list %s: got %+v want only the todo to do", listID, listTodos)
+		}
+	}
+}
+
+func TestJsonStoreSharedDirectory(t *testing.T) {
+	dir := t.TempDir() + "/"
+
+	first, _ := store.NewJsonStore(dir)
+	second, _ := store.NewJsonStore(dir)
+
+	userID, err := first.CreateUser("Steve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listID, err := first.CreateTodoList(store.NewTodoList("", "groceries"), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		s := first
+		if i%2 == 1 {
+			s = second
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			title := "item " + strconv.Itoa(i)
+			if _, err := s.AddTodo(store.Todo{Title: title}, listID, userID, userID); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	list, err := second.GetTodoList(userID, listID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list.Todos) != 20 {
+		t.Errorf("got %d todos want 20", len(list.Todos))
+	}
+}
+
+// newApiStore serves a JsonStore built with opts through the API, behind
+// RequireAuth when requireAuth is set.
+func newApiStore(t *testing.T, requireAuth bool, opts ...store.Option) store.ApiStore {
+	dir := t.TempDir() + "/"
+
+	backend, err := store.NewJsonStore(dir, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listHandler := api.NewListHandler(backend, api.NewSessions(api.DefaultSessionTTL))
+	var handler http.Handler = listHandler
+	if requireAuth {
+		handler = listHandler.RequireAuth()
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store.NewApiStore(serverURL.Port())
+}
+
+func TestApiStore(t *testing.T) {
+	// The store is tested without RequireAuth, logging in is up to the API tests.
+	storetest.Run(t, func(opts ...store.Option) store.Store {
+		return newApiStore(t, false, opts...)
+	})
+}
+
+func TestApiStorePassword(t *testing.T) {
+	s := newApiStore(t, true)
+
+	userID, err := s.Register("Steve", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, secret, err := s.CreateAPIKey(userID, store.APIKey{Name: "ci", Scope: store.ScopeRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.SetPassword(userID, "battery staple"); err != nil {
+		t.Fatalf("SetPassword logged in: %v", err)
+	}
+	if err = s.CheckPassword(userID, "correct horse"); !errors.Is(err, store.ErrUnauthorized) {
+		t.Errorf("CheckPassword with the old password got %v want %v", err, store.ErrUnauthorized)
+	}
+	if err = s.SetPassword(userID, "stolen horse"); err != nil {
+		t.Fatalf("SetPassword again: %v", err)
+	}
+
+	// Checking the password mustn't swap the read-only key for a session.
+	s.UseAPIKey(secret)
+	if err = s.CheckPassword(userID, "stolen horse"); err != nil {
+		t.Fatalf("CheckPassword: %v", err)
+	}
+	if err = s.RenameUser(userID, "Stephen"); err == nil {
+		t.Error("RenameUser with a read-only key succeeded after CheckPassword")
+	}
+}
+
+func TestApiStoreConcurrentToggles(t *testing.T) {
+	s := newApiStore(t, false)
+
+	userID, err := s.CreateUser("Steve")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := store.NewTodoList("", "groceries")
+	for i := range 10 {
+		id := strconv.Itoa(i)
+		list.Todos[id] = &store.Todo{ID: id, Title: "item " + id}
+	}
+	listID, err := s.CreateTodoList(list, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The store picked the IDs of the todos.
+	if list, err = s.GetTodoList(userID, listID); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for id := range list.Todos {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.ToggleTodo(userID, listID, id, userID); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, err := s.GetTodoList(userID, listID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, todo := range got.Todos {
+		if !todo.Completed {
+			t.Errorf("todo %s lost its toggle", id)
+		}
+	}
+}
@@ -0,0 +1,1995 @@
+// Package storetest is a conformance suite for store.Store implementations.
+// Every backend runs the same suite so they can be trusted to behave alike.
+package storetest
+
+import (
+	"ToDo/store"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Run exercises every method of store.Store against fresh stores returned by
+// newStore, which builds them with opts. Each subtest gets its own store.
+func Run(t *testing.T, newStore func(opts ...store.Option) store.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s store.Store)
+	}{
+		{"CreateUser", testCreateUser},
+		{"CreateUserUniqueIDs", testCreateUserUniqueIDs},
+		{"GetUserNotFound", testGetUserNotFound},
+		{"GetUsers", testGetUsers},
+		{"RenameUser", testRenameUser},
+		{"UserNameTaken", testUserNameTaken},
+		{"DeleteUser", testDeleteUser},
+		{"UserNotFound", testUserNotFound},
+		{"Password", testPassword},
+		{"PasswordInvalid", testPasswordInvalid},
+		{"APIKeys", testAPIKeys},
+		{"APIKeyInvalid", testAPIKeyInvalid},
+		{"GetTodoListsEmpty", testGetTodoListsEmpty},
+		{"ListsUserNotFound", testListsUserNotFound},
+		{"CreateTodoList", testCreateTodoList},
+		{"CreateTodoListUniqueIDs", testCreateTodoListUniqueIDs},
+		{"UpdateTodoListReplaces", testUpdateTodoListReplaces},
+		{"UpdateTodoListVersions", testUpdateTodoListVersions},
+		{"UpdateTodoListNotFound", testUpdateTodoListNotFound},
+		{"UpdateTodoListStaleVersion", testUpdateTodoListStaleVersion},
+		{"TodoListLeftToCaller", testTodoListLeftToCaller},
+		{"TodoListTodoIDs", testTodoListTodoIDs},
+		{"TodoChangesBumpVersion", testTodoChangesBumpVersion},
+		{"GetTodoListNotFound", testGetTodoListNotFound},
+		{"DeleteTodoList", testDeleteTodoList},
+		{"DeleteTodoListNotFound", testDeleteTodoListNotFound},
+		{"AddTodo", testAddTodo},
+		{"AddTodoListNotFound", testAddTodoListNotFound},
+		{"AddTodoUniqueIDs", testAddTodoUniqueIDs},
+		{"AddTodoPosition", testAddTodoPosition},
+		{"UpdateTodo", testUpdateTodo},
+		{"UpdateTodoNotFound", testUpdateTodoNotFound},
+		{"TodoDates", testTodoDates},
+		{"MoveTodoList", testMoveTodoList},
+		{"MoveTodoListNotFound", testMoveTodoListNotFound},
+		{"MoveTodo", testMoveTodo},
+		{"MoveTodoNotFound", testMoveTodoNotFound},
+		{"Subtasks", testSubtasks},
+		{"AddSubtaskParentNotFound", testAddSubtaskParentNotFound},
+		{"UpdateTodoListChecksParents", testUpdateTodoListChecksParents},
+		{"MissingGrandparent", testMissingGrandparent},
+		{"DeleteTodoDeletesSubtasks", testDeleteTodoDeletesSubtasks},
+		{"ToggleTodoCompletesSubtasks", testToggleTodoCompletesSubtasks},
+		{"RecurringTodo", testRecurringTodo},
+		{"RecurringTodoAcrossDST", testRecurringTodoAcrossDST},
+		{"RecurringTodoInvalid", testRecurringTodoInvalid},
+		{"TodoTags", testTodoTags},
+		{"FindTodosByTag", testFindTodosByTag},
+		{"FindTodosUserNotFound", testFindTodosUserNotFound},
+		{"TodoTimestamps", testTodoTimestamps},
+		{"TodoHistory", testTodoHistory},
+		{"TodoHistoryNotFound", testTodoHistoryNotFound},
+		{"TrashTodoList", testTrashTodoList},
+		{"TrashTodo", testTrashTodo},
+		{"RestoreTodoParentGone", testRestoreTodoParentGone},
+		{"RestoreNotFound", testRestoreNotFound},
+		{"PurgeTrash", testPurgeTrash},
+		{"ShareTodoList", testShareTodoList},
+		{"ShareTodoListInvalid", testShareTodoListInvalid},
+		{"DeleteUserLeavesSharedLists", testDeleteUserLeavesSharedLists},
+		{"AssignTodo", testAssignTodo},
+		{"AssignTodoInvalid", testAssignTodoInvalid},
+		{"UnassignRemovedMember", testUnassignRemovedMember},
+		{"FindTodosByAssignee", testFindTodosByAssignee},
+		{"DeleteTodo", testDeleteTodo},
+		{"DeleteTodoNotFound", testDeleteTodoNotFound},
+		{"ToggleTodo", testToggleTodo},
+		{"ToggleTodoListNotFound", testToggleTodoListNotFound},
+		{"ToggleTodoNotFound", testToggleTodoNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore())
+		})
+	}
+
+	// These pick the options of their stores.
+	t.Run("UpdateTodoListForgetsDropped", func(t *testing.T) {
+		testUpdateTodoListForgetsDropped(t, newStore)
+	})
+}
+
+// reusedIDs hands out the IDs it is told to reuse before going on with ids,
+// standing in for a generator that repeats itself.
+type reusedIDs struct {
+	mu    sync.Mutex
+	reuse []string
+	ids   store.IDGenerator
+}
+
+func (g *reusedIDs) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(g.reuse) == 0 {
+		return g.ids.NewID()
+	}
+	id := g.reuse[0]
+	g.reuse = g.reuse[1:]
+	return id
+}
+
+func (g *reusedIDs) again(id string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.reuse = append(g.reuse, id)
+}
+
+func assertErrorIs(t *testing.T, err error, want error) {
+	t.Helper()
+
+	if err == nil {
+		t.Fatalf("expected an error matching %v", want)
+	}
+	if !errors.Is(err, want) {
+		t.Errorf("got %v want an error matching %v", err, want)
+	}
+}
+
+func mustCreateUser(t *testing.T, s store.Store, name string) string {
+	t.Helper()
+
+	id, err := s.CreateUser(name)
+	if err != nil {
+		t.Fatalf("CreateUser(%q): %v", name, err)
+	}
+	return id
+}
+
+func mustCreateTodoList(t *testing.T, s store.Store, name string, userID string) string {
+	t.Helper()
+
+	id, err := s.CreateTodoList(store.NewTodoList("", name), userID)
+	if err != nil {
+		t.Fatalf("CreateTodoList(%q, %q): %v", name, userID, err)
+	}
+	return id
+}
+
+func mustUpdateTodoList(t *testing.T, s store.Store, list store.TodoList, userID string) {
+	t.Helper()
+
+	if err := s.UpdateTodoList(list, userID, userID); err != nil {
+		t.Fatalf("UpdateTodoList(%q, %q): %v", list.ID, userID, err)
+	}
+}
+
+func mustGetTodoList(t *testing.T, s store.Store, userID, listID string) store.TodoList {
+	t.Helper()
+
+	list, err := s.GetTodoList(userID, listID)
+	if err != nil {
+		t.Fatalf("GetTodoList(%q, %q): %v", userID, listID, err)
+	}
+	return list
+}
+
+func mustAddTodo(t *testing.T, s store.Store, title string, listID string, userID string) string {
+	t.Helper()
+
+	id, err := s.AddTodo(store.Todo{Title: title}, listID, userID, userID)
+	if err != nil {
+		t.Fatalf("AddTodo(%q, %q, %q): %v", title, listID, userID, err)
+	}
+	return id
+}
+
+func testCreateUser(t *testing.T, s store.Store) {
+	id := mustCreateUser(t, s, "Steve")
+
+	user, err := s.GetUser(id)
+	if err != nil {
+		t.Fatalf("GetUser(%q): %v", id, err)
+	}
+
+	if user.ID != id {
+		t.Errorf("got ID %q want %q", user.ID, id)
+	}
+	if user.Name != "Steve" {
+		t.Errorf("got name %q want %q", user.Name, "Steve")
+	}
+}
+
+func testCreateUserUniqueIDs(t *testing.T, s store.Store) {
+	first := mustCreateUser(t, s, "Steve")
+	second := mustCreateUser(t, s, "Stephen")
+
+	if first == second {
+		t.Fatalf("both users got ID %q", first)
+	}
+
+	user, err := s.GetUser(first)
+	if err != nil {
+		t.Fatalf("GetUser(%q): %v", first, err)
+	}
+	if user.Name != "Steve" {
+		t.Errorf("got name %q want %q", user.Name, "Steve")
+	}
+}
+
+func testGetUserNotFound(t *testing.T, s store.Store) {
+	_, err := s.GetUser("missing")
+	assertErrorIs(t, err, store.ErrUserNotFound)
+}
+
+func testGetUsers(t *testing.T, s store.Store) {
+	users, err := s.GetUsers()
+	if err != nil {
+		t.Fatalf("GetUsers: %v", err)
+	}
+	if len(users) != 0 {
+		t.Errorf("got %+v want no users", users)
+	}
+
+	steve := mustCreateUser(t, s, "Steve")
+	stephen := mustCreateUser(t, s, "Stephen")
+	mustCreateTodoList(t, s, "groceries", steve)
+
+	if users, err = s.GetUsers(); err != nil {
+		t.Fatalf("GetUsers: %v", err)
+	}
+
+	want := []store.User{{ID: steve, Name: "Steve"}, {ID: stephen, Name: "Stephen"}}
+	slices.SortFunc(want, func(a, b store.User) int { return strings.Compare(a.ID, b.ID) })
+	if !reflect.DeepEqual(users, want) {
+		t.Errorf("got %+v want %+v", users, want)
+	}
+}
+
+func testRenameUser(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+
+	if err := s.RenameUser(userID, "Stephen"); err != nil {
+		t.Fatalf("RenameUser: %v", err)
+	}
+
+	user, err := s.GetUser(userID)
+	if err != nil {
+		t.Fatalf("GetUser(%q): %v", userID, err)
+	}
+	if user.Name != "Stephen" {
+		t.Errorf("got name %q want %q", user.Name, "Stephen")
+	}
+}
+
+func testUserNameTaken(t *testing.T, s store.Store) {
+	mustCreateUser(t, s, "Steve")
+	stephen := mustCreateUser(t, s, "Stephen")
+
+	_, err := s.CreateUser("STEVE")
+	assertErrorIs(t, err, store.ErrConflict)
+
+	err = s.RenameUser(stephen, "steve")
+	assertErrorIs(t, err, store.ErrConflict)
+
+	// Users may change the case of their own name.
+	if err = s.RenameUser(stephen, "STEPHEN"); err != nil {
+		t.Errorf("RenameUser to the same name: %v", err)
+	}
+	err = s.RenameUser("missing", "Steve")
+	assertErrorIs(t, err, store.ErrUserNotFound)
+}
+
+func testDeleteUser(t *testing.T, s store.Store) {
+	steve := mustCreateUser(t, s, "Steve")
+	stephen := mustCreateUser(t, s, "Stephen")
+	groceries := mustCreateTodoList(t, s, "groceries", steve)
+	chores := mustCreateTodoList(t, s, "chores", steve)
+	mustAddTodo(t, s, "milk", groceries, steve)
+	mustCreateTodoList(t, s, "garden", stephen)
+
+	if err := s.DeleteTodoList(steve, chores); err != nil {
+		t.Fatalf("DeleteTodoList: %v", err)
+	}
+	if err := s.DeleteUser(steve); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	_, err := s.GetUser(steve)
+	assertErrorIs(t, err, store.ErrUserNotFound)
+	_, err = s.GetTodoList(steve, groceries)
+	assertErrorIs(t, err, store.ErrUserNotFound)
+	_, err = s.Trash(steve)
+	assertErrorIs(t, err, store.ErrUserNotFound)
+
+	users, err := s.GetUsers()
+	if err != nil {
+		t.Fatalf("GetUsers: %v", err)
+	}
+	if len(users) != 1 || users[0].ID != stephen {
+		t.Errorf("got %+v want only %s", users, stephen)
+	}
+	if lists, err := s.GetTodoLists(stephen); err != nil || len(lists) != 1 {
+		t.Errorf("got %+v, %v want the other user's list left alone", lists, err)
+	}
+}
+
+func testUserNotFound(t *testing.T, s store.Store) {
+	err := s.RenameUser("missing", "Steve")
+	assertErrorIs(t, err, store.ErrUserNotFound)
+
+	err = s.DeleteUser("missing")
+	assertErrorIs(t, err, store.ErrUserNotFound)
+}
+
+func testPassword(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+
+	err := s.CheckPassword(userID, "")
+	assertErrorIs(t, err, store.ErrUnauthorized)
+
+	if err = s.SetPassword(userID, "correct horse"); err != nil {
+		t.Fatalf("SetPassword: %v", err)
+	}
+	if err = s.CheckPassword(userID, "correct horse"); err != nil {
+		t.Errorf("CheckPassword with the right password: %v", err)
+	}
+	err = s.CheckPassword(userID, "battery staple")
+	assertErrorIs(t, err, store.ErrUnauthorized)
+
+	if err = s.SetPassword(userID, "battery staple"); err != nil {
+		t.Fatalf("SetPassword: %v", err)
+	}
+	err = s.CheckPassword(userID, "correct horse")
+	assertErrorIs(t, err, store.ErrUnauthorized)
+	if err = s.CheckPassword(userID, "battery staple"); err != nil {
+		t.Errorf("CheckPassword with the new password: %v", err)
+	}
+
+	// Over the API a missing user is only told apart from a wrong password
+	// when setting one.
+	if err = s.CheckPassword("missing", "correct horse"); err == nil {
+		t.Error("CheckPassword of a missing user succeeded")
+	}
+}
+
+func testPasswordInvalid(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+
+	err := s.SetPassword(userID, strings.Repeat("a", store.MinPasswordLength-1))
+	assertErrorIs(t, err, store.ErrInvalidUser)
+	err = s.SetPassword(userID, strings.Repeat("a", 73))
+	assertErrorIs(t, err, store.ErrInvalidUser)
+	err = s.SetPassword("missing", "correct horse")
+	assertErrorIs(t, err, store.ErrUserNotFound)
+}
+
+func testAPIKeys(t *testing.T, s store.Store) {
+	steve := mustCreateUser(t, s, "Steve")
+	stephen := mustCreateUser(t, s, "Stephen")
+
+	backup, secret, err := s.CreateAPIKey(steve, store.APIKey{Name: "backup", Scope: store.ScopeRead})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if backup.ID == "" || backup.UserID != steve || len(backup.Hash) != 0 || !strings.HasPrefix(secret, store.APIKeyPrefix) {
+		t.Errorf("got key %+v with secret %q", backup, secret)
+	}
+	ci, ciSecret, err := s.CreateAPIKey(steve, store.APIKey{Name: "ci"})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if ci.Scope != store.ScopeWrite || ciSecret == secret {
+		t.Errorf("got key %+v with secret %q want a new writing key", ci, ciSecret)
+	}
+	if _, _, err = s.CreateAPIKey(stephen, store.APIKey{Name: "phone"}); err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+
+	keys, err := s.GetAPIKeys(steve)
+	if err != nil {
+		t.Fatalf("GetAPIKeys: %v", err)
+	}
+	if len(keys) != 2 || keys[0].ID != backup.ID || keys[1].ID != ci.ID || len(keys[0].Hash) != 0 {
+		t.Errorf("got %+v want backup then ci without hashes", keys)
+	}
+
+	checked, err := s.CheckAPIKey(secret)
+	if err != nil {
+		t.Fatalf("CheckAPIKey: %v", err)
+	}
+	if checked.ID != backup.ID || checked.UserID != steve || checked.Scope != store.ScopeRead {
+		t.Errorf("got %+v want the backup key", checked)
+	}
+	_, err = s.CheckAPIKey(store.APIKeyPrefix + "guessed")
+	assertErrorIs(t, err, store.ErrUnauthorized)
+
+	if err = s.RevokeAPIKey(steve, backup.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	_, err = s.CheckAPIKey(secret)
+	assertErrorIs(t, err, store.ErrUnauthorized)
+	if _, err = s.CheckAPIKey(ciSecret); err != nil {
+		t.Errorf("CheckAPIKey of the key left: %v", err)
+	}
+
+	err = s.RevokeAPIKey(steve, backup.ID)
+	assertErrorIs(t, err, store.ErrKeyNotFound)
+	err = s.RevokeAPIKey("missing", ci.ID)
+	assertErrorIs(t, err, store.ErrUserNotFound)
+	_, err = s.GetAPIKeys("missing")
+	assertErrorIs(t, err, store.ErrUserNotFound)
+
+	if err = s.DeleteUser(steve); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	_, err = s.CheckAPIKey(ciSecret)
+	assertErrorIs(t, err, store.ErrUnauthorized)
+}
+
+func testAPIKeyInvalid(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+
+	_, _, err := s.CreateAPIKey(userID, store.APIKey{Name: "ci", Scope: "admin"})
+	assertErrorIs(t, err, store.ErrInvalidKey)
+
+	yesterday := time.Now().AddDate(0, 0, -1)
+	_, _, err = s.CreateAPIKey(userID, store.APIKey{Name: "ci", ExpiresAt: &yesterday})
+	assertErrorIs(t, err, store.ErrInvalidKey)
+
+	_, _, err = s.CreateAPIKey("missing", store.APIKey{Name: "ci"})
+	assertErrorIs(t, err, store.ErrUserNotFound)
+}
+
+func testGetTodoListsEmpty(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+
+	lists, err := s.GetTodoLists(userID)
+	if err != nil {
+		t.Fatalf("GetTodoLists(%q): %v", userID, err)
+	}
+
+	if len(lists) != 0 {
+		t.Errorf("got %d lists want 0", len(lists))
+	}
+}
+
+func testListsUserNotFound(t *testing.T, s store.Store) {
+	_, err := s.GetTodoLists("missing")
+	assertErrorIs(t, err, store.ErrUserNotFound)
+
+	_, err = s.GetTodoList("missing", "1")
+	assertErrorIs(t, err, store.ErrUserNotFound)
+
+	_, err = s.CreateTodoList(store.NewTodoList("", "groceries"), "missing")
+	assertErrorIs(t, err, store.ErrUserNotFound)
+
+	err = s.UpdateTodoList(store.NewTodoList("1", "groceries"), "missing", "missing")
+	assertErrorIs(t, err, store.ErrUserNotFound)
+}
+
+func testCreateTodoList(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+
+	listID, err := s.CreateTodoList(store.NewTodoList("mine", "groceries"), userID)
+	if err != nil {
+		t.Fatalf("CreateTodoList: %v", err)
+	}
+	if listID == "" || listID == "mine" {
+		t.Fatalf("got list ID %q want one picked by the store", listID)
+	}
+
+	list := mustGetTodoList(t, s, userID, listID)
+	if list.ID != listID {
+		t.Errorf("got ID %q want %q", list.ID, listID)
+	}
+	if list.Name != "groceries" {
+		t.Errorf("got name %q want %q", list.Name, "groceries")
+	}
+	if list.Version != 1 {
+		t.Errorf("got version %d want 1", list.Version)
+	}
+
+	lists, err := s.GetTodoLists(userID)
+	if err != nil {
+		t.Fatalf("GetTodoLists(%q): %v", userID, err)
+	}
+	if len(lists) != 1 {
+		t.Fatalf("got %d lists want 1", len(lists))
+	}
+	if lists[listID] == nil || lists[listID].Name != "groceries" {
+		t.Errorf("got %+v want list %s named %q", lists, listID, "groceries")
+	}
+}
+
+func testCreateTodoListUniqueIDs(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+
+	first := mustCreateTodoList(t, s, "groceries", userID)
+	second := mustCreateTodoList(t, s, "groceries", userID)
+
+	if first == second {
+		t.Fatalf("both lists got ID %q", first)
+	}
+
+	lists, err := s.GetTodoLists(userID)
+	if err != nil {
+		t.Fatalf("GetTodoLists(%q): %v", userID, err)
+	}
+	if len(lists) != 2 {
+		t.Errorf("got %d lists want 2", len(lists))
+	}
+}
+
+func testUpdateTodoListReplaces(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "groceries", userID)
+
+	mustUpdateTodoList(t, s, store.NewTodoList(listID, "shopping"), userID)
+
+	list := mustGetTodoList(t, s, userID, listID)
+	if list.Name != "shopping" {
+		t.Errorf("got name %q want %q", list.Name, "shopping")
+	}
+
+	lists, err := s.GetTodoLists(userID)
+	if err != nil {
+		t.Fatalf("GetTodoLists(%q): %v", userID, err)
+	}
+	if len(lists) != 1 {
+		t.Errorf("got %d lists want 1", len(lists))
+	}
+}
+
+func testUpdateTodoListVersions(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "groceries", userID)
+
+	list := mustGetTodoList(t, s, userID, listID)
+	list.Name = "shopping"
+	mustUpdateTodoList(t, s, list, userID)
+
+	list = mustGetTodoList(t, s, userID, listID)
+	if list.Version != 2 {
+		t.Errorf("got version %d want 2", list.Version)
+	}
+	if list.Name != "shopping" {
+		t.Errorf("got name %q want %q", list.Name, "shopping")
+	}
+}
+
+func testUpdateTodoListNotFound(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+
+	err := s.UpdateTodoList(store.NewTodoList("missing", "groceries"), userID, userID)
+	assertErrorIs(t, err, store.ErrListNotFound)
+
+	lists, err := s.GetTodoLists(userID)
+	if err != nil {
+		t.Fatalf("GetTodoLists(%q): %v", userID, err)
+	}
+	if len(lists) != 0 {
+		t.Errorf("got %d lists want 0", len(lists))
+	}
+}
+
+// testUpdateTodoListForgetsDropped checks a todo that UpdateTodoList drops
+// takes its history along, so a todo that gets its ID later starts afresh.
+func testUpdateTodoListForgetsDropped(t *testing.T, newStore func(opts ...store.Option) store.Store) {
+	ids := &reusedIDs{ids: store.NewSequenceGenerator()}
+	s := newStore(store.WithIDGenerator(ids))
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "groceries", userID)
+	milk := mustAddTodo(t, s, "milk", listID, userID)
+
+	list := mustGetTodoList(t, s, userID, listID)
+	list.Todos[milk].Title = "oat milk"
+	mustUpdateTodoList(t, s, list, userID)
+	list = mustGetTodoList(t, s, userID, listID)
+	delete(list.Todos, milk)
+	mustUpdateTodoList(t, s, list, userID)
+
+	ids.again(milk)
+	if bread := mustAddTodo(t, s, "bread", listID, userID); bread != milk {
+		t.Fatalf("got ID %q want the reused %q", bread, milk)
+	}
+	history, err := s.TodoHistory(userID, listID, milk)
+	if err != nil {
+		t.Fatalf("TodoHistory: %v", err)
+	}
+	if len(history) != 1 || history[0].Action != store.ActionCreated {
+		t.Errorf("got history %+v want only the new todo's creation", history)
+	}
+}
+
+func testUpdateTodoListStaleVersion(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "groceries", userID)
+
+	first := mustGetTodoList(t, s, userID, listID)
+	second := mustGetTodoList(t, s, userID, listID)
+
+	first.Name = "shopping"
+	mustUpdateTodoList(t, s, first, userID)
+
+	second.Name = "errands"
+	err := s.UpdateTodoList(second, userID, userID)
+	assertErrorIs(t, err, store.ErrConflict)
+
+	list := mustGetTodoList(t, s, userID, listID)
+	if list.Name != "shopping" {
+		t.Errorf("got name %q want %q", list.Name, "shopping")
+	}
+}
+
+func testTodoChangesBumpVersion(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "groceries", userID)
+
+	stale := mustGetTodoList(t, s, userID, listID)
+
+	todoID := mustAddTodo(t, s, "milk", listID, userID)
+	if err := s.ToggleTodo(userID, listID, todoID, userID); err != nil {
+		t.Fatalf("ToggleTodo: %v", err)
+	}
+
+	list := mustGetTodoList(t, s, userID, listID)
+	if list.Version != stale.Version+2 {
+		t.Errorf("got version %d want %d", list.Version, stale.Version+2)
+	}
+
+	err := s.UpdateTodoList(stale, userID, userID)
+	assertErrorIs(t, err, store.ErrConflict)
+}
+
+// testTodoListTodoIDs checks that the store picks the IDs of todos that come
+// with a list, keeping only those of the todos it already holds.
+func testTodoListTodoIDs(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+
+	list := store.NewTodoList("", "trip")
+	list.Todos = map[string]*store.Todo{
+		"a": {ID: "a", Title: "pack", Position: 0},
+		"b": {ID: "b", Title: "socks", ParentID: "a", Position: 0},
+	}
+	listID, err := s.CreateTodoList(list, userID)
+	if err != nil {
+		t.Fatalf("CreateTodoList: %v", err)
+	}
+
+	list = mustGetTodoList(t, s, userID, listID)
+	ids := map[string]string{}
+	for id, todo := range list.Todos {
+		if id != todo.ID || id == "a" || id == "b" {
+			t.Errorf("got todo %q stored as %q want an ID picked by the store", todo.ID, id)
+		}
+		ids[todo.Title] = id
+	}
+	if socks := list.Todos[ids["socks"]]; socks == nil || socks.ParentID != ids["pack"] {
+		t.Fatalf("got socks %+v want it beneath pack, %s", socks, ids["pack"])
+	}
+
+	// A todo the list doesn't hold gets a new ID, even one it held before.
+	if err = s.DeleteTodo(userID, listID, ids["socks"], userID); err != nil {
+		t.Fatalf("DeleteTodo: %v", err)
+	}
+	list = mustGetTodoList(t, s, userID, listID)
+	list.Todos[ids["socks"]] = &store.Todo{ID: ids["socks"], Title: "shoes", ParentID: ids["pack"]}
+	mustUpdateTodoList(t, s, list, userID)
+
+	list = mustGetTodoList(t, s, userID, listID)
+	if len(list.Todos) != 2 || list.Todos[ids["pack"]] == nil || list.Todos[ids["socks"]] != nil {
+		t.Errorf("got todos %v want pack kept and shoes under a new ID", list.Todos)
+	}
+}
+
+// testTodoListLeftToCaller checks that the todos of a list given to the
+// store aren't stamped in place, the store keeps its own copy.
+func testTodoListLeftToCaller(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+
+	list := store.NewTodoList("", "groceries")
+	list.Todos["milk"] = &store.Todo{ID: "milk", Title: "milk"}
+	listID, err := s.CreateTodoList(list, userID)
+	if err != nil {
+		t.Fatalf("CreateTodoList: %v", err)
+	}
+	if todo := list.Todos["milk"]; !todo.CreatedAt.IsZero() || !todo.UpdatedAt.IsZero() {
+		t.Errorf("CreateTodoList stamped the caller's todo: %+v", todo)
+	}
+
+	list = mustGetTodoList(t, s, userID, listID)
+	for _, todo := range list.Todos {
+		todo.Title = "oat milk"
+		todo.UpdatedAt = time.Time{}
+	}
+	list.Todos["bread"] = &store.Todo{ID: "bread", Title: "bread"}
+	mustUpdateTodoList(t, s, list, userID)
+	for _, todo := range list.Todos {
+		if !todo.UpdatedAt.IsZero() {
+			t.Errorf("UpdateTodoList stamped the caller's todo: %+v", todo)
+		}
+	}
+}
+
+func testGetTodoListNotFound(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+
+	_, err := s.GetTodoList(userID, "missing")
+	assertErrorIs(t, err, store.ErrListNotFound)
+}
+
+func testDeleteTodoList(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+
+	groceries := mustCreateTodoList(t, s, "groceries", userID)
+	chores := mustCreateTodoList(t, s, "chores", userID)
+
+	if err := s.DeleteTodoList(userID, groceries); err != nil {
+		t.Fatalf("DeleteTodoList(%q, %q): %v", userID, groceries, err)
+	}
+
+	_, err := s.GetTodoList(userID, groceries)
+	assertErrorIs(t, err, store.ErrListNotFound)
+
+	lists, err := s.GetTodoLists(userID)
+	if err != nil {
+		t.Fatalf("GetTodoLists(%q): %v", userID, err)
+	}
+	if len(lists) != 1 || lists[chores] == nil {
+		t.Errorf("got %+v want only list %s", lists, chores)
+	}
+}
+
+func testDeleteTodoListNotFound(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+
+	err := s.DeleteTodoList(userID, "missing")
+	assertErrorIs(t, err, store.ErrListNotFound)
+}
+
+func testAddTodo(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "groceries", userID)
+
+	todo := store.Todo{ID: "mine", Title: "milk", Completed: false}
+	todoID, err := s.AddTodo(todo, listID, userID, userID)
+	if err != nil {
+		t.Fatalf("AddTodo: %v", err)
+	}
+	if todoID == "" || todoID == "mine" {
+		t.Fatalf("got todo ID %q want one picked by the store", todoID)
+	}
+
+	list := mustGetTodoList(t, s, userID, listID)
+	got, ok := list.Todos[todoID]
+	if !ok {
+		t.Fatalf("todo %s missing from list", todoID)
+	}
+	if got.ID != todoID || got.Title != "milk" || got.Completed {
+		t.Errorf("got %+v want %+v with ID %s", *got, todo, todoID)
+	}
+}
+
+func testAddTodoUniqueIDs(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "groceries", userID)
+
+	first := mustAddTodo(t, s, "milk", listID, userID)
+	second := mustAddTodo(t, s, "milk", listID, userID)
+
+	if first == second {
+		t.Fatalf("both todos got ID %q", first)
+	}
+
+	list := mustGetTodoList(t, s, userID, listID)
+	if len(list.Todos) != 2 {
+		t.Errorf("got %d todos want 2", len(list.Todos))
+	}
+}
+
+func testAddTodoListNotFound(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+
+	todo := store.Todo{Title: "milk", Completed: false}
+	_, err := s.AddTodo(todo, "missing", userID, userID)
+	assertErrorIs(t, err, store.ErrListNotFound)
+}
+
+func testUpdateTodo(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "groceries", userID)
+	todoID := mustAddTodo(t, s, "milk", listID, userID)
+
+	todo := store.Todo{
+		ID:        todoID,
+		Title:     "oat milk",
+		Notes:     "# Brands\n\n- Oatly\n- *anything* unsweetened\n",
+		Completed: true,
+		Priority:  store.PriorityHigh,
+		Tags:      []string{"dairy"},
+	}
+	if err := s.UpdateTodo(todo, listID, userID, userID); err != nil {
+		t.Fatalf("UpdateTodo: %v", err)
+	}
+
+	list := mustGetTodoList(t, s, userID, listID)
+	got := *list.Todos[todoID]
+	// The timestamps are the store's own, see testTodoTimestamps.
+	got.CreatedAt, got.UpdatedAt, got.CompletedAt = time.Time{}, time.Time{}, nil
+	if !reflect.DeepEqual(got, todo) {
+		t.Errorf("got %+v want %+v", got, todo)
+	}
+}
+
+func testUpdateTodoNotFound(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "groceries", userID)
+
+	err := s.UpdateTodo(store.Todo{ID: "missing", Title: "milk"}, listID, userID, userID)
+	assertErrorIs(t, err, store.ErrTodoNotFound)
+
+	err = s.UpdateTodo(store.Todo{ID: "1", Title: "milk"}, "missing", userID, userID)
+	assertErrorIs(t, err, store.ErrListNotFound)
+}
+
+func assertTime(t *testing.T, field string, got *time.Time, want *time.Time) {
+	t.Helper()
+
+	switch {
+	case got == nil && want == nil:
+	case got == nil || want == nil || !got.Equal(*want):
+		t.Errorf("got %s %v want %v", field, got, want)
+	}
+}
+
+func testTodoDates(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "groceries", userID)
+
+	start := time.Date(2024, time.March, 30, 9, 0, 0, 0, time.UTC)
+	due := time.Date(2024, time.April, 1, 17, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	todoID, err := s.AddTodo(store.Todo{Title: "taxes", Start: &start, Due: &due}, listID, userID, userID)
+	if err != nil {
+		t.Fatalf("AddTodo: %v", err)
+	}
+
+	got := mustGetTodoList(t, s, userID, listID).Todos[todoID]
+	assertTime(t, "start", got.Start, &start)
+	assertTime(t, "due", got.Due, &due)
+
+	later := due.AddDate(0, 0, 7)
+	got.Start = nil
+	got.Due = &later
+	if err = s.UpdateTodo(*got, listID, userID, userID); err != nil {
+		t.Fatalf("UpdateTodo: %v", err)
+	}
+
+	got = mustGetTodoList(t, s, userID, listID).Todos[todoID]
+	assertTime(t, "start", got.Start, nil)
+	assertTime(t, "due", got.Due, &later)
+}
+
+func listOrder(t *testing.T, s store.Store, userID string) []string {
+	t.Helper()
+
+	lists, err := s.GetTodoLists(userID)
+	if err != nil {
+		t.Fatalf("GetTodoLists(%q): %v", userID, err)
+	}
+
+	var names []string
+	for _, list := range store.SortTodoLists(lists) {
+		names = append(names, list.Name)
+	}
+	return names
+}
+
+func todoOrder(t *testing.T, s store.Store, userID string, listID string) []string {
+	t.Helper()
+
+	var titles []string
+	for _, todo := range store.SortTodos(mustGetTodoList(t, s, userID, listID).Todos, store.ByPosition) {
+		titles = append(titles, todo.Title)
+	}
+	return titles
+}
+
+func assertOrder(t *testing.T, got []string, want ...string) {
+	t.Helper()
+
+	if !slices.Equal(got, want) {
+		t.Errorf("got order %v want %v", got, want)
+	}
+}
+
+func testMoveTodoList(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+
+	mustCreateTodoList(t, s, "groceries", userID)
+	chores := mustCreateTodoList(t, s, "chores", userID)
+	mustCreateTodoList(t, s, "errands", userID)
+	assertOrder(t, listOrder(t, s, userID), "groceries", "chores", "errands")
+
+	if err := s.MoveTodoList(userID, chores, -1); err != nil {
+		t.Fatalf("MoveTodoList: %v", err)
+	}
+	assertOrder(t, listOrder(t, s, userID), "chores", "groceries", "errands")
+
+	if err := s.MoveTodoList(userID, chores, 10); err != nil {
+		t.Fatalf("MoveTodoList: %v", err)
+	}
+	assertOrder(t, listOrder(t, s, userID), "groceries", "errands", "chores")
+
+	// Updating a list leaves its place alone.
+	list := mustGetTodoList(t, s, userID, chores)
+	list.Position = 0
+	mustUpdateTodoList(t, s, list, userID)
+	assertOrder(t, listOrder(t, s, userID), "groceries", "errands", "chores")
+}
+
+func testMoveTodoListNotFound(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+
+	err := s.MoveTodoList(userID, "missing", 1)
+	assertErrorIs(t, err, store.ErrListNotFound)
+
+	err = s.MoveTodoList("missing", "1", 1)
+	assertErrorIs(t, err, store.ErrUserNotFound)
+}
+
+func testMoveTodo(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "groceries", userID)
+
+	mustAddTodo(t, s, "milk", listID, userID)
+	mustAddTodo(t, s, "bread", listID, userID)
+	eggs := mustAddTodo(t, s, "eggs", listID, userID)
+	assertOrder(t, todoOrder(t, s, userID, listID), "milk", "bread", "eggs")
+
+	before := mustGetTodoList(t, s, userID, listID)
+
+	if err := s.MoveTodo(userID, listID, eggs, -2, userID); err != nil {
+		t.Fatalf("MoveTodo: %v", err)
+	}
+	assertOrder(t, todoOrder(t, s, userID, listID), "eggs", "milk", "bread")
+
+	after := mustGetTodoList(t, s, userID, listID)
+	if after.Version != before.Version+1 {
+		t.Errorf("got version %d want %d", after.Version, before.Version+1)
+	}
+
+	if err := s.MoveTodo(userID, listID, eggs, -1, userID); err != nil {
+		t.Fatalf("MoveTodo: %v", err)
+	}
+	assertOrder(t, todoOrder(t, s, userID, listID), "eggs", "milk", "bread")
+
+	// Updating a todo leaves its place alone.
+	todo := *after.Todos[eggs]
+	todo.Position = 5
+	todo.Title = "free range eggs"
+	if err := s.UpdateTodo(todo, listID, userID, userID); err != nil {
+		t.Fatalf("UpdateTodo: %v", err)
+	}
+	assertOrder(t, todoOrder(t, s, userID, listID), "free range eggs", "milk", "bread")
+
+	mustAddTodo(t, s, "butter", listID, userID)
+	assertOrder(t, todoOrder(t, s, userID, listID), "free range eggs", "milk", "bread", "butter")
+}
+
+func testMoveTodoNotFound(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "groceries", userID)
+
+	err := s.MoveTodo(userID, listID, "missing", 1, userID)
+	assertErrorIs(t, err, store.ErrTodoNotFound)
+
+	err = s.MoveTodo(userID, "missing", "1", 1, userID)
+	assertErrorIs(t, err, store.ErrListNotFound)
+}
+
+// testAddTodoPosition checks that a new todo goes after the others with the
+// same parent, not counting those in the trash.
+func testAddTodoPosition(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "groceries", userID)
+
+	milk := mustAddTodo(t, s, "milk", listID, userID)
+	oat := mustAddSubtask(t, s, "oat", milk, listID, userID)
+	bread := mustAddTodo(t, s, "bread", listID, userID)
+	if err := s.DeleteTodo(userID, listID, bread, userID); err != nil {
+		t.Fatalf("DeleteTodo: %v", err)
+	}
+	eggs := mustAddTodo(t, s, "eggs", listID, userID)
+
+	list := mustGetTodoList(t, s, userID, listID)
+	for id, want := range map[string]int{milk: 0, oat: 0, eggs: 1} {
+		if got := list.Todos[id].Position; got != want {
+			t.Errorf("got position %d for %s want %d", got, list.Todos[id].Title, want)
+		}
+	}
+}
+
+func mustAddSubtask(t *testing.T, s store.Store, title string, parentID string, listID string, userID string) string {
+	t.Helper()
+
+	id, err := s.AddTodo(store.Todo{Title: title, ParentID: parentID}, listID, userID, userID)
+	if err != nil {
+		t.Fatalf("AddTodo(%q under %q): %v", title, parentID, err)
+	}
+	return id
+}
+
+func subtaskOrder(t *testing.T, s store.Store, userID string, listID string, parentID string) []string {
+	t.Helper()
+
+	var titles []string
+	for _, todo := range store.Subtasks(mustGetTodoList(t, s, userID, listID).Todos, parentID, store.ByPosition) {
+		titles = append(titles, todo.Title)
+	}
+	return titles
+}
+
+func testSubtasks(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "trip", userID)
+
+	pack := mustAddTodo(t, s, "pack", listID, userID)
+	mustAddTodo(t, s, "book hotel", listID, userID)
+	clothes := mustAddSubtask(t, s, "clothes", pack, listID, userID)
+	mustAddSubtask(t, s, "socks", clothes, listID, userID)
+	charger := mustAddSubtask(t, s, "charger", pack, listID, userID)
+
+	assertOrder(t, subtaskOrder(t, s, userID, listID, ""), "pack", "book hotel")
+	assertOrder(t, subtaskOrder(t, s, userID, listID, pack), "clothes", "charger")
+	assertOrder(t, subtaskOrder(t, s, userID, listID, clothes), "socks")
+
+	if err := s.MoveTodo(userID, listID, charger, -1, userID); err != nil {
+		t.Fatalf("MoveTodo: %v", err)
+	}
+	assertOrder(t, subtaskOrder(t, s, userID, listID, pack), "charger", "clothes")
+	assertOrder(t, subtaskOrder(t, s, userID, listID, ""), "pack", "book hotel")
+
+	if err := s.ToggleTodo(userID, listID, charger, userID); err != nil {
+		t.Fatalf("ToggleTodo: %v", err)
+	}
+	list := mustGetTodoList(t, s, userID, listID)
+	if done, total := store.Progress(list.Todos, pack); done != 1 || total != 2 {
+		t.Errorf("got progress %d/%d want 1/2", done, total)
+	}
+
+	// Updating a subtask leaves it under its parent.
+	todo := *list.Todos[clothes]
+	todo.ParentID = ""
+	todo.Title = "warm clothes"
+	if err := s.UpdateTodo(todo, listID, userID, userID); err != nil {
+		t.Fatalf("UpdateTodo: %v", err)
+	}
+	assertOrder(t, subtaskOrder(t, s, userID, listID, pack), "charger", "warm clothes")
+}
+
+func testAddSubtaskParentNotFound(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "trip", userID)
+
+	_, err := s.AddTodo(store.Todo{Title: "socks", ParentID: "missing"}, listID, userID, userID)
+	assertErrorIs(t, err, store.ErrInvalidTodo)
+}
+
+func testUpdateTodoListChecksParents(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "trip", userID)
+
+	pack := mustAddTodo(t, s, "pack", listID, userID)
+	socks := mustAddSubtask(t, s, "socks", pack, listID, userID)
+
+	list := mustGetTodoList(t, s, userID, listID)
+	list.Todos[pack].ParentID = socks
+	err := s.UpdateTodoList(list, userID, userID)
+	assertErrorIs(t, err, store.ErrInvalidTodo)
+
+	list = mustGetTodoList(t, s, userID, listID)
+	list.Todos[socks].ParentID = "missing"
+	err = s.UpdateTodoList(list, userID, userID)
+	assertErrorIs(t, err, store.ErrInvalidTodo)
+
+	// Moving a subtask to the top level is fine.
+	list = mustGetTodoList(t, s, userID, listID)
+	list.Todos[socks].ParentID = ""
+	mustUpdateTodoList(t, s, list, userID)
+	assertOrder(t, subtaskOrder(t, s, userID, listID, ""), "pack", "socks")
+}
+
+// testMissingGrandparent gives every todo a parent in the list except one,
+// whose parent is missing, so the walk up from its subtask reaches nothing.
+func testMissingGrandparent(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+
+	list := store.NewTodoList("", "trip")
+	list.Todos = map[string]*store.Todo{
+		"a": {ID: "a", Title: "pack", ParentID: "missing"},
+		"b": {ID: "b", Title: "socks", ParentID: "a"},
+	}
+	_, err := s.CreateTodoList(list, userID)
+	assertErrorIs(t, err, store.ErrInvalidTodo)
+
+	list.ID = mustCreateTodoList(t, s, "trip", userID)
+	list.Version = 1
+	err = s.UpdateTodoList(list, userID, userID)
+	assertErrorIs(t, err, store.ErrInvalidTodo)
+}
+
+func testDeleteTodoDeletesSubtasks(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "trip", userID)
+
+	pack := mustAddTodo(t, s, "pack", listID, userID)
+	clothes := mustAddSubtask(t, s, "clothes", pack, listID, userID)
+	mustAddSubtask(t, s, "socks", clothes, listID, userID)
+	mustAddTodo(t, s, "book hotel", listID, userID)
+
+	if err := s.DeleteTodo(userID, listID, pack, userID); err != nil {
+		t.Fatalf("DeleteTodo: %v", err)
+	}
+
+	var titles []string
+	for _, todo := range mustGetTodoList(t, s, userID, listID).Todos {
+		titles = append(titles, todo.Title)
+	}
+	assertOrder(t, titles, "book hotel")
+}
+
+func testToggleTodoCompletesSubtasks(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "trip", userID)
+
+	pack := mustAddTodo(t, s, "pack", listID, userID)
+	clothes := mustAddSubtask(t, s, "clothes", pack, listID, userID)
+	socks := mustAddSubtask(t, s, "socks", clothes, listID, userID)
+
+	completed := func() []bool {
+		t.Helper()
+		list := mustGetTodoList(t, s, userID, listID)
+		return []bool{list.Todos[pack].Completed, list.Todos[clothes].Completed, list.Todos[socks].Completed}
+	}
+	assertCompleted := func(want ...bool) {
+		t.Helper()
+		if got := completed(); !slices.Equal(got, want) {
+			t.Errorf("got completed %v want %v", got, want)
+		}
+	}
+
+	if err := s.ToggleTodo(userID, listID, pack, userID); err != nil {
+		t.Fatalf("ToggleTodo: %v", err)
+	}
+	assertCompleted(true, false, false)
+
+	if err := s.ToggleTodo(userID, listID, pack, userID); err != nil {
+		t.Fatalf("ToggleTodo: %v", err)
+	}
+
+	list := mustGetTodoList(t, s, userID, listID)
+	list.CompleteSubtasks = true
+	mustUpdateTodoList(t, s, list, userID)
+	if !mustGetTodoList(t, s, userID, listID).CompleteSubtasks {
+		t.Fatal("CompleteSubtasks was not kept")
+	}
+
+	if err := s.ToggleTodo(userID, listID, pack, userID); err != nil {
+		t.Fatalf("ToggleTodo: %v", err)
+	}
+	assertCompleted(true, true, true)
+
+	// Reopening a todo leaves its subtasks done.
+	if err := s.ToggleTodo(userID, listID, pack, userID); err != nil {
+		t.Fatalf("ToggleTodo: %v", err)
+	}
+	assertCompleted(false, true, true)
+}
+
+func testRecurringTodo(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "chores", userID)
+
+	due := time.Date(2024, time.March, 4, 18, 0, 0, 0, time.UTC)
+	todoID, err := s.AddTodo(store.Todo{Title: "water plants", Due: &due, Recurrence: "FREQ=WEEKLY;COUNT=2"}, listID, userID, userID)
+	if err != nil {
+		t.Fatalf("AddTodo: %v", err)
+	}
+
+	if err = s.ToggleTodo(userID, listID, todoID, userID); err != nil {
+		t.Fatalf("ToggleTodo: %v", err)
+	}
+
+	got := mustGetTodoList(t, s, userID, listID).Todos[todoID]
+	if got.Completed {
+		t.Error("the first occurrence completed the todo")
+	}
+	next := due.AddDate(0, 0, 7)
+	assertTime(t, "due", got.Due, &next)
+	if got.Recurrence != "FREQ=WEEKLY;COUNT=1" {
+		t.Errorf("got recurrence %q want FREQ=WEEKLY;COUNT=1", got.Recurrence)
+	}
+
+	if err = s.ToggleTodo(userID, listID, todoID, userID); err != nil {
+		t.Fatalf("ToggleTodo: %v", err)
+	}
+
+	got = mustGetTodoList(t, s, userID, listID).Todos[todoID]
+	if !got.Completed {
+		t.Error("the last occurrence didn't complete the todo")
+	}
+	assertTime(t, "due", got.Due, &next)
+}
+
+func testRecurringTodoAcrossDST(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "chores", userID)
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+
+	// Clocks in New York go forward on March 8, 2026. The due date is given
+	// with only its offset, the way stores keep it.
+	due := time.Date(2026, time.March, 7, 9, 0, 0, 0, time.FixedZone("", -5*60*60))
+	todoID, err := s.AddTodo(store.Todo{Title: "water plants", Due: &due, Recurrence: "FREQ=DAILY", TimeZone: "America/New_York"}, listID, userID, userID)
+	if err != nil {
+		t.Fatalf("AddTodo: %v", err)
+	}
+
+	for _, day := range []int{8, 9} {
+		if err = s.ToggleTodo(userID, listID, todoID, userID); err != nil {
+			t.Fatalf("ToggleTodo: %v", err)
+		}
+
+		got := mustGetTodoList(t, s, userID, listID).Todos[todoID]
+		want := time.Date(2026, time.March, day, 9, 0, 0, 0, newYork)
+		assertTime(t, "due", got.Due, &want)
+		if got.TimeZone != "America/New_York" {
+			t.Errorf("got time zone %q want America/New_York", got.TimeZone)
+		}
+	}
+}
+
+func testRecurringTodoInvalid(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "chores", userID)
+
+	due := time.Date(2024, time.March, 4, 18, 0, 0, 0, time.UTC)
+	_, err := s.AddTodo(store.Todo{Title: "water plants", Due: &due, Recurrence: "FREQ=HOURLY"}, listID, userID, userID)
+	assertErrorIs(t, err, store.ErrInvalidTodo)
+
+	_, err = s.AddTodo(store.Todo{Title: "water plants", Recurrence: "FREQ=DAILY"}, listID, userID, userID)
+	assertErrorIs(t, err, store.ErrInvalidTodo)
+
+	todoID := mustAddTodo(t, s, "water plants", listID, userID)
+	err = s.UpdateTodo(store.Todo{ID: todoID, Title: "water plants", Recurrence: "FREQ=DAILY"}, listID, userID, userID)
+	assertErrorIs(t, err, store.ErrInvalidTodo)
+
+	_, err = s.AddTodo(store.Todo{Title: "water plants", Due: &due, Recurrence: "FREQ=DAILY", TimeZone: "Mars/Olympus_Mons"}, listID, userID, userID)
+	assertErrorIs(t, err, store.ErrInvalidTodo)
+}
+
+func mustAddTaggedTodo(t *testing.T, s store.Store, title string, tags []string, listID string, userID string) string {
+	t.Helper()
+
+	id, err := s.AddTodo(store.Todo{Title: title, Tags: tags}, listID, userID, userID)
+	if err != nil {
+		t.Fatalf("AddTodo(%q, %q, %q): %v", title, listID, userID, err)
+	}
+	return id
+}
+
+func testTodoTags(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "chores", userID)
+	todoID := mustAddTaggedTodo(t, s, "taxes", []string{"work", "urgent"}, listID, userID)
+
+	got := mustGetTodoList(t, s, userID, listID).Todos[todoID]
+	if !slices.Equal(got.Tags, []string{"work", "urgent"}) {
+		t.Errorf("got tags %v want [work urgent]", got.Tags)
+	}
+
+	got.Tags = []string{"home"}
+	if err := s.UpdateTodo(*got, listID, userID, userID); err != nil {
+		t.Fatalf("UpdateTodo: %v", err)
+	}
+
+	got = mustGetTodoList(t, s, userID, listID).Todos[todoID]
+	if !slices.Equal(got.Tags, []string{"home"}) {
+		t.Errorf("got tags %v want [home]", got.Tags)
+	}
+
+	got.Tags = nil
+	if err := s.UpdateTodo(*got, listID, userID, userID); err != nil {
+		t.Fatalf("UpdateTodo: %v", err)
+	}
+
+	got = mustGetTodoList(t, s, userID, listID).Todos[todoID]
+	if len(got.Tags) != 0 {
+		t.Errorf("got tags %v want none", got.Tags)
+	}
+}
+
+func testFindTodosByTag(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	chores := mustCreateTodoList(t, s, "chores", userID)
+	office := mustCreateTodoList(t, s, "office", userID)
+
+	mustAddTaggedTodo(t, s, "report", []string{"work"}, office, userID)
+	mustAddTaggedTodo(t, s, "dishes", []string{"home"}, chores, userID)
+	mustAddTaggedTodo(t, s, "taxes", []string{"home", "work"}, chores, userID)
+	mustAddTaggedTodo(t, s, "email", []string{"work"}, office, userID)
+
+	other := mustCreateUser(t, s, "Stephen")
+	otherList := mustCreateTodoList(t, s, "office", other)
+	mustAddTaggedTodo(t, s, "meeting", []string{"work"}, otherList, other)
+
+	found, err := s.FindTodos(userID, store.TodoQuery{Tag: "#Work"})
+	if err != nil {
+		t.Fatalf("FindTodos: %v", err)
+	}
+
+	var got []string
+	for _, todo := range found {
+		got = append(got, todo.ListName+": "+todo.Title)
+		if todo.ListID != chores && todo.ListID != office {
+			t.Errorf("got list ID %q for %q", todo.ListID, todo.Title)
+		}
+	}
+	assertOrder(t, got, "chores: taxes", "office: report", "office: email")
+
+	found, err = s.FindTodos(userID, store.TodoQuery{Tag: "garden"})
+	if err != nil {
+		t.Fatalf("FindTodos: %v", err)
+	}
+	if found == nil || len(found) != 0 {
+		t.Errorf("got %v want an empty result", found)
+	}
+}
+
+func testFindTodosUserNotFound(t *testing.T, s store.Store) {
+	_, err := s.FindTodos("missing", store.TodoQuery{Tag: "work"})
+	assertErrorIs(t, err, store.ErrUserNotFound)
+}
+
+func testTodoTimestamps(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "groceries", userID)
+
+	before := time.Now()
+	todoID := mustAddTodo(t, s, "milk", listID, userID)
+
+	todo := *mustGetTodoList(t, s, userID, listID).Todos[todoID]
+	if todo.CreatedAt.Before(before) || todo.CreatedAt.After(time.Now()) {
+		t.Errorf("got CreatedAt %v want between %v and now", todo.CreatedAt, before)
+	}
+	if !todo.UpdatedAt.Equal(todo.CreatedAt) || todo.CompletedAt != nil {
+		t.Errorf("new todo got UpdatedAt %v CompletedAt %v want %v and nil", todo.UpdatedAt, todo.CompletedAt, todo.CreatedAt)
+	}
+
+	createdAt := todo.CreatedAt
+	todo.Title = "oat milk"
+	todo.CreatedAt = time.Time{}
+	if err := s.UpdateTodo(todo, listID, userID, userID); err != nil {
+		t.Fatalf("UpdateTodo: %v", err)
+	}
+
+	todo = *mustGetTodoList(t, s, userID, listID).Todos[todoID]
+	if !todo.CreatedAt.Equal(createdAt) {
+		t.Errorf("got CreatedAt %v want it kept at %v", todo.CreatedAt, createdAt)
+	}
+	if todo.UpdatedAt.Before(createdAt) {
+		t.Errorf("got UpdatedAt %v want no earlier than %v", todo.UpdatedAt, createdAt)
+	}
+
+	if err := s.ToggleTodo(userID, listID, todoID, userID); err != nil {
+		t.Fatalf("ToggleTodo: %v", err)
+	}
+	todo = *mustGetTodoList(t, s, userID, listID).Todos[todoID]
+	if todo.CompletedAt == nil || !todo.CompletedAt.Equal(todo.UpdatedAt) {
+		t.Errorf("completed todo got CompletedAt %v want %v", todo.CompletedAt, todo.UpdatedAt)
+	}
+
+	if err := s.ToggleTodo(userID, listID, todoID, userID); err != nil {
+		t.Fatalf("ToggleTodo: %v", err)
+	}
+	todo = *mustGetTodoList(t, s, userID, listID).Todos[todoID]
+	if todo.CompletedAt != nil {
+		t.Errorf("reopened todo got CompletedAt %v want nil", todo.CompletedAt)
+	}
+}
+
+func testTodoHistory(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "groceries", userID)
+	todoID := mustAddTodo(t, s, "milk", listID, userID)
+	mustAddTodo(t, s, "bread", listID, userID)
+
+	todo := mustGetTodoList(t, s, userID, listID).Todos[todoID]
+	todo.Title = "oat milk"
+	todo.Notes = "unsweetened"
+	if err := s.UpdateTodo(*todo, listID, userID, userID); err != nil {
+		t.Fatalf("UpdateTodo: %v", err)
+	}
+	// Saving it unchanged isn't a change.
+	if err := s.UpdateTodo(*todo, listID, userID, userID); err != nil {
+		t.Fatalf("UpdateTodo: %v", err)
+	}
+	for range 2 {
+		if err := s.ToggleTodo(userID, listID, todoID, userID); err != nil {
+			t.Fatalf("ToggleTodo: %v", err)
+		}
+	}
+	if err := s.MoveTodo(userID, listID, todoID, 1, userID); err != nil {
+		t.Fatalf("MoveTodo: %v", err)
+	}
+
+	list := mustGetTodoList(t, s, userID, listID)
+	list.Todos[todoID].Priority = store.PriorityHigh
+	mustUpdateTodoList(t, s, list, userID)
+
+	history, err := s.TodoHistory(userID, listID, todoID)
+	if err != nil {
+		t.Fatalf("TodoHistory: %v", err)
+	}
+
+	want := []struct {
+		action store.Action
+		fields []string
+	}{
+		{store.ActionCreated, nil},
+		{store.ActionUpdated, []string{"Title", "Notes"}},
+		{store.ActionCompleted, []string{"Completed"}},
+		{store.ActionReopened, []string{"Completed"}},
+		{store.ActionMoved, nil},
+		{store.ActionUpdated, []string{"Priority"}},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("got %d entries want %d: %+v", len(history), len(want), history)
+	}
+	for i, entry := range history {
+		if entry.Action != want[i].action || !slices.Equal(entry.Fields, want[i].fields) {
+			t.Errorf("entry %d: got %s %v want %s %v", i, entry.Action, entry.Fields, want[i].action, want[i].fields)
+		}
+		if entry.UserID != userID || entry.ListID != listID || entry.TodoID != todoID {
+			t.Errorf("entry %d: got user %s list %s todo %s", i, entry.UserID, entry.ListID, entry.TodoID)
+		}
+		if i > 0 && entry.At.Before(history[i-1].At) {
+			t.Errorf("entry %d at %v is before the one before it at %v", i, entry.At, history[i-1].At)
+		}
+	}
+
+	if last := history[len(history)-1].At; !mustGetTodoList(t, s, userID, listID).Todos[todoID].UpdatedAt.Equal(last) {
+		t.Errorf("want UpdatedAt to be the time of the last entry, %v", last)
+	}
+}
+
+func testTodoHistoryNotFound(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "groceries", userID)
+	todoID := mustAddTodo(t, s, "milk", listID, userID)
+
+	_, err := s.TodoHistory(userID, "missing", todoID)
+	assertErrorIs(t, err, store.ErrListNotFound)
+
+	if err = s.DeleteTodo(userID, listID, todoID, userID); err != nil {
+		t.Fatalf("DeleteTodo: %v", err)
+	}
+	_, err = s.TodoHistory(userID, listID, todoID)
+	assertErrorIs(t, err, store.ErrTodoNotFound)
+}
+
+func mustTrash(t *testing.T, s store.Store, userID string) store.Trash {
+	t.Helper()
+
+	trash, err := s.Trash(userID)
+	if err != nil {
+		t.Fatalf("Trash(%q): %v", userID, err)
+	}
+	return trash
+}
+
+func testTrashTodoList(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	groceries := mustCreateTodoList(t, s, "groceries", userID)
+	chores := mustCreateTodoList(t, s, "chores", userID)
+	milk := mustAddTodo(t, s, "milk", groceries, userID)
+
+	if err := s.DeleteTodoList(userID, groceries); err != nil {
+		t.Fatalf("DeleteTodoList: %v", err)
+	}
+
+	trash := mustTrash(t, s, userID)
+	if len(trash.Lists) != 1 || trash.Lists[0].ID != groceries || trash.Lists[0].DeletedAt == nil {
+		t.Fatalf("got %+v want list %s in the trash", trash.Lists, groceries)
+	}
+	if trash.Lists[0].Todos[milk] == nil {
+		t.Errorf("got %+v want todo %s kept with its list", trash.Lists[0].Todos, milk)
+	}
+
+	if err := s.RestoreTodoList(userID, groceries); err != nil {
+		t.Fatalf("RestoreTodoList: %v", err)
+	}
+
+	list := mustGetTodoList(t, s, userID, groceries)
+	if list.DeletedAt != nil || list.Todos[milk] == nil {
+		t.Errorf("got %+v want the list back with todo %s", list, milk)
+	}
+	if list.Position <= mustGetTodoList(t, s, userID, chores).Position {
+		t.Errorf("got position %d want the list restored after %s", list.Position, chores)
+	}
+	if trash = mustTrash(t, s, userID); len(trash.Lists) != 0 {
+		t.Errorf("got %+v want an empty trash", trash.Lists)
+	}
+}
+
+func testTrashTodo(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "trip", userID)
+
+	pack := mustAddTodo(t, s, "pack", listID, userID)
+	clothes := mustAddSubtask(t, s, "clothes", pack, listID, userID)
+	socks := mustAddSubtask(t, s, "socks", clothes, listID, userID)
+
+	if err := s.DeleteTodo(userID, listID, clothes, userID); err != nil {
+		t.Fatalf("DeleteTodo: %v", err)
+	}
+
+	var trashed []string
+	for _, todo := range mustTrash(t, s, userID).Todos {
+		if todo.ListID != listID || todo.DeletedAt == nil {
+			t.Errorf("got %+v want it deleted from list %s", todo, listID)
+		}
+		trashed = append(trashed, todo.ID)
+	}
+	slices.Sort(trashed)
+	want := []string{clothes, socks}
+	slices.Sort(want)
+	if !slices.Equal(trashed, want) {
+		t.Fatalf("got %v in the trash want %v", trashed, want)
+	}
+
+	if err := s.RestoreTodo(userID, listID, clothes, userID); err != nil {
+		t.Fatalf("RestoreTodo: %v", err)
+	}
+
+	list := mustGetTodoList(t, s, userID, listID)
+	if list.Todos[clothes] == nil || list.Todos[clothes].ParentID != pack || list.Todos[socks] == nil {
+		t.Fatalf("got %+v want clothes back under pack along with socks", list.Todos)
+	}
+	if len(mustTrash(t, s, userID).Todos) != 0 {
+		t.Errorf("want an empty trash")
+	}
+
+	history, err := s.TodoHistory(userID, listID, clothes)
+	if err != nil {
+		t.Fatalf("TodoHistory: %v", err)
+	}
+	var actions []store.Action
+	for _, entry := range history {
+		actions = append(actions, entry.Action)
+	}
+	if !slices.Equal(actions, []store.Action{store.ActionCreated, store.ActionDeleted, store.ActionRestored}) {
+		t.Errorf("got %v want created, deleted then restored", actions)
+	}
+}
+
+func testRestoreTodoParentGone(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "trip", userID)
+
+	pack := mustAddTodo(t, s, "pack", listID, userID)
+	clothes := mustAddSubtask(t, s, "clothes", pack, listID, userID)
+
+	if err := s.DeleteTodo(userID, listID, clothes, userID); err != nil {
+		t.Fatalf("DeleteTodo: %v", err)
+	}
+	if err := s.DeleteTodo(userID, listID, pack, userID); err != nil {
+		t.Fatalf("DeleteTodo: %v", err)
+	}
+	if err := s.RestoreTodo(userID, listID, clothes, userID); err != nil {
+		t.Fatalf("RestoreTodo: %v", err)
+	}
+
+	list := mustGetTodoList(t, s, userID, listID)
+	if len(list.Todos) != 1 || list.Todos[clothes] == nil || list.Todos[clothes].ParentID != "" {
+		t.Errorf("got %+v want only clothes at the top level", list.Todos)
+	}
+}
+
+func testRestoreNotFound(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "groceries", userID)
+	milk := mustAddTodo(t, s, "milk", listID, userID)
+
+	_, err := s.Trash("missing")
+	assertErrorIs(t, err, store.ErrUserNotFound)
+
+	err = s.RestoreTodoList(userID, listID)
+	assertErrorIs(t, err, store.ErrListNotFound)
+
+	err = s.RestoreTodo(userID, listID, milk, userID)
+	assertErrorIs(t, err, store.ErrTodoNotFound)
+
+	err = s.PurgeTrash("missing", time.Now())
+	assertErrorIs(t, err, store.ErrUserNotFound)
+}
+
+func testPurgeTrash(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	groceries := mustCreateTodoList(t, s, "groceries", userID)
+	chores := mustCreateTodoList(t, s, "chores", userID)
+	dishes := mustAddTodo(t, s, "dishes", chores, userID)
+
+	if err := s.DeleteTodoList(userID, groceries); err != nil {
+		t.Fatalf("DeleteTodoList: %v", err)
+	}
+	if err := s.DeleteTodo(userID, chores, dishes, userID); err != nil {
+		t.Fatalf("DeleteTodo: %v", err)
+	}
+
+	if err := s.PurgeTrash(userID, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("PurgeTrash: %v", err)
+	}
+	if trash := mustTrash(t, s, userID); len(trash.Lists) != 1 || len(trash.Todos) != 1 {
+		t.Fatalf("got %+v want nothing purged that was deleted since", trash)
+	}
+
+	if err := s.PurgeTrash(userID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("PurgeTrash: %v", err)
+	}
+	if trash := mustTrash(t, s, userID); len(trash.Lists) != 0 || len(trash.Todos) != 0 {
+		t.Errorf("got %+v want an empty trash", trash)
+	}
+
+	err := s.RestoreTodoList(userID, groceries)
+	assertErrorIs(t, err, store.ErrListNotFound)
+	err = s.RestoreTodo(userID, chores, dishes, userID)
+	assertErrorIs(t, err, store.ErrTodoNotFound)
+}
+
+func testShareTodoList(t *testing.T, s store.Store) {
+	steve := mustCreateUser(t, s, "Steve")
+	stephen := mustCreateUser(t, s, "Stephen")
+	groceries := mustCreateTodoList(t, s, "groceries", steve)
+	chores := mustCreateTodoList(t, s, "chores", steve)
+
+	if err := s.ShareTodoList(steve, groceries, stephen, store.RoleViewer); err != nil {
+		t.Fatalf("ShareTodoList: %v", err)
+	}
+	if err := s.ShareTodoList(steve, chores, stephen, store.RoleViewer); err != nil {
+		t.Fatalf("ShareTodoList: %v", err)
+	}
+	if err := s.ShareTodoList(steve, chores, stephen, store.RoleEditor); err != nil {
+		t.Fatalf("ShareTodoList again: %v", err)
+	}
+
+	list := mustGetTodoList(t, s, steve, chores)
+	if got := list.RoleOf(steve, stephen); got != store.RoleEditor {
+		t.Errorf("got role %q want %q after sharing again", got, store.RoleEditor)
+	}
+	if got := list.RoleOf(steve, steve); got != store.RoleOwner {
+		t.Errorf("got role %q for the owner want %q", got, store.RoleOwner)
+	}
+
+	list.Name = "housework"
+	mustUpdateTodoList(t, s, list, steve)
+	if list = mustGetTodoList(t, s, steve, chores); list.Members[stephen] != store.RoleEditor {
+		t.Errorf("got members %v want UpdateTodoList to keep them", list.Members)
+	}
+
+	shared, err := s.SharedTodoLists(stephen)
+	if err != nil {
+		t.Fatalf("SharedTodoLists: %v", err)
+	}
+	if len(shared) != 2 || shared[0].ID != groceries || shared[1].ID != chores {
+		t.Fatalf("got %+v want groceries then chores", shared)
+	}
+	if shared[0].OwnerID != steve || shared[0].Role != store.RoleViewer || shared[1].Role != store.RoleEditor {
+		t.Errorf("got %+v want both owned by %s, as viewer then editor", shared, steve)
+	}
+	if shared, err = s.SharedTodoLists(steve); err != nil || len(shared) != 0 {
+		t.Errorf("got %+v, %v want nothing shared with the owner", shared, err)
+	}
+
+	if err := s.UnshareTodoList(steve, groceries, stephen); err != nil {
+		t.Fatalf("UnshareTodoList: %v", err)
+	}
+	if err := s.DeleteTodoList(steve, chores); err != nil {
+		t.Fatalf("DeleteTodoList: %v", err)
+	}
+	if shared, err = s.SharedTodoLists(stephen); err != nil || len(shared) != 0 {
+		t.Errorf("got %+v, %v want neither the unshared nor the trashed list", shared, err)
+	}
+	if list = mustGetTodoList(t, s, steve, groceries); list.Members != nil {
+		t.Errorf("got members %v want none after unsharing", list.Members)
+	}
+}
+
+func testShareTodoListInvalid(t *testing.T, s store.Store) {
+	steve := mustCreateUser(t, s, "Steve")
+	stephen := mustCreateUser(t, s, "Stephen")
+	groceries := mustCreateTodoList(t, s, "groceries", steve)
+
+	err := s.ShareTodoList(steve, groceries, stephen, store.RoleOwner)
+	assertErrorIs(t, err, store.ErrInvalidMember)
+
+	err = s.ShareTodoList(steve, groceries, stephen, "admin")
+	assertErrorIs(t, err, store.ErrInvalidMember)
+
+	err = s.ShareTodoList(steve, groceries, steve, store.RoleEditor)
+	assertErrorIs(t, err, store.ErrInvalidMember)
+
+	err = s.ShareTodoList(steve, groceries, "missing", store.RoleEditor)
+	assertErrorIs(t, err, store.ErrUserNotFound)
+
+	err = s.ShareTodoList(steve, "missing", stephen, store.RoleEditor)
+	assertErrorIs(t, err, store.ErrListNotFound)
+
+	err = s.UnshareTodoList(steve, groceries, stephen)
+	assertErrorIs(t, err, store.ErrMemberNotFound)
+
+	_, err = s.SharedTodoLists("missing")
+	assertErrorIs(t, err, store.ErrUserNotFound)
+}
+
+func testDeleteUserLeavesSharedLists(t *testing.T, s store.Store) {
+	steve := mustCreateUser(t, s, "Steve")
+	stephen := mustCreateUser(t, s, "Stephen")
+	groceries := mustCreateTodoList(t, s, "groceries", steve)
+	chores := mustCreateTodoList(t, s, "chores", steve)
+
+	for _, listID := range []string{groceries, chores} {
+		if err := s.ShareTodoList(steve, listID, stephen, store.RoleEditor); err != nil {
+			t.Fatalf("ShareTodoList: %v", err)
+		}
+	}
+	if err := s.DeleteTodoList(steve, chores); err != nil {
+		t.Fatalf("DeleteTodoList: %v", err)
+	}
+	if err := s.DeleteUser(stephen); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	if list := mustGetTodoList(t, s, steve, groceries); list.Members != nil {
+		t.Errorf("got members %v want the deleted user gone", list.Members)
+	}
+	if err := s.RestoreTodoList(steve, chores); err != nil {
+		t.Fatalf("RestoreTodoList: %v", err)
+	}
+	if list := mustGetTodoList(t, s, steve, chores); list.Members != nil {
+		t.Errorf("got members %v want the deleted user gone from the trash too", list.Members)
+	}
+}
+
+func testAssignTodo(t *testing.T, s store.Store) {
+	steve := mustCreateUser(t, s, "Steve")
+	stephen := mustCreateUser(t, s, "Stephen")
+	groceries := mustCreateTodoList(t, s, "groceries", steve)
+	if err := s.ShareTodoList(steve, groceries, stephen, store.RoleViewer); err != nil {
+		t.Fatalf("ShareTodoList: %v", err)
+	}
+
+	milk, err := s.AddTodo(store.Todo{Title: "milk", AssigneeID: stephen}, groceries, steve, steve)
+	if err != nil {
+		t.Fatalf("AddTodo assigned to a member: %v", err)
+	}
+	bread, err := s.AddTodo(store.Todo{Title: "bread", AssigneeID: steve}, groceries, steve, steve)
+	if err != nil {
+		t.Fatalf("AddTodo assigned to the owner: %v", err)
+	}
+
+	list := mustGetTodoList(t, s, steve, groceries)
+	if got := list.Todos[milk].AssigneeID; got != stephen {
+		t.Errorf("got assignee %q want %q", got, stephen)
+	}
+
+	todo := *list.Todos[bread]
+	todo.AssigneeID = stephen
+	if err = s.UpdateTodo(todo, groceries, steve, steve); err != nil {
+		t.Fatalf("UpdateTodo: %v", err)
+	}
+	history, err := s.TodoHistory(steve, groceries, bread)
+	if err != nil {
+		t.Fatalf("TodoHistory: %v", err)
+	}
+	if last := history[len(history)-1]; !slices.Equal(last.Fields, []string{"AssigneeID"}) {
+		t.Errorf("got fields %v want the assignee change recorded", last.Fields)
+	}
+
+	if err = s.UnshareTodoList(steve, groceries, stephen); err != nil {
+		t.Fatalf("UnshareTodoList: %v", err)
+	}
+	list = mustGetTodoList(t, s, steve, groceries)
+	if list.Todos[milk].AssigneeID != "" || list.Todos[bread].AssigneeID != "" {
+		t.Errorf("got assignees %q and %q want both cleared after unsharing", list.Todos[milk].AssigneeID, list.Todos[bread].AssigneeID)
+	}
+}
+
+func testUnassignRemovedMember(t *testing.T, s store.Store) {
+	steve := mustCreateUser(t, s, "Steve")
+	stephen := mustCreateUser(t, s, "Stephen")
+	groceries := mustCreateTodoList(t, s, "groceries", steve)
+	chores := mustCreateTodoList(t, s, "chores", steve)
+	for _, listID := range []string{groceries, chores} {
+		if err := s.ShareTodoList(steve, listID, stephen, store.RoleEditor); err != nil {
+			t.Fatalf("ShareTodoList: %v", err)
+		}
+	}
+	milk, err := s.AddTodo(store.Todo{Title: "milk", AssigneeID: stephen}, groceries, steve, steve)
+	if err != nil {
+		t.Fatalf("AddTodo: %v", err)
+	}
+	dishes, err := s.AddTodo(store.Todo{Title: "dishes", AssigneeID: stephen}, chores, steve, steve)
+	if err != nil {
+		t.Fatalf("AddTodo: %v", err)
+	}
+
+	assertUnassigned := func(stale store.TodoList, todoID string) {
+		t.Helper()
+
+		list := mustGetTodoList(t, s, steve, stale.ID)
+		todo := list.Todos[todoID]
+		if todo.AssigneeID != "" {
+			t.Errorf("got assignee %q want it cleared", todo.AssigneeID)
+		}
+		if list.Version != stale.Version+1 {
+			t.Errorf("got version %d want %d", list.Version, stale.Version+1)
+		}
+		history, err := s.TodoHistory(steve, stale.ID, todoID)
+		if err != nil {
+			t.Fatalf("TodoHistory: %v", err)
+		}
+		last := history[len(history)-1]
+		if last.Action != store.ActionUpdated || last.UserID != steve || !slices.Equal(last.Fields, []string{"AssigneeID"}) {
+			t.Errorf("got last entry %+v want an update of AssigneeID by the owner", last)
+		}
+		if !todo.UpdatedAt.Equal(last.At) || todo.UpdatedAt.Before(stale.Todos[todoID].UpdatedAt) {
+			t.Errorf("got UpdatedAt %v want %v", todo.UpdatedAt, last.At)
+		}
+		err = s.UpdateTodoList(stale, steve, steve)
+		assertErrorIs(t, err, store.ErrConflict)
+	}
+
+	stale := mustGetTodoList(t, s, steve, groceries)
+	if err = s.UnshareTodoList(steve, groceries, stephen); err != nil {
+		t.Fatalf("UnshareTodoList: %v", err)
+	}
+	assertUnassigned(stale, milk)
+
+	stale = mustGetTodoList(t, s, steve, chores)
+	if err = s.DeleteUser(stephen); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	assertUnassigned(stale, dishes)
+}
+
+func testAssignTodoInvalid(t *testing.T, s store.Store) {
+	steve := mustCreateUser(t, s, "Steve")
+	stephen := mustCreateUser(t, s, "Stephen")
+	groceries := mustCreateTodoList(t, s, "groceries", steve)
+	milk := mustAddTodo(t, s, "milk", groceries, steve)
+
+	_, err := s.AddTodo(store.Todo{Title: "bread", AssigneeID: stephen}, groceries, steve, steve)
+	assertErrorIs(t, err, store.ErrInvalidTodo)
+
+	list := mustGetTodoList(t, s, steve, groceries)
+	todo := *list.Todos[milk]
+	todo.AssigneeID = stephen
+	err = s.UpdateTodo(todo, groceries, steve, steve)
+	assertErrorIs(t, err, store.ErrInvalidTodo)
+
+	list.Todos[milk].AssigneeID = stephen
+	err = s.UpdateTodoList(list, steve, steve)
+	assertErrorIs(t, err, store.ErrInvalidTodo)
+
+	_, err = s.CreateTodoList(list, steve)
+	assertErrorIs(t, err, store.ErrInvalidTodo)
+}
+
+func testFindTodosByAssignee(t *testing.T, s store.Store) {
+	steve := mustCreateUser(t, s, "Steve")
+	stephen := mustCreateUser(t, s, "Stephen")
+	groceries := mustCreateTodoList(t, s, "groceries", steve)
+	garden := mustCreateTodoList(t, s, "garden", stephen)
+	if err := s.ShareTodoList(steve, groceries, stephen, store.RoleEditor); err != nil {
+		t.Fatalf("ShareTodoList: %v", err)
+	}
+
+	for _, todo := range []struct {
+		title, assigneeID, listID, ownerID string
+	}{
+		{"milk", stephen, groceries, steve},
+		{"bread", steve, groceries, steve},
+		{"weeds", stephen, garden, stephen},
+		{"hedge", "", garden, stephen},
+	} {
+		if _, err := s.AddTodo(store.Todo{Title: todo.title, AssigneeID: todo.assigneeID}, todo.listID, todo.ownerID, todo.ownerID); err != nil {
+			t.Fatalf("AddTodo(%q): %v", todo.title, err)
+		}
+	}
+
+	found, err := s.FindTodos(stephen, store.TodoQuery{AssigneeID: stephen})
+	if err != nil {
+		t.Fatalf("FindTodos: %v", err)
+	}
+
+	var got []string
+	for _, todo := range found {
+		got = append(got, todo.ListName+": "+todo.Title)
+	}
+	assertOrder(t, got, "garden: weeds", "groceries: milk")
+	if len(found) == 2 && (found[0].OwnerID != stephen || found[1].OwnerID != steve) {
+		t.Errorf("got owners %q and %q want %q then %q", found[0].OwnerID, found[1].OwnerID, stephen, steve)
+	}
+
+	if found, err = s.FindTodos(steve, store.TodoQuery{AssigneeID: stephen}); err != nil || len(found) != 1 {
+		t.Errorf("got %+v, %v want only the owner's todo assigned to the member", found, err)
+	}
+}
+
+func testDeleteTodo(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "groceries", userID)
+
+	milk := mustAddTodo(t, s, "milk", listID, userID)
+	bread := mustAddTodo(t, s, "bread", listID, userID)
+
+	if err := s.DeleteTodo(userID, listID, milk, userID); err != nil {
+		t.Fatalf("DeleteTodo: %v", err)
+	}
+
+	list := mustGetTodoList(t, s, userID, listID)
+	if len(list.Todos) != 1 || list.Todos[bread] == nil {
+		t.Errorf("got %+v want only todo %s", list.Todos, bread)
+	}
+}
+
+func testDeleteTodoNotFound(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "groceries", userID)
+
+	err := s.DeleteTodo(userID, listID, "missing", userID)
+	assertErrorIs(t, err, store.ErrTodoNotFound)
+}
+
+func testToggleTodo(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "groceries", userID)
+	todoID := mustAddTodo(t, s, "milk", listID, userID)
+
+	for _, want := range []bool{true, false} {
+		if err := s.ToggleTodo(userID, listID, todoID, userID); err != nil {
+			t.Fatalf("ToggleTodo: %v", err)
+		}
+
+		list := mustGetTodoList(t, s, userID, listID)
+		if got := list.Todos[todoID].Completed; got != want {
+			t.Errorf("got completed %t want %t", got, want)
+		}
+	}
+}
+
+func testToggleTodoListNotFound(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+
+	err := s.ToggleTodo(userID, "missing", "1", userID)
+	assertErrorIs(t, err, store.ErrListNotFound)
+}
+
+func testToggleTodoNotFound(t *testing.T, s store.Store) {
+	userID := mustCreateUser(t, s, "Steve")
+	listID := mustCreateTodoList(t, s, "groceries", userID)
+
+	err := s.ToggleTodo(userID, listID, "missing", userID)
+	assertErrorIs(t, err, store.ErrTodoNotFound)
+}
@@ -0,0 +1,169 @@
+package store
+
+import (
+	"slices"
+	"time"
+)
+
+// Subtasks returns the todos directly under parentID in order, or the top
+// level todos when parentID is empty. A todo whose parent is missing counts
+// as top level so it never drops out of view.
+func Subtasks(todos map[string]*Todo, parentID string, order SortOrder) []*Todo {
+	var subtasks []*Todo
+	for _, todo := range SortTodos(todos, order) {
+		if parentOf(todos, todo) == parentID {
+			subtasks = append(subtasks, todo)
+		}
+	}
+	return subtasks
+}
+
+// Progress counts the subtasks directly under parentID and how many of them
+// are completed, the same todos Subtasks returns.
+func Progress(todos map[string]*Todo, parentID string) (done int, total int) {
+	for _, todo := range todos {
+		if parentOf(todos, todo) != parentID {
+			continue
+		}
+		total++
+		if todo.Completed {
+			done++
+		}
+	}
+	return done, total
+}
+
+func parentOf(todos map[string]*Todo, todo *Todo) string {
+	if _, exists := todos[todo.ParentID]; !exists {
+		return ""
+	}
+	return todo.ParentID
+}
+
+// subtree returns todoID followed by every todo below it.
+func subtree(todos map[string]*Todo, todoID string) []string {
+	ids := []string{todoID}
+	for i := 0; i < len(ids); i++ {
+		for _, todo := range todos {
+			if todo.ParentID == ids[i] {
+				ids = append(ids, todo.ID)
+			}
+		}
+	}
+	return ids
+}
+
+// checkParent makes sure a todo being added to list goes under a todo that
+// is already there.
+func checkParent(list *TodoList, todo Todo, userID string) error {
+	if todo.ParentID == "" {
+		return nil
+	}
+	if _, exists := list.Todos[todo.ParentID]; !exists {
+		return errorf(ErrInvalidTodo, "parent todo with ID %s in list ID %s for user ID %s does not exist", todo.ParentID, list.ID, userID)
+	}
+	return nil
+}
+
+// checkTree makes sure every parent in a list given to UpdateTodoList is in
+// the list and that no todo ends up beneath itself. Each todo's recurrence is
+// checked along the way.
+func checkTree(list TodoList, userID string) error {
+	for _, todo := range list.Todos {
+		if err := checkParent(&list, *todo, userID); err != nil {
+			return err
+		}
+		if err := checkRecurrence(*todo, list.ID, userID); err != nil {
+			return err
+		}
+
+		seen := []string{todo.ID}
+		for parent := todo.ParentID; parent != ""; {
+			if slices.Contains(seen, parent) {
+				return errorf(ErrInvalidTodo, "todo with ID %s in list ID %s for user ID %s is beneath itself", todo.ID, list.ID, userID)
+			}
+			p, ok := list.Todos[parent]
+			if !ok {
+				return errorf(ErrInvalidTodo, "parent todo with ID %s in list ID %s for user ID %s does not exist", parent, list.ID, userID)
+			}
+			seen = append(seen, parent)
+			parent = p.ParentID
+		}
+	}
+	return nil
+}
+
+// newTodoIDs gives every todo of list that stored doesn't hold an ID from
+// ids, pointing its subtasks at the new one, so callers can't pick todo IDs.
+// stored is nil for a list being created. list must be the store's own copy.
+func newTodoIDs(list *TodoList, stored *TodoList, ids IDGenerator) {
+	renamed := make(map[string]string)
+	todos := make(map[string]*Todo, len(list.Todos))
+	for _, todo := range SortTodos(list.Todos, ByPosition) {
+		if stored == nil || stored.Todos[todo.ID] == nil {
+			renamed[todo.ID] = ids.NewID()
+			todo.ID = renamed[todo.ID]
+		}
+		todos[todo.ID] = todo
+	}
+
+	for _, todo := range todos {
+		if id, exists := renamed[todo.ParentID]; exists {
+			todo.ParentID = id
+		}
+	}
+	list.Todos = todos
+}
+
+// deleteTodo removes the todo and everything below it, returning the IDs of
+// the todos removed or nil when todoID isn't in the list.
+func deleteTodo(list *TodoList, todoID string) []string {
+	if _, exists := list.Todos[todoID]; !exists {
+		return nil
+	}
+
+	ids := subtree(list.Todos, todoID)
+	for _, id := range ids {
+		delete(list.Todos, id)
+	}
+	return ids
+}
+
+// toggleTodo toggles the todo and, when the list asks for it and the todo
+// was just completed, completes everything below it as well. A recurring
+// todo moves on to its next occurrence rather than being completed. It
+// stamps the todos changed and returns an entry for each, or nil when todoID
+// isn't in the list.
+func toggleTodo(list *TodoList, todoID string, userID string, now time.Time) []HistoryEntry {
+	todo, exists := list.Todos[todoID]
+	if !exists {
+		return nil
+	}
+
+	stored := cloneTodo(*todo)
+	if !todo.Completed && nextOccurrence(todo) {
+		entry, _ := updated(stored, todo, list.ID, userID, now)
+		entry.Action = ActionCompleted
+		todo.CompletedAt = &now
+		return []HistoryEntry{entry}
+	}
+
+	todo.Toggle()
+	entry, _ := updated(stored, todo, list.ID, userID, now)
+	if !todo.Completed || !list.CompleteSubtasks {
+		return []HistoryEntry{entry}
+	}
+
+	entries := []HistoryEntry{entry}
+	for _, id := range subtree(list.Todos, todoID)[1:] {
+		subtask := list.Todos[id]
+		if subtask.Completed {
+			continue
+		}
+		stored := *subtask
+		subtask.Completed = true
+		entry, _ := updated(stored, subtask, list.ID, userID, now)
+		entries = append(entries, entry)
+	}
+	return entries
+}
@@ -0,0 +1,41 @@
+package store
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSubtasks(t *testing.T) {
+	todos := map[string]*Todo{
+		"01A": {ID: "01A", Title: "pack", Position: 0},
+		"01B": {ID: "01B", Title: "socks", ParentID: "01A", Position: 1, Completed: true},
+		"01C": {ID: "01C", Title: "charger", ParentID: "01A", Position: 0},
+		"01D": {ID: "01D", Title: "orphan", ParentID: "gone", Position: 2},
+	}
+
+	var got []string
+	for _, todo := range Subtasks(todos, "", ByPosition) {
+		got = append(got, todo.Title)
+	}
+	if want := []string{"pack", "orphan"}; !slices.Equal(got, want) {
+		t.Errorf("got top level %v want %v", got, want)
+	}
+
+	got = nil
+	for _, todo := range Subtasks(todos, "01A", ByPosition) {
+		got = append(got, todo.Title)
+	}
+	if want := []string{"charger", "socks"}; !slices.Equal(got, want) {
+		t.Errorf("got subtasks %v want %v", got, want)
+	}
+
+	if done, total := Progress(todos, "01A"); done != 1 || total != 2 {
+		t.Errorf("got progress %d/%d want 1/2", done, total)
+	}
+	if done, total := Progress(todos, ""); done != 0 || total != 2 {
+		t.Errorf("got top level progress %d/%d want 0/2, orphan included", done, total)
+	}
+	if _, total := Progress(todos, "gone"); total != 0 {
+		t.Errorf("got %d subtasks under a missing todo want 0", total)
+	}
+}
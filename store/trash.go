@@ -0,0 +1,155 @@
+package store
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"time"
+)
+
+// DefaultRetention is how long deleted lists and todos stay in the trash
+// unless WithRetention says otherwise.
+const DefaultRetention = 30 * 24 * time.Hour
+
+// Trash holds what a user deleted, newest first. Every list and todo in it
+// has DeletedAt set.
+type Trash struct {
+	// Lists are deleted lists along with the todos they held.
+	Lists []TodoList
+	// Todos are todos deleted on their own, each with the subtasks deleted
+	// along with it.
+	Todos []TrashedTodo
+}
+
+// TrashedTodo is a deleted todo and the list it was deleted from.
+type TrashedTodo struct {
+	ListID string
+	Todo
+}
+
+// trashList moves the list into trash, reporting false when listID isn't one
+// of lists.
+func trashList(trash *Trash, lists map[string]*TodoList, listID string, now time.Time) bool {
+	list, exists := lists[listID]
+	if !exists {
+		return false
+	}
+
+	delete(lists, listID)
+	list.DeletedAt = &now
+	trash.Lists = append(trash.Lists, *list)
+	return true
+}
+
+// trashTodo moves the todo and everything below it from list into trash,
+// returning an entry for each or nil when todoID isn't in the list.
+func trashTodo(trash *Trash, list *TodoList, todoID string, userID string, now time.Time) []HistoryEntry {
+	todos := maps.Clone(list.Todos)
+	deleted := deleteTodo(list, todoID)
+
+	var entries []HistoryEntry
+	for _, id := range deleted {
+		todo := todos[id]
+		todo.DeletedAt = &now
+		todo.UpdatedAt = now
+		trash.Todos = append(trash.Todos, TrashedTodo{ListID: list.ID, Todo: *todo})
+		entries = append(entries, HistoryEntry{ListID: list.ID, TodoID: id, UserID: userID, At: now, Action: ActionDeleted})
+	}
+	return entries
+}
+
+// restoreList moves the list out of trash and to the end of lists, reporting
+// false when it isn't in the trash.
+func restoreList(trash *Trash, lists map[string]*TodoList, listID string) bool {
+	i := slices.IndexFunc(trash.Lists, func(list TodoList) bool { return list.ID == listID })
+	if i < 0 {
+		return false
+	}
+
+	list := trash.Lists[i]
+	trash.Lists = slices.Delete(trash.Lists, i, i+1)
+	list.DeletedAt = nil
+	list.Position = nextListPosition(lists)
+	lists[list.ID] = &list
+	return true
+}
+
+// restoreTodo moves the todo back into list along with the subtasks deleted
+// with it, returning an entry for each or nil when it isn't in the trash. It
+// goes at the end, at the top level if its parent is gone.
+func restoreTodo(trash *Trash, list *TodoList, todoID string, userID string, now time.Time) []HistoryEntry {
+	trashed := make(map[string]*Todo)
+	for i := range trash.Todos {
+		if trash.Todos[i].ListID == list.ID {
+			trashed[trash.Todos[i].ID] = &trash.Todos[i].Todo
+		}
+	}
+	root, exists := trashed[todoID]
+	if !exists {
+		return nil
+	}
+
+	if _, exists = list.Todos[root.ParentID]; !exists {
+		root.ParentID = ""
+	}
+	root.Position = nextTodoPosition(list, root.ParentID)
+
+	ids := subtree(trashed, todoID)
+	var entries []HistoryEntry
+	for _, id := range ids {
+		todo := *trashed[id]
+		todo.DeletedAt = nil
+		todo.UpdatedAt = now
+		list.Todos[id] = &todo
+		entries = append(entries, HistoryEntry{ListID: list.ID, TodoID: id, UserID: userID, At: now, Action: ActionRestored})
+	}
+
+	trash.Todos = slices.DeleteFunc(trash.Todos, func(todo TrashedTodo) bool {
+		return todo.ListID == list.ID && slices.Contains(ids, todo.ID)
+	})
+	return entries
+}
+
+// purge drops everything deleted at or before before, along with the todos
+// deleted from a list that is dropped. It returns what was dropped.
+func (t *Trash) purge(before time.Time) Trash {
+	var purged Trash
+
+	t.Lists = slices.DeleteFunc(t.Lists, func(list TodoList) bool {
+		if list.DeletedAt.After(before) {
+			return false
+		}
+		purged.Lists = append(purged.Lists, list)
+		return true
+	})
+
+	t.Todos = slices.DeleteFunc(t.Todos, func(todo TrashedTodo) bool {
+		listPurged := slices.ContainsFunc(purged.Lists, func(list TodoList) bool { return list.ID == todo.ListID })
+		if !listPurged && todo.DeletedAt.After(before) {
+			return false
+		}
+		purged.Todos = append(purged.Todos, todo)
+		return true
+	})
+
+	return purged
+}
+
+// forgetLive drops the todos deleted from list that it holds again, as when
+// a list given to UpdateTodoList brings one back.
+func (t *Trash) forgetLive(list *TodoList) {
+	t.Todos = slices.DeleteFunc(t.Todos, func(todo TrashedTodo) bool {
+		_, live := list.Todos[todo.ID]
+		return todo.ListID == list.ID && live
+	})
+}
+
+// sortTrash orders the trash newest first.
+func sortTrash(trash *Trash) {
+	slices.SortStableFunc(trash.Lists, func(a, b TodoList) int {
+		return cmp.Or(b.DeletedAt.Compare(*a.DeletedAt), cmp.Compare(a.ID, b.ID))
+	})
+	slices.SortStableFunc(trash.Todos, func(a, b TrashedTodo) int {
+		return cmp.Or(b.DeletedAt.Compare(*a.DeletedAt), cmp.Compare(a.ListID, b.ListID), cmp.Compare(a.Position, b.Position), cmp.Compare(a.ID, b.ID))
+	})
+}
@@ -0,0 +1,30 @@
+package store
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// listUsers returns the users in ID order without their lists, as GetUsers
+// does.
+func listUsers(users map[string]*User) []User {
+	listed := make([]User, 0, len(users))
+	for _, user := range users {
+		listed = append(listed, User{ID: user.ID, Name: user.Name})
+	}
+
+	slices.SortFunc(listed, func(a, b User) int { return cmp.Compare(a.ID, b.ID) })
+	return listed
+}
+
+// checkName makes sure no user in users other than userID goes by name,
+// whatever its case. Logins are by name, so no two users may share one.
+func checkName(users map[string]*User, userID string, name string) error {
+	for _, user := range users {
+		if user.ID != userID && strings.EqualFold(user.Name, name) {
+			return errorf(ErrConflict, "the name %s is taken", name)
+		}
+	}
+	return nil
+}